@@ -0,0 +1,157 @@
+package database
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources of account history entries.
+const (
+	HistorySourceFetch      = "fetch"
+	HistorySourceLease      = "lease"
+	HistorySourceExport     = "export"
+	HistorySourceManual     = "manual"
+	HistorySourceBatch      = "batch"
+	HistorySourceValidation = "validation"
+	HistorySourceSettings   = "settings"
+	HistorySourceSystem     = "system"
+)
+
+// HistorySource describes what changed a set of accounts.
+type HistorySource struct {
+	Source string
+	RunID  *uint
+	Actor  string
+}
+
+// AccountStates holds the tracked state of accounts by ID, taken before a
+// change so RecordAccountChanges can tell what it did.
+type AccountStates map[uint]Account
+
+// trackedColumns are the account columns whose changes are recorded.
+const trackedColumns = "id, category_id, used, banned, use_count, lease_id, cooldown_until, data_hash"
+
+// LoadAccountStates loads the tracked state of the given accounts.
+func LoadAccountStates(tx *gorm.DB, ids []uint) (AccountStates, error) {
+	if len(ids) == 0 {
+		return AccountStates{}, nil
+	}
+	var accounts []Account
+	if err := tx.Session(&gorm.Session{NewDB: true}).Select(trackedColumns).Where("id IN ?", ids).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return StatesOf(accounts), nil
+}
+
+// StatesOf returns the tracked state of accounts that are already loaded.
+func StatesOf(accounts []Account) AccountStates {
+	states := make(AccountStates, len(accounts))
+	for _, acc := range accounts {
+		states[acc.ID] = acc
+	}
+	return states
+}
+
+// RecordAccountChanges stores a history entry for each account in before
+// whose tracked state has changed since.
+func RecordAccountChanges(tx *gorm.DB, before AccountStates, source HistorySource) error {
+	if len(before) == 0 {
+		return nil
+	}
+	ids := slices.Sorted(maps.Keys(before))
+	after, err := LoadAccountStates(tx, ids)
+	if err != nil {
+		return err
+	}
+	var entries []AccountHistory
+	for _, id := range ids {
+		cur, ok := after[id]
+		if !ok {
+			continue
+		}
+		old, changed := diffAccountState(before[id], cur)
+		if len(changed) == 0 {
+			continue
+		}
+		entries = append(entries, AccountHistory{
+			AccountID:  id,
+			CategoryID: cur.CategoryID,
+			Source:     source.Source,
+			RunID:      source.RunID,
+			Actor:      source.Actor,
+			Before:     old,
+			After:      changed,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).CreateInBatches(entries, 500).Error
+}
+
+// UpdateTrackedAccounts applies updates to the given accounts that still
+// match the optional condition in where, in chunks, and records the changes.
+// It returns the number of accounts updated.
+func UpdateTrackedAccounts(tx *gorm.DB, ids []uint, updates map[string]interface{}, source HistorySource, where ...interface{}) (int64, error) {
+	var updated int64
+	for chunk := range slices.Chunk(ids, 1000) {
+		states, err := LoadAccountStates(tx, chunk)
+		if err != nil {
+			return updated, err
+		}
+		query := tx.Session(&gorm.Session{NewDB: true}).Model(&Account{}).Where("id IN ?", chunk)
+		if len(where) > 0 {
+			query = query.Where(where[0], where[1:]...)
+		}
+		result := query.Updates(updates)
+		if result.Error != nil {
+			return updated, result.Error
+		}
+		updated += result.RowsAffected
+		if err := RecordAccountChanges(tx, states, source); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// diffAccountState returns the tracked values that differ between old and
+// cur. Lease IDs grant access to the account, so only whether it is leased
+// is recorded.
+func diffAccountState(old, cur Account) (before, after map[string]interface{}) {
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	if old.Used != cur.Used {
+		before["used"], after["used"] = old.Used, cur.Used
+	}
+	if old.Banned != cur.Banned {
+		before["banned"], after["banned"] = old.Banned, cur.Banned
+	}
+	if old.UseCount != cur.UseCount {
+		before["use_count"], after["use_count"] = old.UseCount, cur.UseCount
+	}
+	if (old.LeaseID != nil) != (cur.LeaseID != nil) {
+		before["leased"], after["leased"] = old.LeaseID != nil, cur.LeaseID != nil
+	}
+	if !sameTime(old.CooldownUntil, cur.CooldownUntil) {
+		before["cooldown_until"], after["cooldown_until"] = old.CooldownUntil, cur.CooldownUntil
+	}
+	if old.DataHash != cur.DataHash {
+		after["data_changed"] = true
+	}
+	return before, after
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// CleanupAccountHistory drops account history entries older than 90 days.
+func CleanupAccountHistory() {
+	DB.Where("created_at < ?", time.Now().AddDate(0, 0, -90)).Delete(&AccountHistory{})
+}
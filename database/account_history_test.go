@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// historyOf returns the history entries of an account, oldest first.
+func historyOf(accountID uint) []AccountHistory {
+	var entries []AccountHistory
+	DB.Where("account_id = ?", accountID).Order("id").Find(&entries)
+	return entries
+}
+
+func TestRecordAccountChanges(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "history")
+	changed := seedAccount(t, cat.ID, "a:1")
+	same := seedAccount(t, cat.ID, "b:1")
+	states, err := LoadAccountStates(DB, []uint{changed.ID, same.ID})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	lease := "secret-lease"
+	dataUpdates, _ := AccountDataUpdates(&cat, "a:2")
+	dataUpdates["banned"] = true
+	dataUpdates["lease_id"] = lease
+	DB.Model(&Account{}).Where("id = ?", changed.ID).Updates(dataUpdates)
+	runID := uint(9)
+	if err := RecordAccountChanges(DB, states, HistorySource{Source: HistorySourceValidation, RunID: &runID}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	if entries := historyOf(same.ID); len(entries) != 0 {
+		t.Errorf("expected no entry for an unchanged account, got %d", len(entries))
+	}
+	entries := historyOf(changed.ID)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Source != HistorySourceValidation || e.RunID == nil || *e.RunID != 9 || e.CategoryID != cat.ID {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e.Before["banned"] != false || e.After["banned"] != true || e.After["leased"] != true || e.After["data_changed"] != true {
+		t.Errorf("unexpected change %v -> %v", e.Before, e.After)
+	}
+	if _, ok := e.After["used"]; ok {
+		t.Errorf("expected unchanged fields left out, got %v", e.After)
+	}
+}
+
+func TestUpdateTrackedAccounts_HonoursCondition(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "tracked")
+	free := seedAccountWithStatus(t, cat.ID, "free", true, false)
+	leased := seedAccountWithStatus(t, cat.ID, "leased", true, false)
+	DB.Model(&Account{}).Where("id = ?", leased.ID).Update("lease_id", "x")
+
+	updated, err := UpdateTrackedAccounts(DB, []uint{free.ID, leased.ID}, map[string]interface{}{"used": false},
+		HistorySource{Source: HistorySourceBatch, Actor: "ops"}, "lease_id IS NULL")
+	if err != nil || updated != 1 {
+		t.Fatalf("expected 1 account updated, got %d err=%v", updated, err)
+	}
+	if entries := historyOf(free.ID); len(entries) != 1 || entries[0].Actor != "ops" {
+		t.Errorf("expected one entry by ops, got %+v", entries)
+	}
+	if entries := historyOf(leased.ID); len(entries) != 0 {
+		t.Errorf("expected no entry for the skipped account, got %d", len(entries))
+	}
+}
+
+func TestReleaseCooledDownAccounts_RecordsHistory(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "cooldown")
+	acc := seedAccountWithStatus(t, cat.ID, "rested", true, false)
+	DB.Model(&acc).Updates(map[string]interface{}{"use_count": 1, "cooldown_until": time.Now().Add(-time.Minute)})
+
+	if released := ReleaseCooledDownAccounts(); released != 1 {
+		t.Fatalf("expected 1 account released, got %d", released)
+	}
+	entries := historyOf(acc.ID)
+	if len(entries) != 1 || entries[0].Source != HistorySourceSystem || entries[0].After["used"] != false {
+		t.Errorf("expected a system entry marking the account available, got %+v", entries)
+	}
+}
+
+func TestPurgeAccounts_RemovesHistory(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "purged")
+	acc := seedAccount(t, cat.ID, "gone")
+	DB.Create(&AccountHistory{AccountID: acc.ID, CategoryID: cat.ID, Source: HistorySourceManual})
+	DB.Delete(&acc)
+
+	if _, err := PurgeAccounts(DB, "id = ?", acc.ID); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if entries := historyOf(acc.ID); len(entries) != 0 {
+		t.Errorf("expected history purged with the account, got %d", len(entries))
+	}
+}
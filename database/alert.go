@@ -0,0 +1,92 @@
+package database
+
+import (
+	"time"
+
+	"final-account-hub/logger"
+)
+
+// Alert states, in order of severity.
+const (
+	AlertOK    = "ok"
+	AlertLow   = "low"
+	AlertEmpty = "empty"
+)
+
+var alertListeners []func(Alert)
+
+// OnAlert registers fn to be called after each recorded alert state change.
+// It is called from init functions.
+func OnAlert(fn func(Alert)) {
+	alertListeners = append(alertListeners, fn)
+}
+
+// AlertStateFor returns the alert state for a pool with the given number of
+// available accounts. A low watermark of 0 disables alerts.
+func AlertStateFor(available int64, lowWatermark int) string {
+	switch {
+	case lowWatermark <= 0:
+		return AlertOK
+	case available == 0:
+		return AlertEmpty
+	case available < int64(lowWatermark):
+		return AlertLow
+	default:
+		return AlertOK
+	}
+}
+
+// CheckAlert counts the available accounts of a category and records an
+// alert if its state changed. Called after fetches.
+func CheckAlert(categoryID uint) {
+	var cat Category
+	if err := DB.Select("id, low_watermark, alert_state").First(&cat, categoryID).Error; err != nil {
+		return
+	}
+	if cat.LowWatermark <= 0 && (cat.AlertState == AlertOK || cat.AlertState == "") {
+		return
+	}
+	var available int64
+	condition, args := AvailableCondition("", time.Now())
+	if err := DB.Model(&Account{}).Where("category_id = ?", categoryID).Where(condition, args...).
+		Count(&available).Error; err != nil {
+		logger.Error.Printf("Failed to count available accounts: %v", err)
+		return
+	}
+	recordAlertState(&cat, available)
+}
+
+// recordAlertState stores the new state of cat for the given available count.
+// The state column is updated conditionally so concurrent checkers record
+// each transition once.
+func recordAlertState(cat *Category, available int64) {
+	from := cat.AlertState
+	if from == "" {
+		from = AlertOK
+	}
+	state := AlertStateFor(available, cat.LowWatermark)
+	if state == from {
+		return
+	}
+	result := DB.Model(&Category{}).Where("id = ? AND alert_state = ?", cat.ID, cat.AlertState).
+		UpdateColumn("alert_state", state)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	cat.AlertState = state
+	alert := Alert{
+		CategoryID:   cat.ID,
+		FromState:    from,
+		State:        state,
+		Available:    available,
+		LowWatermark: cat.LowWatermark,
+	}
+	if err := DB.Create(&alert).Error; err != nil {
+		logger.Error.Printf("Failed to record alert for category %d: %v", cat.ID, err)
+		return
+	}
+	logger.Info.Printf("Category %d stock alert: %s -> %s (%d available)", cat.ID, from, state, available)
+	for _, fn := range alertListeners {
+		fn(alert)
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import "testing"
+
+func TestAlertStateFor(t *testing.T) {
+	cases := []struct {
+		available    int64
+		lowWatermark int
+		want         string
+	}{
+		{0, 0, AlertOK},
+		{0, 10, AlertEmpty},
+		{9, 10, AlertLow},
+		{10, 10, AlertOK},
+	}
+	for _, tc := range cases {
+		if got := AlertStateFor(tc.available, tc.lowWatermark); got != tc.want {
+			t.Errorf("AlertStateFor(%d, %d) = %s, want %s", tc.available, tc.lowWatermark, got, tc.want)
+		}
+	}
+}
+
+func TestCheckAlert_Transitions(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "alerts")
+	DB.Model(&cat).Update("low_watermark", 2)
+	a := seedAccount(t, cat.ID, "a")
+	b := seedAccount(t, cat.ID, "b")
+
+	CheckAlert(cat.ID)
+	DB.Model(&a).Update("used", true)
+	CheckAlert(cat.ID)
+	CheckAlert(cat.ID) // unchanged state records nothing
+	DB.Model(&b).Update("banned", true)
+	CheckAlert(cat.ID)
+	DB.Model(&Account{}).Where("category_id = ?", cat.ID).Updates(map[string]interface{}{"used": false, "banned": false})
+	CheckAlert(cat.ID)
+
+	var alerts []Alert
+	DB.Order("id").Find(&alerts)
+	want := [][2]string{{AlertOK, AlertLow}, {AlertLow, AlertEmpty}, {AlertEmpty, AlertOK}}
+	if len(alerts) != len(want) {
+		t.Fatalf("expected %d transitions, got %+v", len(want), alerts)
+	}
+	for i, w := range want {
+		if alerts[i].FromState != w[0] || alerts[i].State != w[1] {
+			t.Errorf("transition %d: expected %s -> %s, got %s -> %s", i, w[0], w[1], alerts[i].FromState, alerts[i].State)
+		}
+	}
+	if alerts[1].Available != 0 || alerts[1].LowWatermark != 2 {
+		t.Errorf("unexpected empty alert %+v", alerts[1])
+	}
+
+	var got Category
+	DB.First(&got, cat.ID)
+	if got.AlertState != AlertOK {
+		t.Errorf("expected category back to ok, got %s", got.AlertState)
+	}
+}
+
+func TestCheckAlert_DisablingResets(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "disable")
+	DB.Model(&cat).Update("low_watermark", 5)
+	CheckAlert(cat.ID)
+
+	DB.Model(&cat).Update("low_watermark", 0)
+	CheckAlert(cat.ID)
+
+	var states []string
+	DB.Model(&Alert{}).Order("id").Pluck("state", &states)
+	if len(states) != 2 || states[0] != AlertEmpty || states[1] != AlertOK {
+		t.Errorf("expected empty then ok, got %v", states)
+	}
+}
+
+func TestTakeSnapshots_RecordsAlerts(t *testing.T) {
+	setupTestDB(t)
+	low := seedCategory(t, "low")
+	DB.Model(&low).Update("low_watermark", 3)
+	seedAccount(t, low.ID, "only")
+	seedCategory(t, "no-watermark")
+
+	TakeSnapshots("1h")
+
+	var alerts []Alert
+	DB.Find(&alerts)
+	if len(alerts) != 1 || alerts[0].CategoryID != low.ID || alerts[0].State != AlertLow || alerts[0].Available != 1 {
+		t.Errorf("expected one low alert for the watermarked category, got %+v", alerts)
+	}
+}
@@ -0,0 +1,35 @@
+package database
+
+import "final-account-hub/logger"
+
+// Audited actions.
+const (
+	AuditCategoryCreate      = "category.create"
+	AuditCategoryDelete      = "category.delete"
+	AuditCategoryUpdate      = "category.update"
+	AuditCategoryRestore     = "category.restore"
+	AuditCategoryPurge       = "category.purge"
+	AuditAccountUpdate       = "account.update"
+	AuditAccountBatchUpdate  = "account.batch_update"
+	AuditAccountDelete       = "account.delete"
+	AuditAccountRestore      = "account.restore"
+	AuditAccountPurge        = "account.purge"
+	AuditPackageInstall      = "package.install"
+	AuditPackageUninstall    = "package.uninstall"
+	AuditRequirementsInstall = "package.install_requirements"
+	AuditTokenCreate         = "token.create"
+	AuditTokenUpdate         = "token.update"
+	AuditTokenDelete         = "token.delete"
+	AuditWebhookCreate       = "webhook.create"
+	AuditWebhookUpdate       = "webhook.update"
+	AuditWebhookDelete       = "webhook.delete"
+	AuditBackupImport        = "backup.import"
+)
+
+// RecordAudit stores an audit entry. Failures are logged rather than
+// returned, since the audited change has already been made.
+func RecordAudit(entry *AuditLog) {
+	if err := DB.Create(entry).Error; err != nil {
+		logger.Error.Printf("Failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
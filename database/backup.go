@@ -0,0 +1,510 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BackupVersion is the archive format written by ExportBackup. ImportBackup
+// accepts this version and older ones.
+const BackupVersion = 1
+
+// ErrTrashedCategoryName is returned by ImportBackup when a merge would
+// restore a category whose name belongs to a category in the trash.
+var ErrTrashedCategoryName = errors.New("a deleted category with this name is in the trash; restore or purge it first")
+
+// A backup archive is JSON Lines: a header record, then categories, accounts
+// (with their tags) and the optional runs, history and snapshots, then a
+// footer with per-type counts. A missing footer means the archive was cut
+// off. Account data is written decrypted so the archive can be restored under
+// a different ENCRYPTION_KEY or database engine.
+const (
+	recordHeader        = "header"
+	recordCategory      = "category"
+	recordAccount       = "account"
+	recordValidationRun = "validation_run"
+	recordAPICall       = "api_call"
+	recordSnapshot      = "snapshot"
+	recordFooter        = "footer"
+)
+
+// BackupOptions selects the optional parts of an export.
+type BackupOptions struct {
+	Runs      bool
+	History   bool
+	Snapshots bool
+}
+
+type backupRecord struct {
+	Type      string         `json:"type"`
+	Version   int            `json:"version,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	Includes  []string       `json:"includes,omitempty"`
+	Counts    map[string]int `json:"counts,omitempty"`
+	Data      interface{}    `json:"data,omitempty"`
+}
+
+// ImportResult counts what ImportBackup restored. Skipped accounts already
+// existed in their category.
+type ImportResult struct {
+	Categories       int `json:"categories"`
+	Accounts         int `json:"accounts"`
+	Skipped          int `json:"skipped"`
+	Runs             int `json:"validation_runs"`
+	History          int `json:"api_calls"`
+	Snapshots        int `json:"snapshots"`
+	TokensRevoked    int `json:"tokens_revoked"`
+	WebhooksDisabled int `json:"webhooks_disabled"`
+}
+
+// ExportBackup writes every category and account, plus the parts selected in
+// opts, to w. The trash is not exported.
+func ExportBackup(w io.Writer, opts BackupOptions) error {
+	enc := json.NewEncoder(w)
+	now := time.Now()
+	includes := []string{"categories", "accounts"}
+	if opts.Runs {
+		includes = append(includes, "validation_runs")
+	}
+	if opts.History {
+		includes = append(includes, "api_calls")
+	}
+	if opts.Snapshots {
+		includes = append(includes, "snapshots")
+	}
+	if err := enc.Encode(backupRecord{Type: recordHeader, Version: BackupVersion, CreatedAt: &now, Includes: includes}); err != nil {
+		return err
+	}
+	counts := map[string]int{}
+
+	var categories []Category
+	if err := DB.Order("id").Find(&categories).Error; err != nil {
+		return err
+	}
+	for _, cat := range categories {
+		if err := enc.Encode(backupRecord{Type: recordCategory, Data: cat}); err != nil {
+			return err
+		}
+	}
+	counts[recordCategory] = len(categories)
+
+	// FindInBatches pages by primary key, so any other order would skip rows
+	var accounts []Account
+	err := DB.Order("id").FindInBatches(&accounts, 1000, func(tx *gorm.DB, _ int) error {
+		if err := LoadTags(DB, accounts); err != nil {
+			return err
+		}
+		for _, acc := range accounts {
+			if err := enc.Encode(backupRecord{Type: recordAccount, Data: acc}); err != nil {
+				return err
+			}
+		}
+		counts[recordAccount] += len(accounts)
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// Rows of trashed categories are left out with the categories
+	active := DB.Model(&Category{}).Select("id")
+	if opts.Runs {
+		var runs []ValidationRun
+		if err := exportTable(enc, DB.Where("category_id IN (?)", active).Order("id"), &runs, recordValidationRun, func() int { return len(runs) }, func(i int) interface{} { return runs[i] }, counts); err != nil {
+			return err
+		}
+	}
+	if opts.History {
+		var calls []APICallHistory
+		if err := exportTable(enc, DB.Where("category_id IN (?)", active).Order("id"), &calls, recordAPICall, func() int { return len(calls) }, func(i int) interface{} { return calls[i] }, counts); err != nil {
+			return err
+		}
+	}
+	if opts.Snapshots {
+		var snapshots []AccountSnapshot
+		if err := exportTable(enc, DB.Where("category_id = 0 OR category_id IN (?)", active).Order("id"), &snapshots, recordSnapshot, func() int { return len(snapshots) }, func(i int) interface{} { return snapshots[i] }, counts); err != nil {
+			return err
+		}
+	}
+
+	return enc.Encode(backupRecord{Type: recordFooter, Counts: counts})
+}
+
+// exportTable streams a table in batches as records of the given type.
+func exportTable(enc *json.Encoder, query *gorm.DB, dest interface{}, recordType string, size func() int, item func(int) interface{}, counts map[string]int) error {
+	return query.FindInBatches(dest, 1000, func(tx *gorm.DB, _ int) error {
+		for i := 0; i < size(); i++ {
+			if err := enc.Encode(backupRecord{Type: recordType, Data: item(i)}); err != nil {
+				return err
+			}
+		}
+		counts[recordType] += size()
+		return nil
+	}).Error
+}
+
+// ImportBackup restores an archive written by ExportBackup in a single
+// transaction. Categories are matched by name. With replace, all categories
+// and their accounts, runs, history, snapshots and alerts are deleted first;
+// otherwise existing categories take the archived configuration and accounts
+// already present in a category are skipped. A replace keeps API token scopes
+// and webhooks pointing at the same category names; see remapCategoryReferences.
+func ImportBackup(r io.Reader, replace bool) (ImportResult, error) {
+	var result ImportResult
+	reader := bufio.NewReaderSize(r, 1<<20)
+
+	header, err := readBackupLine(reader)
+	if err != nil {
+		return result, fmt.Errorf("reading header: %w", err)
+	}
+	var hdr struct {
+		Type    string `json:"type"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(header, &hdr); err != nil || hdr.Type != recordHeader {
+		return result, errors.New("not a backup archive: missing header")
+	}
+	if hdr.Version < 1 || hdr.Version > BackupVersion {
+		return result, fmt.Errorf("unsupported backup version %d", hdr.Version)
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var oldNames map[uint]string
+		if replace {
+			var err error
+			if oldNames, err = categoryNames(tx); err != nil {
+				return err
+			}
+			if err := deleteAllData(tx); err != nil {
+				return err
+			}
+		}
+		imp := backupImporter{tx: tx, categoryIDs: map[uint]uint{}, result: &result}
+		for {
+			line, err := readBackupLine(reader)
+			if err == io.EOF {
+				return errors.New("archive is truncated: missing footer")
+			}
+			if err != nil {
+				return err
+			}
+			var rec struct {
+				Type string          `json:"type"`
+				Data json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return fmt.Errorf("invalid record: %w", err)
+			}
+			if rec.Type == recordFooter {
+				if err := imp.flushAccounts(); err != nil {
+					return err
+				}
+				if replace {
+					return remapCategoryReferences(tx, oldNames, &result)
+				}
+				return nil
+			}
+			if err := imp.add(rec.Type, rec.Data); err != nil {
+				return fmt.Errorf("%s record: %w", rec.Type, err)
+			}
+		}
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+// readBackupLine returns the next non-empty line without a size limit.
+func readBackupLine(r *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deleteAllData removes every category and the rows that belong to them,
+// including the trash.
+func deleteAllData(tx *gorm.DB) error {
+	all := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+	for _, model := range []interface{}{&AccountTag{}, &AccountHistory{}, &Account{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}, &Alert{}, &ScriptRevision{}, &Category{}} {
+		if err := all.Unscoped().Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryNames maps every category ID, trashed ones included, to its name.
+func categoryNames(tx *gorm.DB) (map[uint]string, error) {
+	var cats []Category
+	if err := tx.Unscoped().Select("id, name").Find(&cats).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(cats))
+	for _, cat := range cats {
+		names[cat.ID] = cat.Name
+	}
+	return names, nil
+}
+
+// remapCategoryReferences points API token scopes and webhooks, which a
+// replace does not delete, from the categories that existed before the
+// import to the restored categories of the same name. New IDs may reuse old
+// ones, so stale references are never left in place: a token left without
+// any of its categories is expired instead of widening to all categories,
+// and a webhook whose category was not restored is disabled.
+func remapCategoryReferences(tx *gorm.DB, oldNames map[uint]string, result *ImportResult) error {
+	newNames, err := categoryNames(tx)
+	if err != nil {
+		return err
+	}
+	newIDs := make(map[string]uint, len(newNames))
+	for id, name := range newNames {
+		newIDs[name] = id
+	}
+	remap := func(oldID uint) (uint, bool) {
+		name, ok := oldNames[oldID]
+		if !ok {
+			return 0, false
+		}
+		id, ok := newIDs[name]
+		return id, ok
+	}
+
+	var tokens []APIToken
+	if err := tx.Where("category_ids IS NOT NULL AND category_ids != ?", "").Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.AllCategories() {
+			continue
+		}
+		var ids []uint
+		for _, oldID := range t.CategoryIDList() {
+			if id, ok := remap(oldID); ok {
+				ids = append(ids, id)
+			}
+		}
+		updates := map[string]interface{}{"category_ids": JoinCategoryIDs(ids)}
+		if len(ids) == 0 {
+			// An empty scope means all categories, so keep the old one and revoke
+			updates = map[string]interface{}{"expires_at": time.Now()}
+			result.TokensRevoked++
+		}
+		if err := tx.Model(&APIToken{}).Where("id = ?", t.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	var hooks []Webhook
+	if err := tx.Select("id, category_id").Where("category_id != ?", 0).Find(&hooks).Error; err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		updates := map[string]interface{}{}
+		if id, ok := remap(h.CategoryID); ok {
+			updates["category_id"] = id
+		} else {
+			updates["enabled"] = false
+			result.WebhooksDisabled++
+		}
+		if err := tx.Model(&Webhook{}).Where("id = ?", h.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type backupImporter struct {
+	tx          *gorm.DB
+	categoryIDs map[uint]uint // archived ID -> restored ID
+	pending     []Account
+	result      *ImportResult
+}
+
+func (imp *backupImporter) categoryID(archived uint) (uint, error) {
+	id, ok := imp.categoryIDs[archived]
+	if !ok {
+		return 0, fmt.Errorf("unknown category %d", archived)
+	}
+	return id, nil
+}
+
+func (imp *backupImporter) add(recordType string, data json.RawMessage) error {
+	switch recordType {
+	case recordCategory:
+		var cat Category
+		if err := json.Unmarshal(data, &cat); err != nil {
+			return err
+		}
+		archivedID := cat.ID
+		var existing Category
+		if err := imp.tx.Unscoped().Select("id, deleted_at").Where("name = ?", cat.Name).First(&existing).Error; err == nil {
+			if existing.DeletedAt.Valid {
+				return fmt.Errorf("category %q: %w", cat.Name, ErrTrashedCategoryName)
+			}
+			cat.ID = existing.ID
+			if err := imp.tx.Save(&cat).Error; err != nil {
+				return err
+			}
+		} else {
+			cat.ID = 0
+			if err := imp.tx.Create(&cat).Error; err != nil {
+				return err
+			}
+		}
+		// Revisions are not archived; the restored script becomes the latest
+		if _, _, err := SaveScriptRevision(imp.tx, cat.ID, cat.ValidationScript, "", "restored from backup"); err != nil {
+			return err
+		}
+		imp.categoryIDs[archivedID] = cat.ID
+		imp.result.Categories++
+
+	case recordAccount:
+		var acc Account
+		if err := json.Unmarshal(data, &acc); err != nil {
+			return err
+		}
+		catID, err := imp.categoryID(acc.CategoryID)
+		if err != nil {
+			return err
+		}
+		acc.ID = 0
+		acc.CategoryID = catID
+		imp.pending = append(imp.pending, acc)
+		if len(imp.pending) >= 500 {
+			return imp.flushAccounts()
+		}
+
+	case recordValidationRun:
+		var run ValidationRun
+		if err := json.Unmarshal(data, &run); err != nil {
+			return err
+		}
+		catID, err := imp.categoryID(run.CategoryID)
+		if err != nil {
+			return err
+		}
+		run.ID, run.CategoryID = 0, catID
+		if err := imp.tx.Create(&run).Error; err != nil {
+			return err
+		}
+		imp.result.Runs++
+
+	case recordAPICall:
+		var call APICallHistory
+		if err := json.Unmarshal(data, &call); err != nil {
+			return err
+		}
+		catID, err := imp.categoryID(call.CategoryID)
+		if err != nil {
+			return err
+		}
+		call.ID, call.CategoryID = 0, catID
+		if err := imp.tx.Create(&call).Error; err != nil {
+			return err
+		}
+		imp.result.History++
+
+	case recordSnapshot:
+		var snap AccountSnapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return err
+		}
+		// Category 0 is the global summary
+		if snap.CategoryID != 0 {
+			catID, err := imp.categoryID(snap.CategoryID)
+			if err != nil {
+				return err
+			}
+			snap.CategoryID = catID
+		}
+		snap.ID = 0
+		if err := imp.tx.Create(&snap).Error; err != nil {
+			return err
+		}
+		imp.result.Snapshots++
+
+	default:
+		return errors.New("unknown record type")
+	}
+	return nil
+}
+
+// flushAccounts inserts the pending accounts, skipping data already in their
+// category, and restores their tags.
+func (imp *backupImporter) flushAccounts() error {
+	if len(imp.pending) == 0 {
+		return nil
+	}
+	type dataKey struct {
+		CategoryID uint
+		DataHash   string
+	}
+	keys := make([]dataKey, len(imp.pending))
+	catIDs := map[uint]bool{}
+	hashes := make([]string, len(imp.pending))
+	for i, acc := range imp.pending {
+		hashes[i] = HashData(acc.Data)
+		keys[i] = dataKey{acc.CategoryID, hashes[i]}
+		catIDs[acc.CategoryID] = true
+	}
+	var found []dataKey
+	if err := imp.tx.Model(&Account{}).Select("category_id, data_hash").
+		Where("category_id IN ? AND data_hash IN ?", slices.Collect(maps.Keys(catIDs)), hashes).
+		Scan(&found).Error; err != nil {
+		return err
+	}
+	existing := map[dataKey]bool{}
+	for _, k := range found {
+		existing[k] = true
+	}
+
+	var accounts []Account
+	for i, acc := range imp.pending {
+		if existing[keys[i]] {
+			imp.result.Skipped++
+			continue
+		}
+		existing[keys[i]] = true
+		accounts = append(accounts, acc)
+	}
+	imp.pending = imp.pending[:0]
+	if len(accounts) == 0 {
+		return nil
+	}
+	if err := imp.tx.CreateInBatches(&accounts, 500).Error; err != nil {
+		return err
+	}
+	imp.result.Accounts += len(accounts)
+
+	var tags []AccountTag
+	for _, acc := range accounts {
+		for _, t := range acc.Tags {
+			tags = append(tags, AccountTag{AccountID: acc.ID, Tag: t})
+		}
+	}
+	if len(tags) > 0 {
+		if err := imp.tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&tags, 500).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// seedBackupData creates a category with validation config, tagged accounts
+// and one run, history entry and snapshot.
+func seedBackupData(t *testing.T) Category {
+	t.Helper()
+	cat := Category{Name: "backup", ValidationScript: "print('ok')", ValidationCron: "0 * * * *", ValidationConcurrency: 3, MaxUses: 2}
+	if err := DB.Create(&cat).Error; err != nil {
+		t.Fatalf("failed to seed category: %v", err)
+	}
+	a := seedAccount(t, cat.ID, "user1:pass1")
+	seedAccount(t, cat.ID, "user2:pass2")
+	DB.Create(&AccountTag{AccountID: a.ID, Tag: "vip"})
+	DB.Create(&ValidationRun{CategoryID: cat.ID, Status: "success", TotalCount: 2})
+	DB.Create(&APICallHistory{CategoryID: cat.ID, Endpoint: "/api/accounts/fetch"})
+	DB.Create(&AccountSnapshot{CategoryID: cat.ID, Granularity: "1h", Available: 2})
+	return cat
+}
+
+func exportAll(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ExportBackup(&buf, BackupOptions{Runs: true, History: true, Snapshots: true}); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	return &buf
+}
+
+func TestBackup_RoundTripReplace(t *testing.T) {
+	setupTestDB(t)
+	seedBackupData(t)
+	archive := exportAll(t)
+	if !strings.Contains(archive.String(), "user1:pass1") {
+		t.Error("expected decrypted account data in archive")
+	}
+
+	// Changes made after the export are discarded by a replace
+	seedCategory(t, "extra")
+	result, err := ImportBackup(archive, true)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.Categories != 1 || result.Accounts != 2 || result.Skipped != 0 || result.Runs != 1 || result.History != 1 || result.Snapshots != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	var cats []Category
+	DB.Find(&cats)
+	if len(cats) != 1 || cats[0].ValidationScript != "print('ok')" || cats[0].ValidationConcurrency != 3 || cats[0].MaxUses != 2 {
+		t.Fatalf("unexpected categories %+v", cats)
+	}
+	var accounts []Account
+	DB.Where("category_id = ?", cats[0].ID).Order("id").Find(&accounts)
+	if err := LoadTags(DB, accounts); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Data != "user1:pass1" || len(accounts[0].Tags) != 1 || accounts[0].Tags[0] != "vip" {
+		t.Errorf("unexpected accounts %+v", accounts)
+	}
+	var runs, calls, snaps int64
+	DB.Model(&ValidationRun{}).Where("category_id = ?", cats[0].ID).Count(&runs)
+	DB.Model(&APICallHistory{}).Where("category_id = ?", cats[0].ID).Count(&calls)
+	DB.Model(&AccountSnapshot{}).Where("category_id = ?", cats[0].ID).Count(&snaps)
+	if runs != 1 || calls != 1 || snaps != 1 {
+		t.Errorf("expected restored runs, history and snapshots, got %d %d %d", runs, calls, snaps)
+	}
+}
+
+func TestBackup_InterleavedAccounts(t *testing.T) {
+	setupTestDB(t)
+	a := seedCategory(t, "a")
+	b := seedCategory(t, "b")
+	var accounts []Account
+	for i := range 1500 {
+		accounts = append(accounts,
+			Account{CategoryID: a.ID, Data: fmt.Sprintf("a%d", i)},
+			Account{CategoryID: b.ID, Data: fmt.Sprintf("b%d", i)})
+	}
+	if err := DB.CreateInBatches(&accounts, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	DB.Model(&Account{}).Count(&total)
+
+	archive := exportAll(t)
+	if n := strings.Count(archive.String(), `"type":"account"`); int64(n) != total {
+		t.Fatalf("expected %d account records, got %d", total, n)
+	}
+	if !strings.Contains(archive.String(), fmt.Sprintf(`"account":%d`, total)) {
+		t.Error("expected the footer to count every account")
+	}
+
+	result, err := ImportBackup(archive, true)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	var restored int64
+	DB.Model(&Account{}).Count(&restored)
+	if int64(result.Accounts) != total || restored != total {
+		t.Errorf("expected %d accounts restored, got %d (%+v)", total, restored, result)
+	}
+}
+
+func TestBackup_ReplaceRemapsCategoryReferences(t *testing.T) {
+	setupTestDB(t)
+	// Restored categories get different IDs than a and b have now
+	gone := seedCategory(t, "gone")
+	a := seedCategory(t, "a")
+	b := seedCategory(t, "b")
+	DB.Unscoped().Delete(&gone)
+	archive := exportAll(t)
+
+	c := seedCategory(t, "c")
+	tokens := []APIToken{
+		{Name: "b", TokenHash: "h1", Permissions: "read", CategoryIDs: JoinCategoryIDs([]uint{b.ID})},
+		{Name: "c", TokenHash: "h2", Permissions: "read", CategoryIDs: JoinCategoryIDs([]uint{c.ID})},
+		{Name: "a+c", TokenHash: "h3", Permissions: "read", CategoryIDs: JoinCategoryIDs([]uint{a.ID, c.ID})},
+		{Name: "all", TokenHash: "h4", Permissions: "read"},
+	}
+	DB.Create(&tokens)
+	hooks := []Webhook{
+		{CategoryID: b.ID, URL: "https://example.com/b", Events: "account.banned", Enabled: true},
+		{CategoryID: c.ID, URL: "https://example.com/c", Events: "account.banned", Enabled: true},
+		{URL: "https://example.com/all", Events: "account.banned", Enabled: true},
+	}
+	DB.Create(&hooks)
+
+	result, err := ImportBackup(archive, true)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.TokensRevoked != 1 || result.WebhooksDisabled != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	var newA, newB Category
+	DB.Where("name = ?", "a").First(&newA)
+	DB.Where("name = ?", "b").First(&newB)
+	if newA.ID == a.ID || newB.ID == b.ID {
+		t.Fatalf("expected new category IDs, got a=%d b=%d", newA.ID, newB.ID)
+	}
+	var gotTokens []APIToken
+	DB.Order("id").Find(&gotTokens)
+	if gotTokens[0].CategoryIDs != JoinCategoryIDs([]uint{newB.ID}) || gotTokens[0].ExpiresAt != nil {
+		t.Errorf("expected the token remapped to b, got %+v", gotTokens[0])
+	}
+	if gotTokens[1].ExpiresAt == nil {
+		t.Error("expected the token scoped to a missing category to be revoked")
+	}
+	if gotTokens[2].CategoryIDs != JoinCategoryIDs([]uint{newA.ID}) || gotTokens[2].ExpiresAt != nil {
+		t.Errorf("expected the token narrowed to a, got %+v", gotTokens[2])
+	}
+	if gotTokens[3].CategoryIDs != "" || gotTokens[3].ExpiresAt != nil {
+		t.Errorf("expected the unscoped token untouched, got %+v", gotTokens[3])
+	}
+
+	var gotHooks []Webhook
+	DB.Order("id").Find(&gotHooks)
+	if gotHooks[0].CategoryID != newB.ID || !gotHooks[0].Enabled {
+		t.Errorf("expected the webhook remapped to b, got %+v", gotHooks[0])
+	}
+	if gotHooks[1].Enabled {
+		t.Error("expected the webhook on a missing category to be disabled")
+	}
+	if gotHooks[2].CategoryID != 0 || !gotHooks[2].Enabled {
+		t.Errorf("expected the global webhook untouched, got %+v", gotHooks[2])
+	}
+}
+
+func TestBackup_MergeSkipsDuplicates(t *testing.T) {
+	setupTestDB(t)
+	cat := seedBackupData(t)
+	archive := exportAll(t)
+
+	DB.Model(&cat).Update("validation_concurrency", 9)
+	seedAccount(t, cat.ID, "user3:pass3")
+	result, err := ImportBackup(archive, false)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.Accounts != 0 || result.Skipped != 2 {
+		t.Errorf("expected both accounts skipped, got %+v", result)
+	}
+
+	var restored Category
+	DB.First(&restored, cat.ID)
+	if restored.ValidationConcurrency != 3 {
+		t.Errorf("expected archived config, got concurrency %d", restored.ValidationConcurrency)
+	}
+	var count int64
+	DB.Model(&Account{}).Where("category_id = ?", cat.ID).Count(&count)
+	if count != 3 {
+		t.Errorf("expected 3 accounts, got %d", count)
+	}
+}
+
+func TestBackup_MergeRejectsTrashedCategoryName(t *testing.T) {
+	setupTestDB(t)
+	cat := seedBackupData(t)
+	archive := exportAll(t)
+
+	DB.Delete(&cat)
+	if _, err := ImportBackup(archive, false); !errors.Is(err, ErrTrashedCategoryName) {
+		t.Fatalf("expected ErrTrashedCategoryName, got %v", err)
+	}
+	var count int64
+	DB.Unscoped().Model(&Category{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the import to roll back, got %d categories", count)
+	}
+}
+
+func TestBackup_ExportWithoutOptionalParts(t *testing.T) {
+	setupTestDB(t)
+	seedBackupData(t)
+	var buf bytes.Buffer
+	if err := ExportBackup(&buf, BackupOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{`"type":"validation_run"`, `"type":"api_call"`, `"type":"snapshot"`} {
+		if strings.Contains(buf.String(), typ) {
+			t.Errorf("did not expect %s records", typ)
+		}
+	}
+}
+
+func TestBackup_TruncatedArchiveRollsBack(t *testing.T) {
+	setupTestDB(t)
+	seedBackupData(t)
+	archive := exportAll(t).String()
+	truncated := archive[:strings.Index(archive, `{"type":"footer"`)]
+
+	if _, err := ImportBackup(strings.NewReader(truncated), true); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected truncated error, got %v", err)
+	}
+	var count int64
+	DB.Model(&Account{}).Count(&count)
+	if count != 2 {
+		t.Errorf("expected replace to roll back, got %d accounts", count)
+	}
+}
+
+func TestBackup_RejectsInvalidArchives(t *testing.T) {
+	setupTestDB(t)
+	cases := []string{
+		"",
+		`{"type":"account"}`,
+		`{"type":"header","version":99}`,
+		"{\"type\":\"header\",\"version\":1}\n{\"type\":\"account\",\"data\":{\"category_id\":5,\"data\":\"x\"}}\n{\"type\":\"footer\"}\n",
+		"{\"type\":\"header\",\"version\":1}\n{\"type\":\"unknown\"}\n{\"type\":\"footer\"}\n",
+	}
+	for _, archive := range cases {
+		if _, err := ImportBackup(strings.NewReader(archive), false); err == nil {
+			t.Errorf("expected error for %q", archive)
+		}
+	}
+}
@@ -30,6 +30,8 @@ var validDBName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 var DB *gorm.DB
 
 func InitDB() {
+	LoadEncryptionKeys()
+
 	var err error
 	dbType := os.Getenv("DB_TYPE")
 	gormConfig := &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)}
@@ -39,7 +41,9 @@ func InitDB() {
 		DB, err = gorm.Open(postgres.Open(dsn), gormConfig)
 	} else {
 		os.MkdirAll("./data", 0755)
-		DB, err = gorm.Open(sqlite.Open("./data/accounts.db"), gormConfig)
+		// Take the write lock at BEGIN and wait on it instead of failing fast
+		// with SQLITE_BUSY when a read-then-write transaction races a writer
+		DB, err = gorm.Open(sqlite.Open("./data/accounts.db?_busy_timeout=5000&_txlock=immediate"), gormConfig)
 	}
 	if err != nil {
 		logger.Error.Fatal("Failed to connect to database:", err)
@@ -53,7 +57,7 @@ func InitDB() {
 	sqlDB.SetMaxOpenConns(getEnvInt("DB_MAX_OPEN_CONNS", 100))
 	sqlDB.SetConnMaxLifetime(time.Duration(getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 60)) * time.Minute)
 
-	if err := DB.AutoMigrate(&Category{}, &Account{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}); err != nil {
+	if err := DB.AutoMigrate(&Category{}, &Account{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}, &APIToken{}, &AccountTag{}, &Webhook{}, &WebhookDelivery{}, &Alert{}, &Job{}, &AuditLog{}, &ScriptRevision{}, &AccountHistory{}); err != nil {
 		logger.Error.Fatal("Failed to migrate database:", err)
 	}
 
@@ -66,10 +70,22 @@ func InitDB() {
 	// One-time migration: copy old history_limit to new split fields
 	migrateHistoryLimit()
 
-	// Clean up stale validation runs from previous crashes/restarts
+	// Accounts created before the data_hash column existed need it for duplicate checks
+	BackfillDataHashes()
+
+	// Runs cut off by a previous crash or restart can be resumed from their
+	// cursor; runs that were being stopped are finished
+	DB.Model(&ValidationRun{}).
+		Where("status = ?", RunStatusStopping).
+		Updates(map[string]interface{}{"status": RunStatusStopped, "finished_at": time.Now()})
 	DB.Model(&ValidationRun{}).
-		Where("status IN ?", []string{"running", "stopping"}).
-		Updates(map[string]interface{}{"status": "stopped", "finished_at": time.Now()})
+		Where("status = ?", RunStatusRunning).
+		Updates(map[string]interface{}{"status": RunStatusInterrupted, "finished_at": time.Now()})
+}
+
+// IsPostgres reports whether the active connection is PostgreSQL.
+func IsPostgres() bool {
+	return DB != nil && DB.Dialector.Name() == "postgres"
 }
 
 // migrateHistoryLimit copies the old shared history_limit value into the new
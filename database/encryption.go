@@ -0,0 +1,368 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"final-account-hub/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Encrypted values look like enc:v1:<key id>:<wrapped data key>:<ciphertext>.
+// Each value is sealed with a fresh random data key, which is in turn sealed
+// with the master key from ENCRYPTION_KEY (envelope encryption). Values
+// without the prefix are legacy plaintext and are returned as-is.
+const encryptedPrefix = "enc:v1:"
+
+const hashKeyContext = "final-account-hub account data hash"
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+// keyring holds the master keys loaded at startup. current seals new values;
+// every key in byID can open existing ones.
+var keyring struct {
+	current *masterKey
+	byID    map[string]*masterKey
+	hashKey []byte
+}
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+	schema.RegisterSerializer("encryptedjson", EncryptedJSONSerializer{})
+}
+
+func parseMasterKey(encoded string) (*masterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes, base64-encoded")
+	}
+	sum := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), key: key}, nil
+}
+
+// SetEncryptionKeys installs the master key used for new values and any
+// previous keys still needed to decrypt existing rows. An empty current key
+// disables encryption; stored ciphertext can then no longer be read unless
+// the old key is listed in previous.
+func SetEncryptionKeys(current string, previous ...string) error {
+	byID := make(map[string]*masterKey)
+	var cur *masterKey
+	if current != "" {
+		k, err := parseMasterKey(current)
+		if err != nil {
+			return fmt.Errorf("ENCRYPTION_KEY: %w", err)
+		}
+		cur = k
+		byID[k.id] = k
+	}
+	for _, p := range previous {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		k, err := parseMasterKey(p)
+		if err != nil {
+			return fmt.Errorf("ENCRYPTION_PREVIOUS_KEYS: %w", err)
+		}
+		if _, ok := byID[k.id]; !ok {
+			byID[k.id] = k
+		}
+	}
+
+	keyring.current = cur
+	keyring.byID = byID
+	keyring.hashKey = nil
+	if cur != nil {
+		mac := hmac.New(sha256.New, cur.key)
+		mac.Write([]byte(hashKeyContext))
+		keyring.hashKey = mac.Sum(nil)
+	}
+	return nil
+}
+
+// LoadEncryptionKeys reads ENCRYPTION_KEY and ENCRYPTION_PREVIOUS_KEYS
+// (comma-separated) from the environment.
+func LoadEncryptionKeys() {
+	err := SetEncryptionKeys(os.Getenv("ENCRYPTION_KEY"), strings.Split(os.Getenv("ENCRYPTION_PREVIOUS_KEYS"), ",")...)
+	if err != nil {
+		logger.Error.Fatal("Invalid encryption configuration: ", err)
+	}
+	if keyring.current != nil {
+		logger.Info.Printf("Encryption at rest enabled (key %s)", keyring.current.id)
+	}
+}
+
+// EncryptionEnabled reports whether new values are written encrypted.
+func EncryptionEnabled() bool {
+	return keyring.current != nil
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func unseal(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// EncryptData seals a value with the current master key. Without a key the
+// value is returned unchanged.
+func EncryptData(plaintext string) (string, error) {
+	if keyring.current == nil {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(keyring.current.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return encryptedPrefix + keyring.current.id + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ciphertext), nil
+}
+
+// DecryptData opens a value produced by EncryptData. Plaintext values pass
+// through unchanged.
+func DecryptData(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(stored, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	k, ok := keyring.byID[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("value was encrypted with unknown key %s", parts[0])
+	}
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	ciphertext, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	dataKey, err := unseal(k.key, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := unseal(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// HashData returns the deterministic keyed hash stored in Account.DataHash.
+// Duplicate checks compare hashes because ciphertexts of equal data differ.
+func HashData(data string) string {
+	mac := hmac.New(sha256.New, keyring.hashKey)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func scanString(dbValue interface{}) (string, bool) {
+	switch v := dbValue.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// EncryptedSerializer transparently encrypts string columns tagged with
+// serializer:encrypted.
+type EncryptedSerializer struct{}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	s, ok := scanString(dbValue)
+	if !ok {
+		return field.Set(ctx, dst, "")
+	}
+	plaintext, err := DecryptData(s)
+	if err != nil {
+		return err
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	s, _ := fieldValue.(string)
+	return EncryptData(s)
+}
+
+// EncryptedJSONSerializer is the JSON serializer with the encoded document
+// encrypted like EncryptedSerializer. nil values are stored as NULL.
+type EncryptedJSONSerializer struct{}
+
+func (EncryptedJSONSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+	if s, ok := scanString(dbValue); ok && s != "" {
+		plaintext, err := DecryptData(s)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(plaintext), fieldValue.Interface()); err != nil {
+			return err
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (EncryptedJSONSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	b, err := json.Marshal(fieldValue)
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+	return EncryptData(string(b))
+}
+
+// BackfillDataHashes fills DataHash for accounts stored before the column
+// existed, including trashed ones. Called from InitDB.
+func BackfillDataHashes() {
+	var batch []Account
+	var filled int
+	err := DB.Unscoped().Select("id, data").Where("data_hash IS NULL OR data_hash = ''").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, acc := range batch {
+				if err := DB.Unscoped().Model(&Account{}).Where("id = ?", acc.ID).
+					UpdateColumn("data_hash", HashData(acc.Data)).Error; err != nil {
+					return err
+				}
+				filled++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		logger.Error.Printf("Failed to backfill account data hashes: %v", err)
+		return
+	}
+	if filled > 0 {
+		logger.Info.Printf("Backfilled data hashes for %d accounts", filled)
+	}
+}
+
+// RotateEncryptionKey re-encrypts every account, trashed ones included, and
+// every webhook secret with the current key and recomputes account data
+// hashes. Rows may be stored under any configured key or in plaintext; with
+// no current key, everything is written back as plaintext. It returns the
+// number of accounts rotated.
+func RotateEncryptionKey() (int, error) {
+	var batch []Account
+	var rotated int
+	err := DB.Unscoped().Select("id, data, fields").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, acc := range batch {
+			updates, err := encodeAccountData(acc.Data, acc.Fields)
+			if err != nil {
+				return err
+			}
+			if err := DB.Unscoped().Model(&Account{}).Where("id = ?", acc.ID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return rotated, err
+	}
+	return rotated, rotateWebhookSecrets()
+}
+
+// rotateWebhookSecrets re-encrypts webhook signing secrets, which share the
+// account keyring.
+func rotateWebhookSecrets() error {
+	var hooks []Webhook
+	if err := DB.Select("id, secret").Find(&hooks).Error; err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		encrypted, err := EncryptData(h.Secret)
+		if err != nil {
+			return err
+		}
+		if err := DB.Model(&Webhook{}).Where("id = ?", h.ID).UpdateColumn("secret", encrypted).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeAccountData builds the column values for an account's data and
+// parsed fields, for map-based updates that bypass the serializers.
+func encodeAccountData(data string, fields map[string]interface{}) (map[string]interface{}, error) {
+	encrypted, err := EncryptData(data)
+	if err != nil {
+		return nil, err
+	}
+	encodedFields, err := EncodeFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"data": encrypted, "data_hash": HashData(data), "fields": encodedFields}, nil
+}
+
+// AccountDataUpdates returns the column updates that replace an account's
+// data, re-parsing its fields with the category schema.
+func AccountDataUpdates(cat *Category, data string) (map[string]interface{}, error) {
+	fields, err := cat.ParseFields(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeAccountData(data, fields)
+}
+
+// BeforeSave keeps DataHash in sync for struct-based creates and saves.
+func (a *Account) BeforeSave(tx *gorm.DB) error {
+	a.DataHash = HashData(a.Data)
+	return nil
+}
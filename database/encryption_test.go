@@ -0,0 +1,173 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// useKeys installs encryption keys for the duration of the test.
+func useKeys(t *testing.T, current string, previous ...string) {
+	t.Helper()
+	if err := SetEncryptionKeys(current, previous...); err != nil {
+		t.Fatalf("SetEncryptionKeys failed: %v", err)
+	}
+	t.Cleanup(func() { SetEncryptionKeys("") })
+}
+
+func TestEncryptData_RoundTrip(t *testing.T) {
+	useKeys(t, newTestKey(t))
+
+	a, err := EncryptData("user:pass")
+	if err != nil {
+		t.Fatalf("EncryptData failed: %v", err)
+	}
+	b, _ := EncryptData("user:pass")
+	if !strings.HasPrefix(a, encryptedPrefix) || a == b {
+		t.Fatalf("expected distinct ciphertexts with prefix, got %q and %q", a, b)
+	}
+	if strings.Contains(a, "user:pass") {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+	plain, err := DecryptData(a)
+	if err != nil || plain != "user:pass" {
+		t.Errorf("expected round trip, got %q (%v)", plain, err)
+	}
+
+	if plain, err := DecryptData("legacy:plaintext"); err != nil || plain != "legacy:plaintext" {
+		t.Errorf("expected plaintext passthrough, got %q (%v)", plain, err)
+	}
+}
+
+func TestDecryptData_UnknownKey(t *testing.T) {
+	useKeys(t, newTestKey(t))
+	sealed, _ := EncryptData("secret")
+
+	useKeys(t, newTestKey(t))
+	if _, err := DecryptData(sealed); err == nil {
+		t.Error("expected error for value sealed with an unknown key")
+	}
+}
+
+func TestSetEncryptionKeys_Invalid(t *testing.T) {
+	t.Cleanup(func() { SetEncryptionKeys("") })
+	if err := SetEncryptionKeys("too-short"); err == nil {
+		t.Error("expected error for invalid key")
+	}
+	if err := SetEncryptionKeys(newTestKey(t), "bad"); err == nil {
+		t.Error("expected error for invalid previous key")
+	}
+}
+
+func TestHashData_Keyed(t *testing.T) {
+	plainHash := HashData("a")
+	useKeys(t, newTestKey(t))
+	if HashData("a") != HashData("a") {
+		t.Error("expected deterministic hash")
+	}
+	if HashData("a") == plainHash || HashData("a") == HashData("b") {
+		t.Error("expected hash to depend on key and data")
+	}
+}
+
+func TestAccount_EncryptedAtRest(t *testing.T) {
+	setupTestDB(t)
+	useKeys(t, newTestKey(t))
+
+	cat := Category{Name: "enc"}
+	DB.Create(&cat)
+	acc := Account{CategoryID: cat.ID, Data: "alice:secret", Fields: map[string]interface{}{"user": "alice"}}
+	if err := DB.Create(&acc).Error; err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	var raw struct {
+		Data     string
+		DataHash string
+		Fields   string
+	}
+	DB.Table("accounts").Select("data, data_hash, fields").Where("id = ?", acc.ID).Scan(&raw)
+	if strings.Contains(raw.Data, "secret") || strings.Contains(raw.Fields, "alice") {
+		t.Errorf("expected ciphertext at rest, got data=%q fields=%q", raw.Data, raw.Fields)
+	}
+	if raw.DataHash != HashData("alice:secret") {
+		t.Errorf("expected data_hash to be set on create")
+	}
+
+	var got Account
+	DB.First(&got, acc.ID)
+	if got.Data != "alice:secret" || got.Fields["user"] != "alice" {
+		t.Errorf("expected transparent decryption, got data=%q fields=%v", got.Data, got.Fields)
+	}
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	setupTestDB(t)
+
+	cat := Category{Name: "rotate"}
+	DB.Create(&cat)
+	DB.Create(&Account{CategoryID: cat.ID, Data: "plain-row"})
+
+	oldKey := newTestKey(t)
+	useKeys(t, oldKey)
+	DB.Create(&Account{CategoryID: cat.ID, Data: "old-key-row"})
+	trashed := Account{CategoryID: cat.ID, Data: "trashed-row"}
+	DB.Create(&trashed)
+	DB.Delete(&trashed)
+
+	newKey := newTestKey(t)
+	useKeys(t, newKey, oldKey)
+	n, err := RotateEncryptionKey()
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 rotated rows, got %d (%v)", n, err)
+	}
+
+	// Only the new key is needed afterwards
+	useKeys(t, newKey)
+	var accounts []Account
+	if err := DB.Order("id").Find(&accounts).Error; err != nil {
+		t.Fatalf("reading with new key failed: %v", err)
+	}
+	if accounts[0].Data != "plain-row" || accounts[1].Data != "old-key-row" {
+		t.Errorf("unexpected data after rotation: %q, %q", accounts[0].Data, accounts[1].Data)
+	}
+	var hashes []string
+	DB.Model(&Account{}).Order("id").Pluck("data_hash", &hashes)
+	if hashes[0] != HashData("plain-row") || hashes[1] != HashData("old-key-row") {
+		t.Error("expected hashes recomputed with the new key")
+	}
+
+	// Trashed accounts stay restorable
+	var restored Account
+	if err := DB.Unscoped().First(&restored, trashed.ID).Error; err != nil || restored.Data != "trashed-row" {
+		t.Errorf("expected the trashed account rotated too, got %q (%v)", restored.Data, err)
+	}
+}
+
+func TestBackfillDataHashes(t *testing.T) {
+	setupTestDB(t)
+
+	cat := Category{Name: "backfill"}
+	DB.Create(&cat)
+	DB.Exec("INSERT INTO accounts (category_id, data) VALUES (?, ?)", cat.ID, "legacy")
+	DB.Exec("INSERT INTO accounts (category_id, data, deleted_at) VALUES (?, ?, ?)", cat.ID, "trashed", time.Now())
+
+	BackfillDataHashes()
+
+	var hashes []string
+	DB.Unscoped().Model(&Account{}).Where("category_id = ?", cat.ID).Order("id").Pluck("data_hash", &hashes)
+	if len(hashes) != 2 || hashes[0] != HashData("legacy") || hashes[1] != HashData("trashed") {
+		t.Errorf("expected backfilled hashes, got %q", hashes)
+	}
+}
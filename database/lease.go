@@ -0,0 +1,50 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"final-account-hub/logger"
+
+	"gorm.io/gorm"
+)
+
+// MaxLeaseSeconds caps how long a single lease (or renewal) may last.
+const MaxLeaseSeconds = 24 * 60 * 60
+
+// NewLeaseID returns a random identifier shared by all accounts checked out
+// in one lease-mode fetch.
+func NewLeaseID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ReleaseExpiredLeases returns accounts whose lease deadline has passed to the
+// available pool. Called periodically by the validator scheduler.
+func ReleaseExpiredLeases() int64 {
+	var released int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var ids []uint
+		if err := tx.Model(&Account{}).Where("lease_id IS NOT NULL AND lease_expires_at < ?", now).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		var err error
+		released, err = UpdateTrackedAccounts(tx, ids,
+			map[string]interface{}{"used": false, "lease_id": nil, "lease_expires_at": nil},
+			HistorySource{Source: HistorySourceSystem}, "lease_id IS NOT NULL AND lease_expires_at < ?", now)
+		return err
+	})
+	if err != nil {
+		logger.Error.Printf("Failed to release expired leases: %v", err)
+		return 0
+	}
+	if released > 0 {
+		logger.Info.Printf("Released %d accounts with expired leases", released)
+	}
+	return released
+}
@@ -1,33 +1,96 @@
 package database
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Category struct {
-	ID                    uint       `gorm:"primaryKey" json:"id"`
-	Name                  string     `gorm:"size:255;unique;not null" json:"name"`
-	ValidationScript      string     `gorm:"type:text" json:"validation_script"`
-	ValidationConcurrency int        `gorm:"default:1" json:"validation_concurrency"`
-	ValidationCron        string     `gorm:"size:50;default:'0 0 * * *'" json:"validation_cron"`
-	ValidationHistoryLimit int        `gorm:"default:50" json:"validation_history_limit"`
-	ApiHistoryLimit        int        `gorm:"default:1000" json:"api_history_limit"`
-	ValidationEnabled     bool       `gorm:"default:false" json:"validation_enabled"`
-	ValidationScope       string     `gorm:"size:50;default:'available,used'" json:"validation_scope"`
-	LastValidatedAt       *time.Time `gorm:"index" json:"last_validated_at"`
-	CreatedAt             time.Time  `gorm:"index" json:"created_at"`
-	UpdatedAt             time.Time  `json:"updated_at"`
+	ID                     uint           `gorm:"primaryKey" json:"id"`
+	Name                   string         `gorm:"size:255;unique;not null" json:"name"`
+	ValidationScript       string         `gorm:"type:text" json:"validation_script"`
+	ScriptRevision         int            `gorm:"default:0" json:"script_revision"`
+	ValidationConcurrency  int            `gorm:"default:1" json:"validation_concurrency"`
+	ValidationCron         string         `gorm:"size:50;default:'0 0 * * *'" json:"validation_cron"`
+	ValidationHistoryLimit int            `gorm:"default:50" json:"validation_history_limit"`
+	ApiHistoryLimit        int            `gorm:"default:1000" json:"api_history_limit"`
+	ValidationEnabled      bool           `gorm:"default:false" json:"validation_enabled"`
+	ValidationScope        string         `gorm:"size:50;default:'available,used'" json:"validation_scope"`
+	ValidationMode         string         `gorm:"size:10;default:'batch'" json:"validation_mode"`
+	ValidationAsyncLimit   int            `gorm:"default:10" json:"validation_async_limit"`
+	ValidationBatchSize    int            `gorm:"default:50" json:"validation_batch_size"`
+	AccountTimeoutSeconds  int            `gorm:"default:60" json:"account_timeout_seconds"`
+	BatchTimeoutSeconds    int            `gorm:"default:0" json:"batch_timeout_seconds"`
+	RunDeadlineMinutes     int            `gorm:"default:0" json:"run_deadline_minutes"`
+	MaxUses                int            `gorm:"default:1" json:"max_uses"`
+	CooldownSeconds        int            `gorm:"default:0" json:"cooldown_seconds"`
+	AccountSchema          *AccountSchema `gorm:"type:text;serializer:json" json:"account_schema"`
+	LowWatermark           int            `gorm:"default:0" json:"low_watermark"`
+	AlertState             string         `gorm:"size:10;default:'ok'" json:"alert_state"`
+	LastValidatedAt        *time.Time     `gorm:"index" json:"last_validated_at"`
+	TrashRetentionDays     int            `gorm:"default:30" json:"trash_retention_days"`
+	CreatedAt              time.Time      `gorm:"index" json:"created_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	DeletedAt              gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// Account is a single pooled credential. UseCount counts fetches against the
+// category's MaxUses; the account is marked used once the limit is reached.
+// LeaseID and LeaseExpiresAt are set while the account is checked out by a
+// lease-mode fetch; leased accounts stay marked used until released,
+// consumed, or returned by the expiry sweeper. CooldownUntil is set when an
+// exhausted account is resting; once it passes the account counts as
+// available again and the cooldown sweeper resets it. Fields holds Data
+// parsed by the category's AccountSchema, if one is configured. Data and
+// Fields are encrypted at rest when ENCRYPTION_KEY is set; DataHash is a keyed
+// hash of Data used for duplicate checks. Tags is not a column; handlers fill
+// it from AccountTag rows with LoadTags. Deleted accounts stay in the trash,
+// hidden from queries, until PurgeTrash removes them.
 type Account struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	CategoryID uint      `gorm:"not null;index:idx_account_category_status,priority:1" json:"category_id"`
-	Category   Category  `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE" json:"-"`
-	Used       bool      `gorm:"default:false;index:idx_account_category_status,priority:2" json:"used"`
-	Banned     bool      `gorm:"default:false;index:idx_account_category_status,priority:3" json:"banned"`
-	Data       string    `gorm:"type:text" json:"data"`
-	CreatedAt  time.Time `gorm:"index" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"index" json:"updated_at"`
+	ID             uint                   `gorm:"primaryKey" json:"id"`
+	CategoryID     uint                   `gorm:"not null;index:idx_account_category_status,priority:1;index:idx_account_category_hash,priority:1" json:"category_id"`
+	Category       Category               `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE" json:"-"`
+	Used           bool                   `gorm:"default:false;index:idx_account_category_status,priority:2" json:"used"`
+	Banned         bool                   `gorm:"default:false;index:idx_account_category_status,priority:3" json:"banned"`
+	Data           string                 `gorm:"type:text;serializer:encrypted" json:"data"`
+	DataHash       string                 `gorm:"size:64;index:idx_account_category_hash,priority:2" json:"-"`
+	Fields         map[string]interface{} `gorm:"type:text;serializer:encryptedjson" json:"fields,omitempty"`
+	UseCount       int                    `gorm:"default:0" json:"use_count"`
+	LastUsedAt     *time.Time             `gorm:"index" json:"last_used_at"`
+	LeaseID        *string                `gorm:"size:64;index" json:"lease_id,omitempty"`
+	LeaseExpiresAt *time.Time             `gorm:"index" json:"lease_expires_at,omitempty"`
+	CooldownUntil  *time.Time             `gorm:"index" json:"cooldown_until,omitempty"`
+	Tags           []string               `gorm:"-" json:"tags,omitempty"`
+	CreatedAt      time.Time              `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time              `gorm:"index" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt         `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// Validation modes. Batch mode starts a Python process per batch of
+// accounts; pool mode keeps ValidationConcurrency processes running for the
+// whole run, each loading the script once.
+const (
+	ValidationModeBatch = "batch"
+	ValidationModePool  = "pool"
+)
+
+// Validation run statuses. A run starts running and ends success, or
+// stopped after passing through stopping when a user stops it. A run cut off
+// by a restart is marked interrupted at boot; resuming an interrupted or
+// stopped run sets it running again.
+const (
+	RunStatusRunning     = "running"
+	RunStatusStopping    = "stopping"
+	RunStatusStopped     = "stopped"
+	RunStatusInterrupted = "interrupted"
+	RunStatusSuccess     = "success"
+)
+
+// ValidationRun is one validation pass over a category. The run covers the
+// accounts in scope with IDs up to LastAccountID, taken in ID order; Cursor
+// is the highest account ID below which every batch has been processed, so
+// a resumed run continues after it.
 type ValidationRun struct {
 	ID             uint       `gorm:"primaryKey" json:"id"`
 	CategoryID     uint       `gorm:"not null;index:idx_validation_category_status" json:"category_id"`
@@ -37,6 +100,10 @@ type ValidationRun struct {
 	ProcessedCount int        `json:"processed_count"`
 	UsedCount      int        `json:"used_count"`
 	BannedCount    int        `json:"banned_count"`
+	ScriptRevision int        `json:"script_revision"`
+	Cursor         uint       `gorm:"default:0" json:"cursor"`
+	LastAccountID  uint       `gorm:"default:0" json:"last_account_id"`
+	ResumeCount    int        `gorm:"default:0" json:"resume_count"`
 	ErrorMessage   string     `gorm:"type:text" json:"error_message"`
 	Log            string     `gorm:"type:text" json:"log"`
 	StartedAt      time.Time  `gorm:"index" json:"started_at"`
@@ -68,6 +135,145 @@ type AccountSnapshot struct {
 	RecordedAt  time.Time `gorm:"not null;index:idx_snapshot_cat_gran_time,priority:3" json:"recorded_at"`
 }
 
+// AccountTag attaches a free-form label (e.g. a region or tier) to an account.
+type AccountTag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	AccountID uint      `gorm:"not null;uniqueIndex:idx_account_tag,priority:1" json:"account_id"`
+	Account   Account   `gorm:"foreignKey:AccountID;constraint:OnDelete:CASCADE" json:"-"`
+	Tag       string    `gorm:"size:100;not null;uniqueIndex:idx_account_tag,priority:2;index" json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIToken is a scoped credential accepted in place of the master PASSKEY.
+// Only the SHA-256 hash of the token is stored; the plaintext is shown once at
+// creation. Permissions is a comma-separated subset of "fetch,read,write,admin"
+// and CategoryIDs a comma-separated list of category IDs (empty = all categories).
+type APIToken struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Name        string     `gorm:"size:255;not null" json:"name"`
+	TokenHash   string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Prefix      string     `gorm:"size:16" json:"prefix"`
+	Permissions string     `gorm:"size:100;not null" json:"permissions"`
+	CategoryIDs string     `gorm:"type:text" json:"category_ids"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Webhook is an outbound subscription to pool and validation events.
+// CategoryID 0 receives events from every category. Events is a
+// comma-separated list of event types. Secret signs each payload and is
+// encrypted at rest like account data. pool.low_watermark follows the
+// category's stock alert, so its threshold is the category's LowWatermark.
+type Webhook struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CategoryID uint      `gorm:"not null;index" json:"category_id"`
+	URL        string    `gorm:"size:2048;not null" json:"url"`
+	Secret     string    `gorm:"type:text;serializer:encrypted" json:"-"`
+	Events     string    `gorm:"size:255;not null" json:"events"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one attempt log entry for sending an event to a webhook.
+// Status is "pending" until the endpoint answers 2xx ("success") or the
+// retries are exhausted ("failed"). Payload is the exact signed body.
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	WebhookID     uint       `gorm:"not null;index:idx_delivery_webhook_time,priority:1" json:"webhook_id"`
+	Webhook       Webhook    `gorm:"foreignKey:WebhookID;constraint:OnDelete:CASCADE" json:"-"`
+	Event         string     `gorm:"size:64;not null" json:"event"`
+	Payload       string     `gorm:"type:text" json:"payload"`
+	Status        string     `gorm:"size:20;not null;index:idx_delivery_status_next,priority:1" json:"status"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	Error         string     `gorm:"type:text" json:"error"`
+	NextAttemptAt *time.Time `gorm:"index:idx_delivery_status_next,priority:2" json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `gorm:"index:idx_delivery_webhook_time,priority:2" json:"created_at"`
+}
+
+// Alert records a change of a category's stock alert state. States are
+// "ok", "low" (fewer than LowWatermark available accounts) and "empty" (none
+// available); Available is the count that triggered the change.
+type Alert struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CategoryID   uint      `gorm:"not null;index:idx_alert_category_time,priority:1" json:"category_id"`
+	Category     Category  `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE" json:"-"`
+	FromState    string    `gorm:"size:10;not null" json:"from_state"`
+	State        string    `gorm:"size:10;not null;index" json:"state"`
+	Available    int64     `json:"available"`
+	LowWatermark int       `json:"low_watermark"`
+	CreatedAt    time.Time `gorm:"index:idx_alert_category_time,priority:2" json:"created_at"`
+}
+
+// ScriptRevision is a saved version of a category's validation script.
+// Revision numbers count up per category. Author is "passkey" or the name of
+// the API token used, and empty for scripts saved before revisions were kept.
+type ScriptRevision struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CategoryID uint      `gorm:"not null;uniqueIndex:idx_script_revision,priority:1" json:"category_id"`
+	Revision   int       `gorm:"not null;uniqueIndex:idx_script_revision,priority:2" json:"revision"`
+	Script     string    `gorm:"type:text" json:"script"`
+	Author     string    `gorm:"size:255" json:"author"`
+	Message    string    `gorm:"size:255" json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditLog records an administrative action. Actor is "passkey" for the
+// master PASSKEY or the name of the API token used, with TokenID 0 for the
+// passkey. Before and After hold the changed values, if any.
+type AuditLog struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	CategoryID uint                   `gorm:"index:idx_audit_category_time,priority:1" json:"category_id"`
+	TokenID    uint                   `gorm:"index" json:"token_id"`
+	Actor      string                 `gorm:"size:255;index" json:"actor"`
+	IP         string                 `gorm:"size:45" json:"ip"`
+	Action     string                 `gorm:"size:50;not null;index" json:"action"`
+	Target     string                 `gorm:"size:255" json:"target"`
+	Before     map[string]interface{} `gorm:"type:text;serializer:json" json:"before"`
+	After      map[string]interface{} `gorm:"type:text;serializer:json" json:"after"`
+	CreatedAt  time.Time              `gorm:"index;index:idx_audit_category_time,priority:2" json:"created_at"`
+}
+
+// AccountHistory records a change to an account's status or data. Source
+// names what made the change; RunID is set for validation runs and Actor for
+// changes made through the API. Before and After hold the changed values; a
+// data change is recorded as data_changed without the data itself.
+type AccountHistory struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	AccountID  uint                   `gorm:"not null;index:idx_account_history_account,priority:1" json:"account_id"`
+	CategoryID uint                   `gorm:"index" json:"category_id"`
+	Source     string                 `gorm:"size:20;not null" json:"source"`
+	RunID      *uint                  `gorm:"index" json:"run_id"`
+	Actor      string                 `gorm:"size:255" json:"actor,omitempty"`
+	Before     map[string]interface{} `gorm:"type:text;serializer:json" json:"before"`
+	After      map[string]interface{} `gorm:"type:text;serializer:json" json:"after"`
+	CreatedAt  time.Time              `gorm:"index;index:idx_account_history_account,priority:2" json:"created_at"`
+}
+
+// Job is a long-running operation executed by the background worker pool.
+// Status moves from "pending" to "running" and ends as "success", "failed"
+// or "canceled". Params and Result are JSON; Log keeps the tail of the job's
+// output. CategoryID is 0 for jobs not tied to a category.
+type Job struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Type       string     `gorm:"size:50;not null;index" json:"type"`
+	CategoryID uint       `gorm:"not null;index" json:"category_id"`
+	Status     string     `gorm:"size:20;not null;index" json:"status"`
+	Params     string     `gorm:"type:text" json:"-"`
+	Progress   int64      `json:"progress"`
+	Total      int64      `json:"total"`
+	Log        string     `gorm:"type:text" json:"log"`
+	Result     string     `gorm:"type:text" json:"-"`
+	Error      string     `gorm:"type:text" json:"error"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
 func CleanupValidationRuns(categoryID uint, limit int) error {
 	if limit <= 0 {
 		limit = 50
@@ -79,9 +285,9 @@ func CleanupValidationRuns(categoryID uint, limit int) error {
 	if err != nil {
 		return nil // Not enough records to cleanup
 	}
-	// Delete all records older than cutoff, excluding running ones
-	return DB.Where("category_id = ? AND status != ? AND (started_at < ? OR (started_at = ? AND id < ?))",
-		categoryID, "running", cutoffRun.StartedAt, cutoffRun.StartedAt, cutoffRun.ID).
+	// Delete all records older than cutoff, excluding running and resumable ones
+	return DB.Where("category_id = ? AND status NOT IN ? AND (started_at < ? OR (started_at = ? AND id < ?))",
+		categoryID, []string{RunStatusRunning, RunStatusInterrupted}, cutoffRun.StartedAt, cutoffRun.StartedAt, cutoffRun.ID).
 		Delete(&ValidationRun{}).Error
 }
 
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AccountField is one named, typed value extracted from Account.Data.
+// Type is one of "string", "int", "float" or "bool".
+type AccountField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// AccountSchema describes how Account.Data is split into structured fields.
+// Format "delimited" splits on Delimiter (the last field keeps any remaining
+// delimiters); format "json" reads the fields from a JSON object.
+type AccountSchema struct {
+	Format    string         `json:"format"`
+	Delimiter string         `json:"delimiter,omitempty"`
+	Fields    []AccountField `json:"fields"`
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the schema definition and fills in the default delimiter.
+func (s *AccountSchema) Validate() error {
+	switch s.Format {
+	case "delimited":
+		if s.Delimiter == "" {
+			s.Delimiter = ":"
+		}
+	case "json":
+		s.Delimiter = ""
+	default:
+		return fmt.Errorf("format must be 'delimited' or 'json'")
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("fields must not be empty")
+	}
+	seen := make(map[string]bool)
+	for i, f := range s.Fields {
+		if !fieldNamePattern.MatchString(f.Name) {
+			return fmt.Errorf("invalid field name '%s'", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate field name '%s'", f.Name)
+		}
+		seen[f.Name] = true
+		if f.Type == "" {
+			s.Fields[i].Type = "string"
+		} else if f.Type != "string" && f.Type != "int" && f.Type != "float" && f.Type != "bool" {
+			return fmt.Errorf("invalid type '%s' for field '%s', must be one of: string, int, float, bool", f.Type, f.Name)
+		}
+	}
+	return nil
+}
+
+// Field looks up a field definition by name.
+func (s *AccountSchema) Field(name string) (AccountField, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return AccountField{}, false
+}
+
+// Parse extracts the structured fields from a raw Data string.
+func (s *AccountSchema) Parse(data string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(s.Fields))
+	if s.Format == "json" {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &obj); err != nil {
+			return nil, fmt.Errorf("data is not a JSON object")
+		}
+		for _, f := range s.Fields {
+			raw, ok := obj[f.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing field '%s'", f.Name)
+			}
+			v, err := CoerceFieldValue(f, raw)
+			if err != nil {
+				return nil, err
+			}
+			fields[f.Name] = v
+		}
+		return fields, nil
+	}
+
+	parts := strings.SplitN(data, s.Delimiter, len(s.Fields))
+	if len(parts) != len(s.Fields) {
+		return nil, fmt.Errorf("expected %d fields separated by '%s', got %d", len(s.Fields), s.Delimiter, len(parts))
+	}
+	for i, f := range s.Fields {
+		v, err := CoerceFieldValue(f, parts[i])
+		if err != nil {
+			return nil, err
+		}
+		fields[f.Name] = v
+	}
+	return fields, nil
+}
+
+// CoerceFieldValue converts a raw value (a string from delimited data or a
+// decoded JSON value) to the field's declared type.
+func CoerceFieldValue(f AccountField, raw interface{}) (interface{}, error) {
+	if s, ok := raw.(string); ok && f.Type != "string" {
+		s = strings.TrimSpace(s)
+		switch f.Type {
+		case "int":
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n, nil
+			}
+		case "float":
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return n, nil
+			}
+		case "bool":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("field '%s' must be of type %s", f.Name, f.Type)
+	}
+
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case float64:
+		if f.Type == "float" {
+			return v, nil
+		}
+		if f.Type == "int" && v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case bool:
+		if f.Type == "bool" {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("field '%s' must be of type %s", f.Name, f.Type)
+}
+
+// ParseFields extracts structured fields from data using the category's
+// schema. It returns nil without error when the category has no schema.
+func (c *Category) ParseFields(data string) (map[string]interface{}, error) {
+	if c.AccountSchema == nil {
+		return nil, nil
+	}
+	return c.AccountSchema.Parse(data)
+}
+
+// EncodeFields renders parsed fields for map-based updates, which bypass the
+// column's serializer. nil clears the column.
+func EncodeFields(fields map[string]interface{}) (interface{}, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptData(string(b))
+}
@@ -0,0 +1,73 @@
+package database
+
+import "testing"
+
+func TestAccountSchema_ParseDelimited(t *testing.T) {
+	s := &AccountSchema{Format: "delimited", Fields: []AccountField{{Name: "user"}, {Name: "pass"}}}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if s.Delimiter != ":" || s.Fields[0].Type != "string" {
+		t.Fatalf("expected defaults to be filled in, got %+v", s)
+	}
+
+	fields, err := s.Parse("alice:p:ss")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if fields["user"] != "alice" || fields["pass"] != "p:ss" {
+		t.Errorf("expected last field to keep delimiters, got %v", fields)
+	}
+
+	if _, err := s.Parse("alice"); err == nil {
+		t.Error("expected error for missing fields")
+	}
+}
+
+func TestAccountSchema_ParseJSON(t *testing.T) {
+	s := &AccountSchema{Format: "json", Fields: []AccountField{
+		{Name: "email", Type: "string"}, {Name: "credits", Type: "int"}, {Name: "ratio", Type: "float"}, {Name: "vip", Type: "bool"},
+	}}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	fields, err := s.Parse(`{"email": "a@x.io", "credits": 5, "ratio": 0.5, "vip": false, "extra": 1}`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if fields["credits"] != int64(5) || fields["ratio"] != 0.5 || fields["vip"] != false {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	if _, ok := fields["extra"]; ok {
+		t.Error("expected undeclared keys to be dropped")
+	}
+
+	for _, data := range []string{`not json`, `{"email": "a"}`, `{"email": "a", "credits": 1.5, "ratio": 1, "vip": true}`} {
+		if _, err := s.Parse(data); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestCoerceFieldValue_Strings(t *testing.T) {
+	cases := []struct {
+		typ  string
+		raw  string
+		want interface{}
+	}{
+		{"int", " 42 ", int64(42)},
+		{"float", "1.25", 1.25},
+		{"bool", "true", true},
+		{"string", " keep ", " keep "},
+	}
+	for _, tc := range cases {
+		got, err := CoerceFieldValue(AccountField{Name: "f", Type: tc.typ}, tc.raw)
+		if err != nil || got != tc.want {
+			t.Errorf("%s %q: got %v (%v), want %v", tc.typ, tc.raw, got, err, tc.want)
+		}
+	}
+	if _, err := CoerceFieldValue(AccountField{Name: "f", Type: "int"}, "abc"); err == nil {
+		t.Error("expected error for non-numeric int")
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import "gorm.io/gorm"
+
+// SaveScriptRevision records script as the category's next revision unless
+// it matches the latest one, and points the category at the resulting
+// revision. An empty script is not recorded for a category without
+// revisions. created reports whether a new revision was stored.
+func SaveScriptRevision(tx *gorm.DB, categoryID uint, script, author, message string) (rev ScriptRevision, created bool, err error) {
+	err = tx.Where("category_id = ?", categoryID).Order("revision DESC").Limit(1).Find(&rev).Error
+	if err != nil {
+		return rev, false, err
+	}
+	if rev.ID == 0 && script == "" {
+		return rev, false, nil
+	}
+	if rev.ID == 0 || rev.Script != script {
+		rev = ScriptRevision{
+			CategoryID: categoryID,
+			Revision:   rev.Revision + 1,
+			Script:     script,
+			Author:     author,
+			Message:    message,
+		}
+		if err := tx.Create(&rev).Error; err != nil {
+			return rev, false, err
+		}
+		created = true
+	}
+	err = tx.Model(&Category{}).Where("id = ?", categoryID).Update("script_revision", rev.Revision).Error
+	return rev, created, err
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSaveScriptRevision(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "scripts")
+
+	if _, created, err := SaveScriptRevision(DB, cat.ID, "", "ops", ""); err != nil || created {
+		t.Fatalf("expected empty first script skipped, got created=%v err=%v", created, err)
+	}
+	rev, created, err := SaveScriptRevision(DB, cat.ID, "v1", "ops", "")
+	if err != nil || !created || rev.Revision != 1 || rev.Author != "ops" {
+		t.Fatalf("expected revision 1, got %+v created=%v err=%v", rev, created, err)
+	}
+	if rev, created, _ = SaveScriptRevision(DB, cat.ID, "v1", "other", ""); created || rev.Revision != 1 {
+		t.Errorf("expected unchanged script to keep revision 1, got %+v created=%v", rev, created)
+	}
+	if rev, created, _ = SaveScriptRevision(DB, cat.ID, "", "ops", ""); !created || rev.Revision != 2 {
+		t.Errorf("expected cleared script saved as revision 2, got %+v created=%v", rev, created)
+	}
+
+	var got Category
+	DB.First(&got, cat.ID)
+	if got.ScriptRevision != 2 {
+		t.Errorf("expected category at revision 2, got %d", got.ScriptRevision)
+	}
+}
+
+func TestBackup_RecordsRestoredScriptRevision(t *testing.T) {
+	setupTestDB(t)
+	cat := seedBackupData(t)
+	SaveScriptRevision(DB, cat.ID, cat.ValidationScript, "ops", "")
+	archive := exportAll(t)
+
+	if _, err := ImportBackup(strings.NewReader(archive.String()), true); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	var restored Category
+	DB.Where("name = ?", cat.Name).First(&restored)
+	var revs []ScriptRevision
+	DB.Where("category_id = ?", restored.ID).Find(&revs)
+	if len(revs) != 1 || revs[0].Script != cat.ValidationScript || revs[0].Message != "restored from backup" {
+		t.Fatalf("expected restored script as the only revision, got %+v", revs)
+	}
+	if restored.ScriptRevision != revs[0].Revision {
+		t.Errorf("expected category at revision %d, got %d", revs[0].Revision, restored.ScriptRevision)
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"final-account-hub/logger"
 )
 
-// TakeSnapshots records current account counts for all categories and a global summary.
+// TakeSnapshots records current account counts for all categories and a global summary,
+// and updates each category's stock alert state from its available count.
 // granularity should be one of "1h", "1d", "1w".
 // Skips if a snapshot for the same granularity already exists within the current time window.
 func TakeSnapshots(granularity string) {
@@ -28,12 +29,14 @@ func TakeSnapshots(granularity string) {
 	DB.Find(&categories)
 
 	var globalAvail, globalUsed, globalBanned, globalTotal int64
+	availCond, availArgs := AvailableCondition("", now)
+	usedCond, usedArgs := UsedCondition("", now)
 
 	for _, cat := range categories {
 		var avail, used, banned, total int64
 		DB.Model(&Account{}).Where("category_id = ?", cat.ID).Count(&total)
-		DB.Model(&Account{}).Where("category_id = ? AND used = ? AND banned = ?", cat.ID, false, false).Count(&avail)
-		DB.Model(&Account{}).Where("category_id = ? AND used = ? AND banned = ?", cat.ID, true, false).Count(&used)
+		DB.Model(&Account{}).Where("category_id = ?", cat.ID).Where(availCond, availArgs...).Count(&avail)
+		DB.Model(&Account{}).Where("category_id = ?", cat.ID).Where(usedCond, usedArgs...).Count(&used)
 		DB.Model(&Account{}).Where("category_id = ? AND banned = ?", cat.ID, true).Count(&banned)
 
 		DB.Create(&AccountSnapshot{
@@ -46,6 +49,8 @@ func TakeSnapshots(granularity string) {
 			RecordedAt:  now,
 		})
 
+		recordAlertState(&cat, avail)
+
 		globalAvail += avail
 		globalUsed += used
 		globalBanned += banned
@@ -29,7 +29,7 @@ func setupTestDB(t *testing.T) {
 		t.Fatalf("failed to open test database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&Category{}, &Account{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}); err != nil {
+	if err := db.AutoMigrate(&Category{}, &Account{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}, &APIToken{}, &AccountTag{}, &Webhook{}, &WebhookDelivery{}, &Alert{}, &Job{}, &AuditLog{}, &ScriptRevision{}, &AccountHistory{}); err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
 
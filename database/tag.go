@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxTagLength matches the size of the AccountTag.Tag column.
+const MaxTagLength = 100
+
+// NormalizeTags trims tags, drops duplicates and validates their length.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if len(t) > MaxTagLength {
+			return nil, fmt.Errorf("tag '%s' exceeds %d characters", t, MaxTagLength)
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// LoadTags fills the Tags field of each account, sorted alphabetically.
+func LoadTags(tx *gorm.DB, accounts []Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(accounts))
+	for i, acc := range accounts {
+		ids[i] = acc.ID
+	}
+	var rows []AccountTag
+	if err := tx.Select("account_id, tag").Where("account_id IN ?", ids).Order("tag").Find(&rows).Error; err != nil {
+		return err
+	}
+	byAccount := make(map[uint][]string)
+	for _, r := range rows {
+		byAccount[r.AccountID] = append(byAccount[r.AccountID], r.Tag)
+	}
+	for i := range accounts {
+		accounts[i].Tags = byAccount[accounts[i].ID]
+	}
+	return nil
+}
+
+// ApplyTagFilter keeps accounts carrying every tag in include and none of the
+// tags in exclude.
+func ApplyTagFilter(query *gorm.DB, include, exclude []string) *gorm.DB {
+	for _, t := range include {
+		query = query.Where("id IN (?)", DB.Model(&AccountTag{}).Select("account_id").Where("tag = ?", t))
+	}
+	if len(exclude) > 0 {
+		query = query.Where("id NOT IN (?)", DB.Model(&AccountTag{}).Select("account_id").Where("tag IN ?", exclude))
+	}
+	return query
+}
+
+// TagCount is the number of accounts carrying a tag in one category.
+type TagCount struct {
+	Tag       string `json:"tag"`
+	Total     int64  `json:"total"`
+	Available int64  `json:"available"`
+}
+
+// CountTags returns per-tag totals and available counts for a category.
+func CountTags(categoryID uint) ([]TagCount, error) {
+	counts := []TagCount{}
+	available, args := AvailableCondition("accounts", time.Now())
+	err := DB.Table("account_tags").
+		Joins("JOIN accounts ON accounts.id = account_tags.account_id").
+		Where("accounts.category_id = ? AND accounts.deleted_at IS NULL", categoryID).
+		Select("account_tags.tag AS tag, COUNT(*) AS total, "+
+			"SUM(CASE WHEN "+available+" THEN 1 ELSE 0 END) AS available", args...).
+		Group("account_tags.tag").
+		Order("account_tags.tag").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// DeleteOrphanedTags removes tags whose account no longer exists. SQLite does
+// not enforce the cascade, so account deletions call this explicitly. Tags of
+// trashed accounts are kept so restoring them brings the tags back.
+func DeleteOrphanedTags(tx *gorm.DB) error {
+	return tx.Where("account_id NOT IN (?)", tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Account{}).Select("id")).
+		Delete(&AccountTag{}).Error
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenPrefix marks API tokens so the auth middleware can tell them apart from
+// the master PASSKEY without a database lookup.
+const TokenPrefix = "fah_"
+
+// TokenPermissions lists the permissions a token can be granted.
+// "admin" implies every other permission.
+var TokenPermissions = []string{"fetch", "read", "write", "admin"}
+
+// GenerateToken returns a new random plaintext token.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return TokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 digest stored for a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindActiveToken looks up a non-expired token by its plaintext value.
+func FindActiveToken(token string) (*APIToken, error) {
+	var t APIToken
+	err := DB.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", HashToken(token), time.Now()).
+		First(&t).Error
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TouchToken records token usage, writing at most once per minute to keep
+// hot consumer tokens from turning every request into a DB write.
+func TouchToken(t *APIToken) {
+	now := time.Now()
+	if t.LastUsedAt != nil && now.Sub(*t.LastUsedAt) < time.Minute {
+		return
+	}
+	DB.Model(&APIToken{}).Where("id = ?", t.ID).Update("last_used_at", now)
+}
+
+// HasPermission reports whether the token grants perm.
+func (t *APIToken) HasPermission(perm string) bool {
+	for _, p := range strings.Split(t.Permissions, ",") {
+		p = strings.TrimSpace(p)
+		if p == perm || p == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllCategories reports whether the token is not restricted to specific categories.
+func (t *APIToken) AllCategories() bool {
+	return strings.TrimSpace(t.CategoryIDs) == ""
+}
+
+// CategoryIDList returns the categories the token is scoped to.
+// An empty result means the token applies to all categories.
+func (t *APIToken) CategoryIDList() []uint {
+	var ids []uint
+	for _, p := range strings.Split(t.CategoryIDs, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(p), 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// AllowsCategory reports whether the token may act on the given category.
+func (t *APIToken) AllowsCategory(categoryID uint) bool {
+	if t.AllCategories() {
+		return true
+	}
+	for _, id := range t.CategoryIDList() {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinCategoryIDs encodes category IDs into the APIToken.CategoryIDs format.
+func JoinCategoryIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"time"
+
+	"final-account-hub/logger"
+
+	"gorm.io/gorm"
+)
+
+// TrashCategory moves a category and its accounts to the trash.
+func TrashCategory(tx *gorm.DB, id uint) error {
+	now := time.Now()
+	if err := tx.Model(&Account{}).Where("category_id = ?", id).UpdateColumn("deleted_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Category{}).Where("id = ?", id).UpdateColumn("deleted_at", now).Error
+}
+
+// RestoreCategory takes a category out of the trash together with the
+// accounts trashed with it. Accounts deleted before the category stay in the
+// trash. It returns gorm.ErrRecordNotFound when the category is not in the
+// trash.
+func RestoreCategory(id uint) (restored int64, err error) {
+	var cat Category
+	if err := DB.Unscoped().Select("id").Where("deleted_at IS NOT NULL").First(&cat, id).Error; err != nil {
+		return 0, err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&Account{}).
+			Where("category_id = ? AND deleted_at >= (SELECT deleted_at FROM categories WHERE id = ?)", id, id).
+			UpdateColumn("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		restored = result.RowsAffected
+		return tx.Unscoped().Model(&Category{}).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error
+	})
+	return restored, err
+}
+
+// RestoreAccounts takes the given accounts out of the trash and returns the
+// IDs of those restored. Accounts whose category is in the trash, or whose
+// data matches an active account of the same category, are skipped.
+func RestoreAccounts(ids []uint) (restored []uint, skipped int64, err error) {
+	var accounts []Account
+	err = DB.Unscoped().Select("id, category_id, data_hash").
+		Where("id IN ? AND deleted_at IS NOT NULL", ids).
+		Where("category_id IN (?)", DB.Model(&Category{}).Select("id")).
+		Order("id").Find(&accounts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	skipped = int64(len(ids) - len(accounts))
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, acc := range accounts {
+			var duplicates int64
+			if err := tx.Model(&Account{}).Where("category_id = ? AND data_hash = ?", acc.CategoryID, acc.DataHash).Count(&duplicates).Error; err != nil {
+				return err
+			}
+			if duplicates > 0 {
+				skipped++
+				continue
+			}
+			if err := tx.Unscoped().Model(&Account{}).Where("id = ?", acc.ID).UpdateColumn("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			restored = append(restored, acc.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return restored, skipped, nil
+}
+
+// PurgeAccounts permanently removes trashed accounts matching condition,
+// along with their tags and history.
+func PurgeAccounts(tx *gorm.DB, condition string, args ...interface{}) (int64, error) {
+	var purged int64
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		trashed := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Account{}).
+			Select("id").Where("deleted_at IS NOT NULL").Where(condition, args...)
+		if err := tx.Where("account_id IN (?)", trashed).Delete(&AccountTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id IN (?)", trashed).Delete(&AccountHistory{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Where(condition, args...).Delete(&Account{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// PurgeCategory permanently removes a trashed category with its accounts,
+// account history, runs, API history, alerts, snapshots and script
+// revisions. It returns gorm.ErrRecordNotFound when the category is not in
+// the trash.
+func PurgeCategory(tx *gorm.DB, id uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var cat Category
+		if err := tx.Unscoped().Select("id").Where("deleted_at IS NOT NULL").First(&cat, id).Error; err != nil {
+			return err
+		}
+		accounts := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Account{}).Select("id").Where("category_id = ?", id)
+		if err := tx.Where("account_id IN (?)", accounts).Delete(&AccountTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("category_id = ?", id).Delete(&Account{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&AccountHistory{}, &ValidationRun{}, &APICallHistory{}, &AccountSnapshot{}, &Alert{}, &ScriptRevision{}} {
+			if err := tx.Where("category_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&Category{}, id).Error
+	})
+}
+
+// PurgeTrash permanently removes accounts and categories that have been in
+// the trash for longer than their category's TrashRetentionDays. Called
+// periodically by the validator scheduler.
+func PurgeTrash() (accounts, categories int64) {
+	var cats []Category
+	if err := DB.Unscoped().Select("id, trash_retention_days, deleted_at").Order("id").Find(&cats).Error; err != nil {
+		logger.Error.Printf("Failed to purge trash: %v", err)
+		return 0, 0
+	}
+	now := time.Now()
+	for _, cat := range cats {
+		cutoff := now.AddDate(0, 0, -max(cat.TrashRetentionDays, 0))
+		if cat.DeletedAt.Valid {
+			if cat.DeletedAt.Time.After(cutoff) {
+				continue
+			}
+			var count int64
+			DB.Unscoped().Model(&Account{}).Where("category_id = ?", cat.ID).Count(&count)
+			if err := PurgeCategory(DB, cat.ID); err != nil {
+				logger.Error.Printf("Failed to purge category %d from trash: %v", cat.ID, err)
+				continue
+			}
+			accounts += count
+			categories++
+			continue
+		}
+		purged, err := PurgeAccounts(DB, "category_id = ? AND deleted_at <= ?", cat.ID, cutoff)
+		if err != nil {
+			logger.Error.Printf("Failed to purge trashed accounts of category %d: %v", cat.ID, err)
+			continue
+		}
+		accounts += purged
+	}
+	if accounts > 0 || categories > 0 {
+		logger.Info.Printf("Purged %d accounts and %d categories from the trash", accounts, categories)
+	}
+	return accounts, categories
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// countAll counts rows of model including the trash.
+func countAll(model interface{}, condition string, args ...interface{}) int64 {
+	var n int64
+	DB.Unscoped().Model(model).Where(condition, args...).Count(&n)
+	return n
+}
+
+func TestTrashCategory_RestoreBringsBackItsAccounts(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "trash")
+	earlier := seedAccount(t, cat.ID, "earlier")
+	seedAccount(t, cat.ID, "kept")
+	DB.Delete(&Account{}, earlier.ID)
+	DB.Unscoped().Model(&Account{}).Where("id = ?", earlier.ID).UpdateColumn("deleted_at", time.Now().Add(-time.Hour))
+
+	if err := TrashCategory(DB, cat.ID); err != nil {
+		t.Fatalf("trash failed: %v", err)
+	}
+	var active int64
+	DB.Model(&Account{}).Count(&active)
+	if err := DB.First(&Category{}, cat.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) || active != 0 {
+		t.Fatalf("expected category and accounts hidden, got err=%v accounts=%d", err, active)
+	}
+
+	restored, err := RestoreCategory(cat.ID)
+	if err != nil || restored != 1 {
+		t.Fatalf("expected 1 account restored, got %d err=%v", restored, err)
+	}
+	if err := DB.First(&Category{}, cat.ID).Error; err != nil {
+		t.Errorf("expected category restored: %v", err)
+	}
+	if err := DB.First(&Account{}, earlier.ID).Error; err == nil {
+		t.Error("expected account deleted before the category to stay in the trash")
+	}
+	if _, err := RestoreCategory(cat.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected not found for an active category, got %v", err)
+	}
+}
+
+func TestRestoreAccounts_SkipsDuplicatesAndTrashedCategories(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "live")
+	gone := seedCategory(t, "gone")
+	dup := seedAccount(t, cat.ID, "same")
+	ok := seedAccount(t, cat.ID, "unique")
+	orphan := seedAccount(t, gone.ID, "orphan")
+	DB.Delete(&Account{}, []uint{dup.ID, ok.ID})
+	seedAccount(t, cat.ID, "same")
+	TrashCategory(DB, gone.ID)
+
+	restored, skipped, err := RestoreAccounts([]uint{dup.ID, ok.ID, orphan.ID})
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(restored) != 1 || restored[0] != ok.ID || skipped != 2 {
+		t.Errorf("expected only account %d restored and 2 skipped, got %v skipped=%d", ok.ID, restored, skipped)
+	}
+}
+
+func TestPurgeTrash_HonoursRetention(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "retained")
+	DB.Model(&cat).Update("trash_retention_days", 7)
+	old := seedAccount(t, cat.ID, "old")
+	recent := seedAccount(t, cat.ID, "recent")
+	DB.Create(&AccountTag{AccountID: old.ID, Tag: "eu"})
+	DB.Delete(&Account{}, []uint{old.ID, recent.ID})
+	DB.Unscoped().Model(&Account{}).Where("id = ?", old.ID).UpdateColumn("deleted_at", time.Now().AddDate(0, 0, -8))
+
+	expired := seedCategory(t, "expired")
+	seedAccount(t, expired.ID, "inside")
+	DB.Create(&ValidationRun{CategoryID: expired.ID, Status: "success"})
+	TrashCategory(DB, expired.ID)
+	DB.Unscoped().Model(&Category{}).Where("id = ?", expired.ID).UpdateColumn("deleted_at", time.Now().AddDate(0, 0, -31))
+
+	fresh := seedCategory(t, "fresh")
+	TrashCategory(DB, fresh.ID)
+
+	accounts, categories := PurgeTrash()
+	if accounts != 2 || categories != 1 {
+		t.Fatalf("expected 2 accounts and 1 category purged, got %d and %d", accounts, categories)
+	}
+	if countAll(&Account{}, "id = ?", old.ID) != 0 || countAll(&Account{}, "id = ?", recent.ID) != 1 {
+		t.Error("expected only the account past retention purged")
+	}
+	if countAll(&AccountTag{}, "account_id = ?", old.ID) != 0 {
+		t.Error("expected tags of purged accounts removed")
+	}
+	if countAll(&Category{}, "id = ?", expired.ID) != 0 || countAll(&ValidationRun{}, "category_id = ?", expired.ID) != 0 {
+		t.Error("expected expired category purged with its runs")
+	}
+	if countAll(&Category{}, "id = ?", fresh.ID) != 1 {
+		t.Error("expected recently trashed category kept")
+	}
+}
+
+func TestPurgeCategory_RequiresTrash(t *testing.T) {
+	setupTestDB(t)
+	cat := seedCategory(t, "active")
+	if err := PurgeCategory(DB, cat.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected active category refused, got %v", err)
+	}
+}
+
+func TestBackup_ExcludesTrash(t *testing.T) {
+	setupTestDB(t)
+	seedBackupData(t)
+	gone := seedCategory(t, "gone")
+	seedAccount(t, gone.ID, "trashed")
+	DB.Create(&ValidationRun{CategoryID: gone.ID, Status: "success"})
+	TrashCategory(DB, gone.ID)
+	archive := exportAll(t)
+
+	if _, err := ImportBackup(archive, true); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if n := countAll(&Category{}, "1 = 1"); n != 1 {
+		t.Errorf("expected only the active category restored, got %d", n)
+	}
+	if n := countAll(&Account{}, "1 = 1"); n != 2 {
+		t.Errorf("expected only active accounts restored, got %d", n)
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"time"
+
+	"final-account-hub/logger"
+
+	"gorm.io/gorm"
+)
+
+// UsagePolicy is the per-category reuse configuration applied when accounts
+// are handed out.
+type UsagePolicy struct {
+	MaxUses  int
+	Cooldown time.Duration
+}
+
+// CategoryUsagePolicy loads the reuse settings of a category. Missing
+// categories count as single-use without cooldown.
+func CategoryUsagePolicy(tx *gorm.DB, categoryID uint) UsagePolicy {
+	var cat Category
+	if err := tx.Select("id, max_uses, cooldown_seconds").First(&cat, categoryID).Error; err != nil {
+		return UsagePolicy{MaxUses: 1}
+	}
+	policy := UsagePolicy{MaxUses: cat.MaxUses, Cooldown: time.Duration(cat.CooldownSeconds) * time.Second}
+	if policy.MaxUses < 1 {
+		policy.MaxUses = 1
+	}
+	if policy.Cooldown < 0 {
+		policy.Cooldown = 0
+	}
+	return policy
+}
+
+// CategoryMaxUses returns how many times an account in the category may be
+// handed out before it is exhausted.
+func CategoryMaxUses(tx *gorm.DB, categoryID uint) int {
+	return CategoryUsagePolicy(tx, categoryID).MaxUses
+}
+
+// AvailableCondition is the SQL condition for accounts that can be handed
+// out: not banned, and either unused or resting with an elapsed cooldown
+// (ReleaseCooledDownAccounts resets those shortly after). table qualifies the
+// columns for joins and may be empty. Stats, alerts, snapshots and the
+// account filters all count availability with it so they agree.
+func AvailableCondition(table string, now time.Time) (string, []interface{}) {
+	col := columnPrefix(table)
+	return "(" + col + "banned = ? AND (" + col + "used = ? OR (" + col + "cooldown_until IS NOT NULL AND " + col + "cooldown_until <= ?)))",
+		[]interface{}{false, false, now}
+}
+
+// UsedCondition is the SQL condition for accounts that are used and not
+// banned, excluding those AvailableCondition counts as available again.
+func UsedCondition(table string, now time.Time) (string, []interface{}) {
+	col := columnPrefix(table)
+	return "(" + col + "used = ? AND " + col + "banned = ? AND (" + col + "cooldown_until IS NULL OR " + col + "cooldown_until > ?))",
+		[]interface{}{true, false, now}
+}
+
+func columnPrefix(table string) string {
+	if table == "" {
+		return ""
+	}
+	return table + "."
+}
+
+// RecordUse counts one use of each account, ends any lease on them, and marks
+// them used once use_count reaches the policy's MaxUses. Accounts whose
+// cooldown already elapsed start counting from zero again. With a cooldown
+// configured, exhausted accounts rest until now + Cooldown. An optional where
+// condition and its arguments narrow the update; the number of accounts
+// updated is returned.
+func RecordUse(tx *gorm.DB, ids []uint, policy UsagePolicy, now time.Time, where ...interface{}) (int64, error) {
+	maxUses := policy.MaxUses
+	if maxUses < 1 {
+		maxUses = 1
+	}
+	// SET expressions see pre-update values, so newCount is the count after this use
+	newCount := "(CASE WHEN cooldown_until IS NOT NULL AND cooldown_until <= ? THEN 1 ELSE use_count + 1 END)"
+	var cooldownUntil interface{}
+	if policy.Cooldown > 0 {
+		cooldownUntil = gorm.Expr("CASE WHEN "+newCount+" >= ? THEN ? ELSE NULL END", now, maxUses, now.Add(policy.Cooldown))
+	}
+	query := tx.Model(&Account{}).Where("id IN ?", ids)
+	if len(where) > 0 {
+		query = query.Where(where[0], where[1:]...)
+	}
+	result := query.Updates(map[string]interface{}{
+		"use_count":        gorm.Expr(newCount, now),
+		"used":             gorm.Expr(newCount+" >= ?", now, maxUses),
+		"last_used_at":     now,
+		"lease_id":         nil,
+		"lease_expires_at": nil,
+		"cooldown_until":   cooldownUntil,
+	})
+	return result.RowsAffected, result.Error
+}
+
+// ReleaseCooledDownAccounts returns resting accounts whose cooldown has
+// elapsed to the available pool with a fresh use count. Called periodically
+// by the validator scheduler.
+func ReleaseCooledDownAccounts() int64 {
+	var released int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		condition := "cooldown_until IS NOT NULL AND cooldown_until <= ? AND lease_id IS NULL"
+		now := time.Now()
+		var ids []uint
+		if err := tx.Model(&Account{}).Where(condition, now).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		var err error
+		released, err = UpdateTrackedAccounts(tx, ids,
+			map[string]interface{}{"used": false, "use_count": 0, "cooldown_until": nil},
+			HistorySource{Source: HistorySourceSystem}, condition, now)
+		return err
+	})
+	if err != nil {
+		logger.Error.Printf("Failed to release cooled-down accounts: %v", err)
+		return 0
+	}
+	if released > 0 {
+		logger.Info.Printf("Released %d accounts after cooldown", released)
+	}
+	return released
+}
+
+// RemainingUses sums the uses left on available accounts (see
+// AvailableCondition), using each account's category max_uses. Accounts whose
+// cooldown elapsed have their full max_uses again. categoryID 0 sums across
+// all categories, matching the AccountSnapshot convention.
+func RemainingUses(categoryID uint) (int64, error) {
+	var remaining int64
+	now := time.Now()
+	available, args := AvailableCondition("accounts", now)
+	query := DB.Table("accounts").
+		Joins("JOIN categories ON categories.id = accounts.category_id").
+		Where(available, args...).
+		Where("accounts.deleted_at IS NULL AND categories.deleted_at IS NULL")
+	if categoryID != 0 {
+		query = query.Where("accounts.category_id = ?", categoryID)
+	}
+	err := query.Select("COALESCE(SUM(CASE "+
+		"WHEN accounts.cooldown_until IS NOT NULL AND accounts.cooldown_until <= ? THEN categories.max_uses "+
+		"WHEN accounts.use_count < categories.max_uses THEN categories.max_uses - accounts.use_count "+
+		"ELSE 0 END), 0)", now).
+		Scan(&remaining).Error
+	return remaining, err
+}
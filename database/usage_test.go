@@ -0,0 +1,111 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordUse_CooldownOnExhaustion(t *testing.T) {
+	setupTestDB(t)
+
+	cat := Category{Name: "usage-cooldown", MaxUses: 2, CooldownSeconds: 60}
+	DB.Create(&cat)
+	acc := Account{CategoryID: cat.ID, Data: "a"}
+	DB.Create(&acc)
+
+	policy := CategoryUsagePolicy(DB, cat.ID)
+	if policy.MaxUses != 2 || policy.Cooldown != time.Minute {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	now := time.Now()
+	if _, err := RecordUse(DB, []uint{acc.ID}, policy, now); err != nil {
+		t.Fatalf("RecordUse failed: %v", err)
+	}
+	DB.First(&acc, acc.ID)
+	if acc.Used || acc.CooldownUntil != nil {
+		t.Fatalf("first use should not exhaust: used=%v cooldown_until=%v", acc.Used, acc.CooldownUntil)
+	}
+
+	if _, err := RecordUse(DB, []uint{acc.ID}, policy, now); err != nil {
+		t.Fatalf("RecordUse failed: %v", err)
+	}
+	DB.First(&acc, acc.ID)
+	if !acc.Used || acc.UseCount != 2 || acc.CooldownUntil == nil {
+		t.Fatalf("second use should exhaust and rest: %+v", acc)
+	}
+	if d := acc.CooldownUntil.Sub(now); d < 59*time.Second || d > 61*time.Second {
+		t.Errorf("expected cooldown of one minute, got %v", d)
+	}
+}
+
+func TestReleaseCooledDownAccounts(t *testing.T) {
+	setupTestDB(t)
+
+	cat := Category{Name: "usage-release"}
+	DB.Create(&cat)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	leaseID := "lease"
+	rested := Account{CategoryID: cat.ID, Data: "rested", Used: true, UseCount: 3, CooldownUntil: &past}
+	resting := Account{CategoryID: cat.ID, Data: "resting", Used: true, UseCount: 3, CooldownUntil: &future}
+	leased := Account{CategoryID: cat.ID, Data: "leased", Used: true, CooldownUntil: &past, LeaseID: &leaseID}
+	DB.Create(&rested)
+	DB.Create(&resting)
+	DB.Create(&leased)
+
+	if n := ReleaseCooledDownAccounts(); n != 1 {
+		t.Fatalf("expected 1 released account, got %d", n)
+	}
+
+	var got Account
+	DB.First(&got, rested.ID)
+	if got.Used || got.UseCount != 0 || got.CooldownUntil != nil {
+		t.Errorf("expected rested account reset, got used=%v use_count=%d cooldown_until=%v", got.Used, got.UseCount, got.CooldownUntil)
+	}
+	got = Account{}
+	DB.First(&got, resting.ID)
+	if !got.Used || got.CooldownUntil == nil {
+		t.Errorf("expected resting account untouched, got used=%v cooldown_until=%v", got.Used, got.CooldownUntil)
+	}
+}
+
+func TestAvailableCondition_ElapsedCooldown(t *testing.T) {
+	setupTestDB(t)
+	cat := Category{Name: "availability", MaxUses: 3, LowWatermark: 3}
+	DB.Create(&cat)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	DB.Create(&[]Account{
+		{CategoryID: cat.ID, Data: "fresh", UseCount: 1},
+		{CategoryID: cat.ID, Data: "rested", Used: true, UseCount: 3, CooldownUntil: &past},
+		{CategoryID: cat.ID, Data: "resting", Used: true, UseCount: 3, CooldownUntil: &future},
+		{CategoryID: cat.ID, Data: "banned", Banned: true},
+	})
+
+	now := time.Now()
+	var available, used int64
+	condition, args := AvailableCondition("", now)
+	DB.Model(&Account{}).Where(condition, args...).Count(&available)
+	condition, args = UsedCondition("", now)
+	DB.Model(&Account{}).Where(condition, args...).Count(&used)
+	if available != 2 || used != 1 {
+		t.Errorf("expected 2 available and 1 used, got %d and %d", available, used)
+	}
+
+	// The rested account has its full max_uses again
+	if remaining, err := RemainingUses(cat.ID); err != nil || remaining != 5 {
+		t.Errorf("expected 5 remaining uses, got %d (%v)", remaining, err)
+	}
+
+	TakeSnapshots("1h")
+	var snap AccountSnapshot
+	DB.Where("category_id = ?", cat.ID).First(&snap)
+	if snap.Available != 2 || snap.Used != 1 || snap.Banned != 1 {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+	var alert Alert
+	DB.Where("category_id = ?", cat.ID).First(&alert)
+	if alert.State != AlertLow || alert.Available != 2 {
+		t.Errorf("expected a low alert with 2 available, got %+v", alert)
+	}
+}
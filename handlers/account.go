@@ -1,18 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/metrics"
+	"final-account-hub/webhook"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func AddAccount(c *gin.Context) {
@@ -31,12 +38,22 @@ func AddAccount(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category_id"})
 		return
 	}
+	if denyCategory(c, uint(catID)) {
+		return
+	}
 	var existing database.Account
-	if database.DB.Where("category_id = ? AND data = ?", catID, req.Data).First(&existing).Error == nil {
+	if database.DB.Where("category_id = ? AND data_hash = ?", catID, database.HashData(req.Data)).First(&existing).Error == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "account already exists"})
 		return
 	}
-	account := database.Account{CategoryID: uint(catID), Data: req.Data}
+	var cat database.Category
+	database.DB.Select("id, account_schema").First(&cat, catID)
+	fields, err := cat.ParseFields(req.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	account := database.Account{CategoryID: uint(catID), Data: req.Data, Fields: fields}
 	if err := database.DB.Create(&account).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -59,6 +76,9 @@ func AddAccountsBulk(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "max 10000 items per request"})
 		return
 	}
+	if denyCategory(c, req.CategoryID) {
+		return
+	}
 
 	// Verify category exists before inserting
 	var cat database.Category
@@ -67,18 +87,27 @@ func AddAccountsBulk(c *gin.Context) {
 		return
 	}
 
-	var existingData []string
-	database.DB.Model(&database.Account{}).Where("category_id = ? AND data IN ?", req.CategoryID, req.Data).Pluck("data", &existingData)
+	hashes := make([]string, len(req.Data))
+	for i, d := range req.Data {
+		hashes[i] = database.HashData(d)
+	}
+	var existingHashes []string
+	database.DB.Model(&database.Account{}).Where("category_id = ? AND data_hash IN ?", req.CategoryID, hashes).Pluck("data_hash", &existingHashes)
 	existingSet := make(map[string]bool)
-	for _, d := range existingData {
-		existingSet[d] = true
+	for _, h := range existingHashes {
+		existingSet[h] = true
 	}
 
 	var accounts []database.Account
-	for _, d := range req.Data {
-		if !existingSet[d] {
-			accounts = append(accounts, database.Account{CategoryID: req.CategoryID, Data: d})
-			existingSet[d] = true // prevent duplicates within request
+	for i, d := range req.Data {
+		if !existingSet[hashes[i]] {
+			fields, err := cat.ParseFields(d)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("data[%d]: %s", i, err.Error())})
+				return
+			}
+			accounts = append(accounts, database.Account{CategoryID: req.CategoryID, Data: d, Fields: fields})
+			existingSet[hashes[i]] = true // prevent duplicates within request
 		}
 	}
 
@@ -89,6 +118,9 @@ func AddAccountsBulk(c *gin.Context) {
 		}
 	}
 
+	if len(accounts) > 0 {
+		go webhook.Emit(req.CategoryID, webhook.EventAccountsImported, gin.H{"count": len(accounts), "skipped": len(req.Data) - len(accounts)})
+	}
 	c.JSON(http.StatusCreated, gin.H{"count": len(accounts), "skipped": len(req.Data) - len(accounts)})
 }
 
@@ -102,12 +134,25 @@ func GetAccounts(c *gin.Context) {
 	if limit < 1 || limit > 1000 {
 		limit = 100
 	}
+	tags, err := database.NormalizeTags(strings.Split(c.Query("tags"), ","))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	excludeTags, err := database.NormalizeTags(strings.Split(c.Query("exclude_tags"), ","))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var total int64
 	var accounts []database.Account
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&database.Account{}).Where("category_id = ?", categoryID).Count(&total).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		scope := func() *gorm.DB {
+			return database.ApplyTagFilter(tx.Model(&database.Account{}).Where("category_id = ?", categoryID), tags, excludeTags)
+		}
+		if err := scope().Count(&total).Error; err != nil {
 			return err
 		}
 		// Clamp page to valid range
@@ -119,7 +164,10 @@ func GetAccounts(c *gin.Context) {
 			page = totalPages
 		}
 		offset := (page - 1) * limit
-		return tx.Where("category_id = ?", categoryID).Order("id").Offset(offset).Limit(limit).Find(&accounts).Error
+		if err := scope().Order("id").Offset(offset).Limit(limit).Find(&accounts).Error; err != nil {
+			return err
+		}
+		return database.LoadTags(tx, accounts)
 	})
 
 	if err != nil {
@@ -129,23 +177,35 @@ func GetAccounts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": accounts, "total": total, "page": page, "limit": limit})
 }
 
+// fetchMutex serializes claiming fetches on SQLite. PostgreSQL instead uses
+// SELECT ... FOR UPDATE SKIP LOCKED so concurrent consumers claim disjoint rows.
+var fetchMutex sync.Mutex
+
 func FetchAccounts(c *gin.Context) {
+	started := time.Now()
 	var req struct {
-		CategoryID    uint            `json:"category_id" binding:"required"`
-		Count         int             `json:"count" binding:"required"`
-		Order         string          `json:"order"`
-		AccountType   json.RawMessage `json:"account_type"`
-		MarkAsUsed    *bool           `json:"mark_as_used"`
-		CreatedAfter  *string         `json:"created_after"`
-		CreatedBefore *string         `json:"created_before"`
-		UpdatedAfter  *string         `json:"updated_after"`
-		UpdatedBefore *string         `json:"updated_before"`
+		CategoryID    uint                   `json:"category_id" binding:"required"`
+		Count         int                    `json:"count" binding:"required"`
+		Order         string                 `json:"order"`
+		AccountType   json.RawMessage        `json:"account_type"`
+		MarkAsUsed    *bool                  `json:"mark_as_used"`
+		CreatedAfter  *string                `json:"created_after"`
+		CreatedBefore *string                `json:"created_before"`
+		UpdatedAfter  *string                `json:"updated_after"`
+		UpdatedBefore *string                `json:"updated_before"`
+		LeaseSeconds  int                    `json:"lease_seconds"`
+		Fields        map[string]interface{} `json:"fields"`
+		Tags          []string               `json:"tags"`
+		ExcludeTags   []string               `json:"exclude_tags"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if denyCategory(c, req.CategoryID) {
+		return
+	}
 	if req.Count < 1 {
 		req.Count = 1
 	} else if req.Count > 1000 {
@@ -182,9 +242,60 @@ func FetchAccounts(c *gin.Context) {
 		markAsUsed = *req.MarkAsUsed
 	}
 
+	// Field filters are checked against the category schema
+	var fieldFilters []fieldFilter
+	if len(req.Fields) > 0 {
+		if database.EncryptionEnabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field filters are not available while encryption at rest is enabled"})
+			return
+		}
+		var cat database.Category
+		database.DB.Select("id, account_schema").First(&cat, req.CategoryID)
+		fieldFilters, err = parseFieldFilters(cat.AccountSchema, req.Fields)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tags, err := database.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	excludeTags, err := database.NormalizeTags(req.ExcludeTags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Lease mode: accounts are checked out until released, consumed or expired
+	if req.LeaseSeconds != 0 {
+		if req.LeaseSeconds < 1 || req.LeaseSeconds > database.MaxLeaseSeconds {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lease_seconds must be between 1 and 86400"})
+			return
+		}
+		if !markAsUsed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lease_seconds cannot be combined with mark_as_used=false"})
+			return
+		}
+		if len(accountTypes) != 1 || accountTypes[0] != "available" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lease_seconds requires account_type 'available'"})
+			return
+		}
+	}
+
+	// SQLite has no row-level locks, so claiming fetches are serialized in-process
+	if markAsUsed && !database.IsPostgres() {
+		fetchMutex.Lock()
+		defer fetchMutex.Unlock()
+	}
+
+	_, actor := auditActor(c)
 	accounts := []database.Account{}
 	err = database.DB.Transaction(func(tx *gorm.DB) error {
-		query := tx.Where("category_id = ?", req.CategoryID)
+		// Accounts checked out under a lease are never handed to another caller
+		query := tx.Where("category_id = ? AND lease_id IS NULL", req.CategoryID)
 
 		// Apply account type filter
 		query = applyAccountTypeFilter(query, accountTypes)
@@ -194,6 +305,9 @@ func FetchAccounts(c *gin.Context) {
 			query = query.Where(tf.condition, tf.value)
 		}
 
+		query = applyFieldFilters(query, fieldFilters)
+		query = database.ApplyTagFilter(query, tags, excludeTags)
+
 		// Apply ordering
 		if order == "random" {
 			query = query.Order("RANDOM()")
@@ -201,29 +315,99 @@ func FetchAccounts(c *gin.Context) {
 			query = query.Order("id ASC")
 		}
 
+		// Rows locked by a concurrent claiming fetch are skipped rather than
+		// waited on, so parallel consumers never receive the same account
+		if markAsUsed && database.IsPostgres() {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
 		if err := query.Limit(req.Count).Find(&accounts).Error; err != nil {
 			return err
 		}
+		if err := database.LoadTags(tx, accounts); err != nil {
+			return err
+		}
 
 		if len(accounts) > 0 && markAsUsed {
 			var ids []uint
 			for _, acc := range accounts {
 				ids = append(ids, acc.ID)
 			}
-			return tx.Model(&database.Account{}).Where("id IN ?", ids).Update("used", true).Error
+			before := database.StatesOf(accounts)
+			source := database.HistorySource{Source: database.HistorySourceFetch, Actor: actor}
+			if req.LeaseSeconds == 0 {
+				// Count the use; multi-use accounts stay available until max_uses
+				policy := database.CategoryUsagePolicy(tx, req.CategoryID)
+				now := time.Now()
+				if _, err := database.RecordUse(tx, ids, policy, now); err != nil {
+					return err
+				}
+				applyUse(accounts, policy, now)
+				return database.RecordAccountChanges(tx, before, source)
+			}
+
+			leaseID, err := database.NewLeaseID()
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			expiresAt := now.Add(time.Duration(req.LeaseSeconds) * time.Second)
+			// Rested accounts leave their cooldown with a fresh use count
+			if err := tx.Model(&database.Account{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{
+					"used":             true,
+					"lease_id":         leaseID,
+					"lease_expires_at": expiresAt,
+					"use_count":        gorm.Expr("CASE WHEN cooldown_until IS NOT NULL AND cooldown_until <= ? THEN 0 ELSE use_count END", now),
+					"cooldown_until":   nil,
+				}).Error; err != nil {
+				return err
+			}
+			for i := range accounts {
+				if accounts[i].CooldownUntil != nil {
+					accounts[i].UseCount = 0
+					accounts[i].CooldownUntil = nil
+				}
+				accounts[i].Used = true
+				accounts[i].LeaseID = &leaseID
+				accounts[i].LeaseExpiresAt = &expiresAt
+			}
+			return database.RecordAccountChanges(tx, before, source)
 		}
 		return nil
 	})
 
+	metrics.ObserveFetch(req.CategoryID, len(accounts), err, started)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		go RecordAPICall(req.CategoryID, "/api/accounts/fetch", "POST", c.ClientIP(), 500)
 		return
 	}
 	go RecordAPICall(req.CategoryID, "/api/accounts/fetch", "POST", c.ClientIP(), 200)
+	go database.CheckAlert(req.CategoryID)
 	c.JSON(http.StatusOK, accounts)
 }
 
+// applyUse mirrors database.RecordUse on accounts already loaded, so the
+// response shows their state after the use.
+func applyUse(accounts []database.Account, policy database.UsagePolicy, now time.Time) {
+	cooldownUntil := now.Add(policy.Cooldown)
+	for i := range accounts {
+		if accounts[i].CooldownUntil != nil && !accounts[i].CooldownUntil.After(now) {
+			accounts[i].UseCount = 0
+		}
+		accounts[i].UseCount++
+		accounts[i].LastUsedAt = &now
+		accounts[i].Used = accounts[i].UseCount >= policy.MaxUses
+		accounts[i].CooldownUntil = nil
+		accounts[i].LeaseID = nil
+		accounts[i].LeaseExpiresAt = nil
+		if accounts[i].Used && policy.Cooldown > 0 {
+			accounts[i].CooldownUntil = &cooldownUntil
+		}
+	}
+}
+
 // parseAccountType parses the account_type field from JSON.
 // Accepts a single string or an array of strings.
 // Valid values: "available", "used", "banned". Defaults to ["available"].
@@ -277,16 +461,19 @@ func applyAccountTypeFilter(query *gorm.DB, types []string) *gorm.DB {
 	}
 
 	// Build OR conditions for each type
+	now := time.Now()
 	var conditions []string
 	var args []interface{}
 	for _, t := range types {
 		switch t {
 		case "available":
-			conditions = append(conditions, "(used = ? AND banned = ?)")
-			args = append(args, false, false)
+			condition, conditionArgs := database.AvailableCondition("", now)
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
 		case "used":
-			conditions = append(conditions, "(used = ? AND banned = ?)")
-			args = append(args, true, false)
+			condition, conditionArgs := database.UsedCondition("", now)
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
 		case "banned":
 			conditions = append(conditions, "(banned = ?)")
 			args = append(args, true)
@@ -297,6 +484,52 @@ func applyAccountTypeFilter(query *gorm.DB, types []string) *gorm.DB {
 	return query.Where(combined, args...)
 }
 
+type fieldFilter struct {
+	name  string
+	value interface{}
+}
+
+// parseFieldFilters validates fetch field filters against the category schema
+// and coerces each value to the declared field type.
+func parseFieldFilters(schema *database.AccountSchema, raw map[string]interface{}) ([]fieldFilter, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("category has no account schema")
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	filters := make([]fieldFilter, 0, len(names))
+	for _, name := range names {
+		field, ok := schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s'", name)
+		}
+		value, err := database.CoerceFieldValue(field, raw[name])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fieldFilter{name: name, value: value})
+	}
+	return filters, nil
+}
+
+// applyFieldFilters adds an equality condition on each structured field.
+// Field names were validated against the schema, so they are safe to embed.
+func applyFieldFilters(query *gorm.DB, filters []fieldFilter) *gorm.DB {
+	for _, f := range filters {
+		if database.IsPostgres() {
+			doc, _ := json.Marshal(map[string]interface{}{f.name: f.value})
+			query = query.Where("CAST(fields AS jsonb) @> CAST(? AS jsonb)", string(doc))
+		} else {
+			query = query.Where("json_extract(fields, ?) = ?", "$."+f.name, f.value)
+		}
+	}
+	return query
+}
+
 type timeFilter struct {
 	condition string
 	value     time.Time
@@ -334,15 +567,16 @@ func parseTimeFilters(createdAfter, createdBefore, updatedAfter, updatedBefore *
 func UpdateAccount(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
-		Data   *string `json:"data"`
-		Used   *bool   `json:"used"`
-		Banned *bool   `json:"banned"`
+		Data     *string `json:"data"`
+		Used     *bool   `json:"used"`
+		Banned   *bool   `json:"banned"`
+		UseCount *int    `json:"use_count"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if req.Data == nil && req.Used == nil && req.Banned == nil {
+	if req.Data == nil && req.Used == nil && req.Banned == nil && req.UseCount == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one field required"})
 		return
 	}
@@ -352,28 +586,70 @@ func UpdateAccount(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
 		return
 	}
+	if denyCategory(c, account.CategoryID) {
+		return
+	}
 
 	updates := map[string]interface{}{}
+	// Audit entries record that data changed, never the data itself
+	before, after := gin.H{}, gin.H{}
 	if req.Data != nil {
+		after["data_changed"] = true
 		// Check uniqueness within same category
 		var existing database.Account
-		if database.DB.Where("category_id = ? AND data = ? AND id != ?", account.CategoryID, *req.Data, account.ID).First(&existing).Error == nil {
+		if database.DB.Where("category_id = ? AND data_hash = ? AND id != ?", account.CategoryID, database.HashData(*req.Data), account.ID).First(&existing).Error == nil {
 			c.JSON(http.StatusConflict, gin.H{"error": "data already exists in this category"})
 			return
 		}
-		updates["data"] = *req.Data
+		var cat database.Category
+		database.DB.Select("id, account_schema").First(&cat, account.CategoryID)
+		dataUpdates, err := database.AccountDataUpdates(&cat, *req.Data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for k, v := range dataUpdates {
+			updates[k] = v
+		}
 	}
 	if req.Used != nil {
+		// A manual status change ends any pending cooldown
 		updates["used"] = *req.Used
+		updates["cooldown_until"] = nil
+		before["used"], after["used"] = account.Used, *req.Used
 	}
 	if req.Banned != nil {
 		updates["banned"] = *req.Banned
+		before["banned"], after["banned"] = account.Banned, *req.Banned
+	}
+	if req.UseCount != nil {
+		if *req.UseCount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use_count must not be negative"})
+			return
+		}
+		updates["use_count"] = *req.UseCount
+		before["use_count"], after["use_count"] = account.UseCount, *req.UseCount
 	}
 
-	if err := database.DB.Model(&account).Updates(updates).Error; err != nil {
+	states := database.StatesOf([]database.Account{account})
+	wasBanned := account.Banned
+	_, actor := auditActor(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&account).Updates(updates).Error; err != nil {
+			return err
+		}
+		return database.RecordAccountChanges(tx, states, database.HistorySource{Source: database.HistorySourceManual, Actor: actor})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, database.AuditAccountUpdate, account.CategoryID, fmt.Sprintf("account:%d", account.ID), before, after)
+	if req.Banned != nil && *req.Banned && !wasBanned {
+		go webhook.Emit(account.CategoryID, webhook.EventAccountBanned, gin.H{
+			"source": database.HistorySourceManual, "actor": actor, "account_ids": []uint{account.ID},
+		})
+	}
 	database.DB.First(&account, id)
 	c.JSON(http.StatusOK, account)
 }
@@ -391,7 +667,9 @@ func BatchUpdateAccounts(c *gin.Context) {
 
 	updates := map[string]interface{}{}
 	if req.Used != nil {
+		// A manual status change ends any pending cooldown
 		updates["used"] = *req.Used
+		updates["cooldown_until"] = nil
 	}
 	if req.Banned != nil {
 		updates["banned"] = *req.Banned
@@ -400,40 +678,65 @@ func BatchUpdateAccounts(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one field required"})
 		return
 	}
+	if denyAccounts(c, req.IDs) {
+		return
+	}
 
-	if err := database.DB.Model(&database.Account{}).Where("id IN ?", req.IDs).Updates(updates).Error; err != nil {
+	grouped := accountIDsByCategory(database.DB, req.IDs)
+	var newlyBanned map[uint][]uint
+	if req.Banned != nil && *req.Banned {
+		newlyBanned = accountIDsByCategory(database.DB.Where("banned = ?", false), req.IDs)
+	}
+	_, actor := auditActor(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := database.UpdateTrackedAccounts(tx, req.IDs, updates, database.HistorySource{Source: database.HistorySourceBatch, Actor: actor})
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for catID, ids := range grouped {
+		after := gin.H{"ids": ids}
+		if req.Used != nil {
+			after["used"] = *req.Used
+		}
+		if req.Banned != nil {
+			after["banned"] = *req.Banned
+		}
+		recordAudit(c, database.AuditAccountBatchUpdate, catID, categoryTarget(catID), nil, after)
+	}
+	for catID, ids := range newlyBanned {
+		go webhook.Emit(catID, webhook.EventAccountBanned, gin.H{
+			"source": database.HistorySourceBatch, "actor": actor, "account_ids": ids,
+		})
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
+// DeleteAccounts deletes a category's accounts (optionally only used or
+// banned ones) in batches, streaming progress over SSE. With ?async=true it
+// runs as a background job instead.
 func DeleteAccounts(c *gin.Context) {
-	var req struct {
-		CategoryID uint `json:"category_id" binding:"required"`
-		Used       bool `json:"used"`
-		Banned     bool `json:"banned"`
-	}
-
+	var req deleteAccountsParams
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Build condition
-	condition := "category_id = ?"
-	args := []interface{}{req.CategoryID}
-	if req.Used && req.Banned {
-		condition += " AND (used = ? OR banned = ?)"
-		args = append(args, true, true)
-	} else if req.Used {
-		condition += " AND used = ?"
-		args = append(args, true)
-	} else if req.Banned {
-		condition += " AND banned = ?"
-		args = append(args, true)
+	if denyCategory(c, req.CategoryID) {
+		return
+	}
+	if wantsAsync(c) {
+		if job := enqueueJob(c, jobs.TypeDeleteAccounts, req.CategoryID, req, nil); job != nil {
+			recordAudit(c, database.AuditAccountDelete, req.CategoryID, categoryTarget(req.CategoryID), nil,
+				gin.H{"used": req.Used, "banned": req.Banned, "job_id": job.ID})
+		}
+		return
 	}
 
+	condition, args := req.condition()
+
 	// Count total
 	var total int64
 	database.DB.Model(&database.Account{}).Where(condition, args...).Count(&total)
@@ -448,25 +751,87 @@ func DeleteAccounts(c *gin.Context) {
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
-	// Batch delete with progress
+	deleted, err := deleteAccountsInBatches(context.Background(), condition, args, total, func(deleted int64) {
+		c.SSEvent("progress", gin.H{"deleted": deleted, "total": total})
+		c.Writer.Flush()
+	})
+	recordAudit(c, database.AuditAccountDelete, req.CategoryID, categoryTarget(req.CategoryID), nil,
+		gin.H{"used": req.Used, "banned": req.Banned, "deleted": deleted})
+	if err != nil {
+		c.SSEvent("error", gin.H{"error": err.Error()})
+		return
+	}
+	c.SSEvent("done", gin.H{"deleted": deleted, "total": total})
+}
+
+type deleteAccountsParams struct {
+	CategoryID uint `json:"category_id" binding:"required"`
+	Used       bool `json:"used"`
+	Banned     bool `json:"banned"`
+}
+
+// condition builds the WHERE clause selecting the accounts to delete.
+func (p deleteAccountsParams) condition() (string, []interface{}) {
+	condition := "category_id = ?"
+	args := []interface{}{p.CategoryID}
+	if p.Used && p.Banned {
+		condition += " AND (used = ? OR banned = ?)"
+		args = append(args, true, true)
+	} else if p.Used {
+		condition += " AND used = ?"
+		args = append(args, true)
+	} else if p.Banned {
+		condition += " AND banned = ?"
+		args = append(args, true)
+	}
+	return condition, args
+}
+
+// deleteAccountsInBatches deletes up to total matching accounts 500 at a
+// time, calling progress after each batch, then removes tags left without an
+// account.
+func deleteAccountsInBatches(ctx context.Context, condition string, args []interface{}, total int64, progress func(deleted int64)) (int64, error) {
 	var deleted int64
 	batchSize := 500
 	for deleted < total {
+		if err := ctx.Err(); err != nil {
+			database.DeleteOrphanedTags(database.DB)
+			return deleted, err
+		}
 		result := database.DB.Where("id IN (?)",
 			database.DB.Model(&database.Account{}).Select("id").Where(condition, args...).Limit(batchSize),
 		).Delete(&database.Account{})
 		if result.Error != nil {
-			c.SSEvent("error", gin.H{"error": result.Error.Error()})
-			return
+			return deleted, result.Error
 		}
 		if result.RowsAffected == 0 {
 			break
 		}
 		deleted += result.RowsAffected
-		c.SSEvent("progress", gin.H{"deleted": deleted, "total": total})
-		c.Writer.Flush()
+		progress(deleted)
 	}
-	c.SSEvent("done", gin.H{"deleted": deleted, "total": total})
+	database.DeleteOrphanedTags(database.DB)
+	return deleted, nil
+}
+
+// runDeleteAccountsJob is the background form of DeleteAccounts.
+func runDeleteAccountsJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	var params deleteAccountsParams
+	if err := run.Params(&params); err != nil {
+		return nil, err
+	}
+	condition, args := params.condition()
+	var total int64
+	if err := database.DB.Model(&database.Account{}).Where(condition, args...).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	run.SetProgress(0, total)
+	run.Logf("Deleting %d accounts", total)
+	deleted, err := deleteAccountsInBatches(ctx, condition, args, total, func(deleted int64) {
+		run.SetProgress(deleted, total)
+	})
+	run.Logf("Deleted %d accounts", deleted)
+	return gin.H{"deleted": deleted, "total": total}, err
 }
 
 func DeleteAccountsByIds(c *gin.Context) {
@@ -481,10 +846,18 @@ func DeleteAccountsByIds(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "max 10000 IDs per request"})
 		return
 	}
+	if denyAccounts(c, req.IDs) {
+		return
+	}
+	grouped := accountIDsByCategory(database.DB, req.IDs)
+	// Tags stay with the trashed accounts until they are purged
 	if err := database.DB.Delete(&database.Account{}, req.IDs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for catID, ids := range grouped {
+		recordAudit(c, database.AuditAccountDelete, catID, categoryTarget(catID), nil, gin.H{"ids": ids, "deleted": len(ids)})
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "deleted", "count": len(req.IDs)})
 }
 
@@ -497,11 +870,14 @@ func GetAccountStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := database.DB.Model(&database.Account{}).Where("category_id = ? AND used = ? AND banned = ?", categoryID, false, false).Count(&availableCount).Error; err != nil {
+	now := time.Now()
+	availCond, availArgs := database.AvailableCondition("", now)
+	if err := database.DB.Model(&database.Account{}).Where("category_id = ?", categoryID).Where(availCond, availArgs...).Count(&availableCount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := database.DB.Model(&database.Account{}).Where("category_id = ? AND used = ? AND banned = ?", categoryID, true, false).Count(&usedCount).Error; err != nil {
+	usedCond, usedArgs := database.UsedCondition("", now)
+	if err := database.DB.Model(&database.Account{}).Where("category_id = ?", categoryID).Where(usedCond, usedArgs...).Count(&usedCount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -510,8 +886,23 @@ func GetAccountStats(c *gin.Context) {
 		return
 	}
 
+	var catID uint
+	fmt.Sscanf(categoryID, "%d", &catID)
+	remainingUses, err := database.RemainingUses(catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tagCounts, err := database.CountTags(catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"counts": gin.H{"total": totalCount, "available": availableCount, "used": usedCount, "banned": bannedCount},
+		"counts":   gin.H{"total": totalCount, "available": availableCount, "used": usedCount, "banned": bannedCount},
+		"capacity": gin.H{"max_uses": database.CategoryMaxUses(database.DB, catID), "remaining_uses": remainingUses},
+		"tags":     tagCounts,
 	})
 }
 
@@ -526,11 +917,14 @@ func GetGlobalStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := database.DB.Model(&database.Account{}).Where("used = ? AND banned = ?", false, false).Count(&stats.Available).Error; err != nil {
+	now := time.Now()
+	availCond, availArgs := database.AvailableCondition("", now)
+	if err := database.DB.Model(&database.Account{}).Where(availCond, availArgs...).Count(&stats.Available).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := database.DB.Model(&database.Account{}).Where("used = ? AND banned = ?", true, false).Count(&stats.Used).Error; err != nil {
+	usedCond, usedArgs := database.UsedCondition("", now)
+	if err := database.DB.Model(&database.Account{}).Where(usedCond, usedArgs...).Count(&stats.Used).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -544,10 +938,16 @@ func GetGlobalStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	remainingUses, err := database.RemainingUses(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"accounts":   stats,
-		"categories": categories,
+		"accounts":       stats,
+		"categories":     categories,
+		"remaining_uses": remainingUses,
 	})
 }
 
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"final-account-hub/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAccountHistory lists the status and data changes of an account, newest
+// first, optionally filtered by ?source. The history of a trashed account
+// stays readable until it is purged.
+func GetAccountHistory(c *gin.Context) {
+	// Registered as /accounts/:category_id/history because gin requires the
+	// wildcard name of the other GET /accounts routes; the value is the
+	// account ID
+	id := c.Param("category_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	var account database.Account
+	if err := database.DB.Unscoped().Select("id, category_id").First(&account, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+	if denyCategory(c, account.CategoryID) {
+		return
+	}
+
+	query := database.DB.Model(&database.AccountHistory{}).Where("account_id = ?", account.ID)
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var total int64
+	query.Count(&total)
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	var entries []database.AccountHistory
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries, "total": total, "page": page, "limit": limit})
+}
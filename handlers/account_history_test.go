@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+func TestAccountHistory_FetchAndManualUpdate(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{ID: 4, Name: "worker", Permissions: "admin"}
+	router.POST("/api/accounts/fetch", withToken(tok), FetchAccounts)
+	router.PUT("/api/accounts/:id", UpdateAccount)
+	router.GET("/api/accounts/:category_id/history", GetAccountHistory)
+	cat := testutil.SeedCategory(t, "timeline")
+	acc := testutil.SeedAccount(t, cat.ID, "user:pass")
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "count": 1}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/accounts/%d", acc.ID), testutil.MakeJSON(t, map[string]interface{}{"banned": true, "data": "user:new"}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	path := fmt.Sprintf("/api/accounts/%d/history", acc.ID)
+	w = testutil.DoRequest(router, http.MethodGet, path, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 2)
+	entries := testutil.GetJSONArray(resp, "data")
+	manual := entries[0].(map[string]interface{})
+	fetch := entries[1].(map[string]interface{})
+	testutil.AssertJSONField(t, manual, "source", database.HistorySourceManual)
+	testutil.AssertJSONField(t, manual, "actor", "passkey")
+	after := manual["after"].(map[string]interface{})
+	if after["banned"] != true || after["data_changed"] != true || after["data"] != nil {
+		t.Errorf("unexpected manual change %v", after)
+	}
+	testutil.AssertJSONField(t, fetch, "source", database.HistorySourceFetch)
+	testutil.AssertJSONField(t, fetch, "actor", "worker")
+	if fetch["after"].(map[string]interface{})["used"] != true {
+		t.Errorf("expected fetch to mark the account used, got %v", fetch["after"])
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, path+"?source=fetch", nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+	w = testutil.DoRequest(router, http.MethodGet, "/api/accounts/9999/history", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestAccountHistory_BatchUpdate(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/accounts/batch/update", BatchUpdateAccounts)
+	cat := testutil.SeedCategory(t, "batch-history")
+	a := testutil.SeedAccount(t, cat.ID, "a")
+	b := testutil.SeedAccountWithStatus(t, cat.ID, "b", false, true)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID}, "banned": true})
+	w := testutil.DoRequest(router, http.MethodPut, "/api/accounts/batch/update", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var entries []database.AccountHistory
+	database.DB.Find(&entries)
+	if len(entries) != 1 || entries[0].AccountID != a.ID || entries[0].Source != database.HistorySourceBatch {
+		t.Errorf("expected one batch entry for the account that changed, got %+v", entries)
+	}
+}
+
+func TestAccountHistory_TokenScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	cat := testutil.SeedCategory(t, "mine")
+	other := testutil.SeedCategory(t, "theirs")
+	acc := testutil.SeedAccount(t, other.ID, "x")
+	tok := &database.APIToken{Permissions: "read", CategoryIDs: fmt.Sprint(cat.ID)}
+	router.GET("/api/accounts/:category_id/history", withToken(tok), GetAccountHistory)
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/history", acc.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusForbidden)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -141,6 +142,116 @@ func TestAddAccountsBulk_Success(t *testing.T) {
 	testutil.AssertJSONField(t, data, "skipped", 0)
 }
 
+// seedSchemaCategory creates a category parsing "user:pass:age" data.
+func seedSchemaCategory(t *testing.T, name string) database.Category {
+	t.Helper()
+	cat := testutil.SeedCategory(t, name)
+	cat.AccountSchema = &database.AccountSchema{Format: "delimited", Delimiter: ":", Fields: []database.AccountField{
+		{Name: "user", Type: "string"}, {Name: "pass", Type: "string"}, {Name: "age", Type: "int"},
+	}}
+	if err := database.DB.Model(&cat).Select("account_schema").Updates(&cat).Error; err != nil {
+		t.Fatalf("failed to set schema: %v", err)
+	}
+	return cat
+}
+
+func TestAddAccount_ParsesFields(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts", AddAccount)
+
+	cat := seedSchemaCategory(t, "schema-add")
+	body := testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "data": "alice:pw:30"})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts", body, "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+
+	fields, ok := testutil.ParseJSON(t, w)["fields"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected fields object in response")
+	}
+	testutil.AssertJSONField(t, fields, "user", "alice")
+	testutil.AssertJSONField(t, fields, "pass", "pw")
+	testutil.AssertJSONField(t, fields, "age", 30)
+
+	body = testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "data": "bob:pw:old"})
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts", body, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestAddAccountsBulk_RejectsUnparsable(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/bulk", AddAccountsBulk)
+
+	cat := seedSchemaCategory(t, "schema-bulk")
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"category_id": cat.ID,
+		"data":        []string{"a:1:20", "b:2"},
+	})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/bulk", body, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+	if msg, _ := testutil.ParseJSON(t, w)["error"].(string); !strings.HasPrefix(msg, "data[1]") {
+		t.Errorf("expected error to name data[1], got %q", msg)
+	}
+
+	var count int64
+	database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected nothing inserted, got %d", count)
+	}
+}
+
+// enableEncryption turns on encryption at rest for the duration of the test.
+func enableEncryption(t *testing.T) {
+	t.Helper()
+	if err := database.SetEncryptionKeys("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="); err != nil {
+		t.Fatalf("failed to set encryption key: %v", err)
+	}
+	t.Cleanup(func() { database.SetEncryptionKeys("") })
+}
+
+func TestAccounts_DuplicateChecksWithEncryption(t *testing.T) {
+	testutil.SetupTestDB(t)
+	enableEncryption(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts", AddAccount)
+	router.POST("/api/accounts/bulk", AddAccountsBulk)
+	router.PUT("/api/accounts/:id", UpdateAccount)
+
+	cat := testutil.SeedCategory(t, "enc-dup")
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts", testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "data": "alice:pw"}), "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "data", "alice:pw")
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts", testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "data": "alice:pw"}), "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/bulk", testutil.MakeJSON(t, map[string]interface{}{
+		"category_id": cat.ID, "data": []string{"alice:pw", "bob:pw", "bob:pw"},
+	}), "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "count", 1)
+	testutil.AssertJSONField(t, data, "skipped", 2)
+
+	var bob database.Account
+	database.DB.Where("data_hash = ?", database.HashData("bob:pw")).First(&bob)
+	w = testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/accounts/%d", bob.ID), testutil.MakeJSON(t, map[string]interface{}{"data": "alice:pw"}), "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+
+	w = testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/accounts/%d", bob.ID), testutil.MakeJSON(t, map[string]interface{}{"data": "bob:new"}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "data", "bob:new")
+
+	var raw []string
+	database.DB.Model(&database.Account{}).Pluck("data", &raw)
+	for _, r := range raw {
+		if !strings.HasPrefix(r, "enc:v1:") {
+			t.Errorf("expected encrypted data at rest, got %q", r)
+		}
+	}
+}
+
 func TestAddAccountsBulk_WithDuplicates(t *testing.T) {
 	testutil.SetupTestDB(t)
 	router := testutil.SetupTestRouter()
@@ -822,6 +933,209 @@ func TestFetchAccounts_AccountTypeWithMarkAsUsed(t *testing.T) {
 	}
 }
 
+func TestFetchAccounts_MultiUse(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := testutil.SeedCategory(t, "fetch-multi-use")
+	database.DB.Model(&cat).Update("max_uses", 3)
+	acc := testutil.SeedAccount(t, cat.ID, "quota-key")
+
+	body := map[string]interface{}{"category_id": cat.ID, "count": 1}
+	for i := 1; i <= 3; i++ {
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusOK)
+		arr := testutil.ParseJSONArray(t, w)
+		if len(arr) != 1 {
+			t.Fatalf("fetch %d: expected the account to be handed out, got %d", i, len(arr))
+		}
+		testutil.AssertJSONField(t, arr[0], "use_count", i)
+		testutil.AssertJSONField(t, arr[0], "used", i == 3)
+	}
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	if arr := testutil.ParseJSONArray(t, w); len(arr) != 0 {
+		t.Errorf("expected exhausted account to be withheld, got %d", len(arr))
+	}
+
+	database.DB.First(&acc, acc.ID)
+	if acc.UseCount != 3 || !acc.Used || acc.LastUsedAt == nil {
+		t.Errorf("unexpected final state: use_count=%d used=%v last_used_at=%v", acc.UseCount, acc.Used, acc.LastUsedAt)
+	}
+}
+
+func TestFetchAccounts_CooldownRestsExhaustedAccount(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := testutil.SeedCategory(t, "fetch-cooldown")
+	database.DB.Model(&cat).Update("cooldown_seconds", 3600)
+	acc := testutil.SeedAccount(t, cat.ID, "resting")
+
+	body := map[string]interface{}{"category_id": cat.ID, "count": 1}
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != 1 || arr[0]["cooldown_until"] == nil {
+		t.Fatalf("expected one account with cooldown_until, got %v", arr)
+	}
+
+	database.DB.First(&acc, acc.ID)
+	if !acc.Used || acc.CooldownUntil == nil || acc.CooldownUntil.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("expected account to rest for an hour, got used=%v cooldown_until=%v", acc.Used, acc.CooldownUntil)
+	}
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	if arr := testutil.ParseJSONArray(t, w); len(arr) != 0 {
+		t.Errorf("expected resting account to be withheld, got %d", len(arr))
+	}
+}
+
+func TestFetchAccounts_ElapsedCooldownIsAvailable(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := testutil.SeedCategory(t, "fetch-cooled")
+	database.DB.Model(&cat).Updates(map[string]interface{}{"max_uses": 2, "cooldown_seconds": 3600})
+	acc := testutil.SeedAccountWithStatus(t, cat.ID, "rested", true, false)
+	past := time.Now().Add(-time.Minute)
+	database.DB.Model(&acc).Updates(map[string]interface{}{"use_count": 2, "cooldown_until": past})
+
+	body := map[string]interface{}{"category_id": cat.ID, "count": 1}
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != 1 {
+		t.Fatalf("expected rested account to be handed out, got %d", len(arr))
+	}
+	testutil.AssertJSONField(t, arr[0], "use_count", 1)
+	testutil.AssertJSONField(t, arr[0], "used", false)
+
+	var reloaded database.Account
+	database.DB.First(&reloaded, acc.ID)
+	if reloaded.UseCount != 1 || reloaded.Used || reloaded.CooldownUntil != nil {
+		t.Errorf("expected fresh quota, got use_count=%d used=%v cooldown_until=%v", reloaded.UseCount, reloaded.Used, reloaded.CooldownUntil)
+	}
+}
+
+func TestFetchAccounts_FieldFilter(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts", AddAccount)
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := seedSchemaCategory(t, "schema-fetch")
+	for _, d := range []string{"alice:x:30", "bob:y:40", "carol:z:30"} {
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts", testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "data": d}), "")
+		testutil.AssertStatus(t, w, http.StatusCreated)
+	}
+
+	body := map[string]interface{}{"category_id": cat.ID, "count": 10, "mark_as_used": false, "fields": map[string]interface{}{"age": 30}}
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if arr := testutil.ParseJSONArray(t, w); len(arr) != 2 {
+		t.Errorf("expected 2 accounts with age 30, got %d", len(arr))
+	}
+
+	body["fields"] = map[string]interface{}{"user": "bob", "age": "40"}
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != 1 || arr[0]["data"] != "bob:y:40" {
+		t.Errorf("expected only bob, got %v", arr)
+	}
+
+	for _, bad := range []map[string]interface{}{{"email": "x"}, {"age": "thirty"}} {
+		body["fields"] = bad
+		w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestFetchAccounts_FieldFilterWithEncryption(t *testing.T) {
+	testutil.SetupTestDB(t)
+	enableEncryption(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := seedSchemaCategory(t, "schema-encrypted")
+	body := map[string]interface{}{"category_id": cat.ID, "count": 1, "fields": map[string]interface{}{"user": "x"}}
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestFetchAccounts_FieldFilterWithoutSchema(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := testutil.SeedCategory(t, "schema-none")
+	body := map[string]interface{}{"category_id": cat.ID, "count": 1, "fields": map[string]interface{}{"user": "x"}}
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestFetchAccounts_ConcurrentNoDuplicates(t *testing.T) {
+	// File-backed DB so concurrent requests run on separate pooled connections
+	testutil.SetupFileTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+
+	cat := testutil.SeedCategory(t, "fetch-concurrent")
+	const total = 300
+	testutil.SeedAccounts(t, cat.ID, total, "cc")
+
+	for _, order := range []string{"sequential", "random"} {
+		database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Update("used", false)
+
+		const workers = 30
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		seen := make(map[uint]int)
+		failures := 0
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Each worker asks for more than its fair share so requests contend
+				body := testutil.MakeJSON(t, map[string]interface{}{
+					"category_id": cat.ID,
+					"count":       15,
+					"order":       order,
+				})
+				w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", body, "")
+				var accounts []database.Account
+				if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &accounts) != nil {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+					return
+				}
+				mu.Lock()
+				for _, acc := range accounts {
+					seen[acc.ID]++
+				}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		if failures > 0 {
+			t.Fatalf("%s: %d fetch requests failed", order, failures)
+		}
+		for id, n := range seen {
+			if n > 1 {
+				t.Errorf("%s: account %d handed out %d times", order, id, n)
+			}
+		}
+		if len(seen) != total {
+			t.Errorf("%s: expected all %d accounts to be claimed exactly once, got %d", order, total, len(seen))
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // UpdateAccount tests
 // ---------------------------------------------------------------------------
@@ -1249,6 +1563,53 @@ func TestGetAccountStats_Success(t *testing.T) {
 	testutil.AssertJSONField(t, counts, "banned", 1)
 }
 
+func TestGetAccountStats_MatchesAvailableFilter(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.GET("/api/accounts/:category_id/stats", GetAccountStats)
+
+	cat := testutil.SeedCategory(t, "stats-cooldown")
+	testutil.SeedAccount(t, cat.ID, "fresh")
+	rested := testutil.SeedAccountWithStatus(t, cat.ID, "rested", true, false)
+	resting := testutil.SeedAccountWithStatus(t, cat.ID, "resting", true, false)
+	database.DB.Model(&rested).Update("cooldown_until", time.Now().Add(-time.Minute))
+	database.DB.Model(&resting).Update("cooldown_until", time.Now().Add(time.Hour))
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/stats", cat.ID), nil, "")
+	counts := testutil.ParseJSON(t, w)["counts"].(map[string]interface{})
+	testutil.AssertJSONField(t, counts, "available", 2)
+	testutil.AssertJSONField(t, counts, "used", 1)
+
+	var filtered int64
+	applyAccountTypeFilter(database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID), []string{"available"}).Count(&filtered)
+	if filtered != 2 {
+		t.Errorf("expected the available filter to match the stats, got %d", filtered)
+	}
+}
+
+func TestGetAccountStats_RemainingUses(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.GET("/api/accounts/:category_id/stats", GetAccountStats)
+
+	cat := testutil.SeedCategory(t, "stats-capacity")
+	database.DB.Model(&cat).Update("max_uses", 5)
+	testutil.SeedAccount(t, cat.ID, "fresh")
+	partly := testutil.SeedAccount(t, cat.ID, "partly")
+	testutil.SeedAccountWithStatus(t, cat.ID, "done", true, false)
+	database.DB.Model(&partly).Update("use_count", 3)
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/stats", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	capacity, ok := testutil.ParseJSON(t, w)["capacity"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected capacity object in response")
+	}
+	testutil.AssertJSONField(t, capacity, "max_uses", 5)
+	testutil.AssertJSONField(t, capacity, "remaining_uses", 7) // 5 + (5-3)
+}
+
 func TestGetAccountStats_EmptyCategory(t *testing.T) {
 	testutil.SetupTestDB(t)
 	router := testutil.SetupTestRouter()
@@ -1681,6 +2042,28 @@ func TestApplyAccountTypeFilter_UsedAndBanned(t *testing.T) {
 	}
 }
 
+func TestApplyAccountTypeFilter_Cooldown(t *testing.T) {
+	testutil.SetupTestDB(t)
+
+	cat := testutil.SeedCategory(t, "filter-cooldown")
+	resting := testutil.SeedAccountWithStatus(t, cat.ID, "resting", true, false)
+	rested := testutil.SeedAccountWithStatus(t, cat.ID, "rested", true, false)
+	database.DB.Model(&resting).Update("cooldown_until", time.Now().Add(time.Hour))
+	database.DB.Model(&rested).Update("cooldown_until", time.Now().Add(-time.Minute))
+
+	var available []database.Account
+	applyAccountTypeFilter(database.DB.Where("category_id = ?", cat.ID), []string{"available"}).Find(&available)
+	if len(available) != 1 || available[0].Data != "rested" {
+		t.Errorf("expected only the rested account to be available, got %v", available)
+	}
+
+	var used []database.Account
+	applyAccountTypeFilter(database.DB.Where("category_id = ?", cat.ID), []string{"used"}).Find(&used)
+	if len(used) != 1 || used[0].Data != "resting" {
+		t.Errorf("expected only the resting account to be used, got %v", used)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Compile-time check: ensure unused imports don't cause issues
 // ---------------------------------------------------------------------------
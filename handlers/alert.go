@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"final-account-hub/database"
+	"final-account-hub/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAlerts lists stock alert state changes, newest first, together with the
+// categories currently in the low or empty state. Optional category_id and
+// state query parameters filter the history.
+func GetAlerts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	activeQuery := database.DB.Model(&database.Category{}).
+		Select("id, name, low_watermark, alert_state").
+		Where("alert_state IN ?", []string{database.AlertLow, database.AlertEmpty}).Order("id")
+	query := database.DB.Model(&database.Alert{})
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		activeQuery = activeQuery.Where("id IN ?", append(ids, 0))
+		query = query.Where("category_id IN ?", append(ids, 0))
+	}
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	if state := c.Query("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var active []database.Category
+	if err := activeQuery.Find(&active).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	activeList := make([]gin.H, 0, len(active))
+	for _, cat := range active {
+		activeList = append(activeList, gin.H{
+			"category_id":   cat.ID,
+			"name":          cat.Name,
+			"state":         cat.AlertState,
+			"low_watermark": cat.LowWatermark,
+		})
+	}
+
+	var total int64
+	query.Count(&total)
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+	offset := (page - 1) * limit
+
+	var alerts []database.Alert
+	query.Order("id DESC").Offset(offset).Limit(limit).Find(&alerts)
+	c.JSON(http.StatusOK, gin.H{"active": activeList, "data": alerts, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+func TestUpdateLowWatermark(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/low-watermark", UpdateLowWatermark)
+
+	cat := testutil.SeedCategory(t, "watermark")
+	testutil.SeedAccounts(t, cat.ID, 3, "w")
+	path := fmt.Sprintf("/api/categories/%d/low-watermark", cat.ID)
+
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"low_watermark": 5}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "alert_state", "low")
+
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"low_watermark": 3}), "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "alert_state", "ok")
+
+	for _, body := range []map[string]interface{}{{}, {"low_watermark": -1}} {
+		w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+	w = testutil.DoRequest(router, http.MethodPut, "/api/categories/999/low-watermark", testutil.MakeJSON(t, map[string]interface{}{"low_watermark": 1}), "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestFetchAccounts_RecordsAlert(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+	router.GET("/api/alerts", GetAlerts)
+
+	cat := testutil.SeedCategory(t, "drain")
+	database.DB.Model(&cat).Update("low_watermark", 2)
+	testutil.SeedAccounts(t, cat.ID, 2, "d")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "count": 2})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	// The check runs in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var count int64
+		database.DB.Model(&database.Alert{}).Count(&count)
+		if count > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected an alert after draining the pool")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/alerts", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "total", 1)
+	alert := testutil.GetJSONArray(data, "data")[0].(map[string]interface{})
+	testutil.AssertJSONField(t, alert, "from_state", "ok")
+	testutil.AssertJSONField(t, alert, "state", "empty")
+	active := testutil.GetJSONArray(data, "active")
+	if len(active) != 1 || active[0].(map[string]interface{})["name"] != "drain" {
+		t.Errorf("expected drain to be active, got %v", active)
+	}
+}
+
+func TestGetAlerts_Filters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.GET("/api/alerts", GetAlerts)
+
+	a := testutil.SeedCategory(t, "a")
+	b := testutil.SeedCategory(t, "b")
+	database.DB.Create(&database.Alert{CategoryID: a.ID, FromState: "ok", State: "low", Available: 1, LowWatermark: 5})
+	database.DB.Create(&database.Alert{CategoryID: a.ID, FromState: "low", State: "ok", Available: 9, LowWatermark: 5})
+	database.DB.Create(&database.Alert{CategoryID: b.ID, FromState: "ok", State: "empty", LowWatermark: 5})
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/alerts?category_id=%d", a.ID), nil, "")
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "total", 2)
+	if first := testutil.GetJSONArray(data, "data")[0].(map[string]interface{}); first["state"] != "ok" {
+		t.Errorf("expected newest first, got %v", first)
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/alerts?state=empty", nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"final-account-hub/database"
+	"final-account-hub/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordAudit stores who performed action on target. before and after hold
+// the changed values and may be nil. Account data is never passed in, so the
+// audit log does not hold secrets.
+func recordAudit(c *gin.Context, action string, categoryID uint, target string, before, after gin.H) {
+	tokenID, actor := auditActor(c)
+	database.RecordAudit(&database.AuditLog{
+		CategoryID: categoryID,
+		TokenID:    tokenID,
+		Actor:      actor,
+		IP:         c.ClientIP(),
+		Action:     action,
+		Target:     target,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// auditActor returns the ID and name of the caller's API token, or 0 and
+// "passkey" for the master PASSKEY.
+func auditActor(c *gin.Context) (uint, string) {
+	if t := middleware.TokenFromContext(c); t != nil {
+		return t.ID, t.Name
+	}
+	return 0, "passkey"
+}
+
+// categoryTarget names a category in audit entries.
+func categoryTarget(id uint) string {
+	return fmt.Sprintf("category:%d", id)
+}
+
+// tokenTarget names an API token in audit entries.
+func tokenTarget(id uint) string {
+	return fmt.Sprintf("token:%d", id)
+}
+
+// webhookTarget names a webhook in audit entries.
+func webhookTarget(id uint) string {
+	return fmt.Sprintf("webhook:%d", id)
+}
+
+// auditChangedKeys picks the keys of updates from the before and after views
+// of a record, so an update entry only shows what changed.
+func auditChangedKeys(updates map[string]interface{}, before, after gin.H) (gin.H, gin.H) {
+	b, a := gin.H{}, gin.H{}
+	for key := range updates {
+		b[key] = before[key]
+		a[key] = after[key]
+	}
+	return b, a
+}
+
+// auditCategoryUpdate records a settings change of old, taking the before
+// values of the settings in after from it. Nothing is recorded when the
+// category does not exist.
+func auditCategoryUpdate(c *gin.Context, old database.Category, after gin.H) {
+	if old.ID == 0 {
+		return
+	}
+	// Category JSON keys match the setting names used in after
+	raw, _ := json.Marshal(old)
+	var all map[string]interface{}
+	json.Unmarshal(raw, &all)
+	before := gin.H{}
+	for key := range after {
+		before[key] = all[key]
+	}
+	recordAudit(c, database.AuditCategoryUpdate, old.ID, categoryTarget(old.ID), before, after)
+}
+
+// accountIDsByCategory groups the IDs of accounts found by query by category
+// so bulk account changes are audited once per category.
+func accountIDsByCategory(query *gorm.DB, ids []uint) map[uint][]uint {
+	var rows []struct {
+		ID         uint
+		CategoryID uint
+	}
+	query.Model(&database.Account{}).Select("id, category_id").Where("id IN ?", ids).Order("id").Find(&rows)
+	grouped := map[uint][]uint{}
+	for _, row := range rows {
+		grouped[row.CategoryID] = append(grouped[row.CategoryID], row.ID)
+	}
+	return grouped
+}
+
+// GetAuditLogs lists audit entries newest first, filtered by ?category_id,
+// ?actor, ?action and the RFC3339 ?created_after and ?created_before.
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	createdAfter, createdBefore := c.Query("created_after"), c.Query("created_before")
+	timeFilters, err := parseTimeFilters(&createdAfter, &createdBefore, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Model(&database.AuditLog{})
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("category_id IN ?", ids)
+	}
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	for _, tf := range timeFilters {
+		query = query.Where(tf.condition, tf.value)
+	}
+
+	var total int64
+	query.Count(&total)
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	var entries []database.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries, "total": total, "page": page, "limit": limit})
+}
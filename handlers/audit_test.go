@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+	"final-account-hub/validator"
+)
+
+// auditEntries returns every audit entry, oldest first.
+func auditEntries(t *testing.T) []database.AuditLog {
+	t.Helper()
+	var entries []database.AuditLog
+	database.DB.Order("id").Find(&entries)
+	return entries
+}
+
+func TestAudit_CategoryLifecycle(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{ID: 7, Name: "ops", Permissions: "admin"}
+	router.POST("/api/categories", withToken(tok), CreateCategory)
+	router.PUT("/api/categories/:id/max-uses", UpdateMaxUses)
+	router.DELETE("/api/categories/:id", DeleteCategory)
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/categories", testutil.MakeJSON(t, map[string]string{"name": "audited"}), "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	catID := uint(testutil.ParseJSON(t, w)["id"].(float64))
+	path := fmt.Sprintf("/api/categories/%d", catID)
+
+	w = testutil.DoRequest(router, http.MethodPut, path+"/max-uses", testutil.MakeJSON(t, map[string]int{"max_uses": 3}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodDelete, path, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+	create, update, del := entries[0], entries[1], entries[2]
+	if create.Action != database.AuditCategoryCreate || create.Actor != "ops" || create.TokenID != 7 || create.After["name"] != "audited" {
+		t.Errorf("unexpected create entry %+v", create)
+	}
+	if update.Action != database.AuditCategoryUpdate || update.Actor != "passkey" || update.CategoryID != catID {
+		t.Errorf("unexpected update entry %+v", update)
+	}
+	if update.Before["max_uses"] != float64(1) || update.After["max_uses"] != float64(3) {
+		t.Errorf("expected max_uses 1 -> 3, got %v -> %v", update.Before, update.After)
+	}
+	if del.Action != database.AuditCategoryDelete || del.Before["name"] != "audited" || del.Target != fmt.Sprintf("category:%d", catID) {
+		t.Errorf("unexpected delete entry %+v", del)
+	}
+}
+
+func TestAudit_ValidationScriptEdit(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/validation-script", UpdateCategoryValidationScript)
+	cat := testutil.SeedCategory(t, "scripted")
+	database.DB.Model(&cat).Update("validation_script", "old")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"validation_script": "new", "validation_cron": "0 * * * *"})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/validation-script", cat.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Before["validation_script"] != "old" || e.After["validation_script"] != "new" {
+		t.Errorf("expected script old -> new, got %v -> %v", e.Before["validation_script"], e.After["validation_script"])
+	}
+	if e.Before["validation_cron"] != "0 0 * * *" || e.After["validation_cron"] != "0 * * * *" {
+		t.Errorf("expected cron change recorded, got %v -> %v", e.Before["validation_cron"], e.After["validation_cron"])
+	}
+}
+
+func TestAudit_AccountChangesOmitData(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/accounts/:id", UpdateAccount)
+	router.PUT("/api/accounts/batch/update", BatchUpdateAccounts)
+	router.DELETE("/api/accounts/by-ids", DeleteAccountsByIds)
+	cat1 := testutil.SeedCategory(t, "one")
+	cat2 := testutil.SeedCategory(t, "two")
+	a := testutil.SeedAccount(t, cat1.ID, "secret:1")
+	b := testutil.SeedAccount(t, cat2.ID, "secret:2")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"data": "secret:3", "banned": true})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/accounts/%d", a.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	body = testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID}, "used": true})
+	w = testutil.DoRequest(router, http.MethodPut, "/api/accounts/batch/update", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	body = testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID}})
+	w = testutil.DoRequest(router, http.MethodDelete, "/api/accounts/by-ids", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 5 {
+		t.Fatalf("expected 1 update, 2 batch update and 2 delete entries, got %d", len(entries))
+	}
+	update := entries[0]
+	if update.Action != database.AuditAccountUpdate || update.Before["banned"] != false || update.After["banned"] != true || update.After["data_changed"] != true {
+		t.Errorf("unexpected update entry %+v", update)
+	}
+	perCategory := map[string]int{}
+	for _, e := range entries {
+		perCategory[fmt.Sprintf("%s/%d", e.Action, e.CategoryID)]++
+		for _, values := range []map[string]interface{}{e.Before, e.After} {
+			if strings.Contains(fmt.Sprint(values), "secret") {
+				t.Errorf("audit entry %s contains account data: %v", e.Action, values)
+			}
+		}
+	}
+	for _, key := range []string{
+		fmt.Sprintf("%s/%d", database.AuditAccountBatchUpdate, cat1.ID),
+		fmt.Sprintf("%s/%d", database.AuditAccountBatchUpdate, cat2.ID),
+		fmt.Sprintf("%s/%d", database.AuditAccountDelete, cat1.ID),
+		fmt.Sprintf("%s/%d", database.AuditAccountDelete, cat2.ID),
+	} {
+		if perCategory[key] != 1 {
+			t.Errorf("expected one %s entry, got %d", key, perCategory[key])
+		}
+	}
+}
+
+func TestAudit_TokenChanges(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/tokens", CreateToken)
+	router.PUT("/api/tokens/:id", UpdateToken)
+	router.DELETE("/api/tokens/:id", DeleteToken)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"name": "ci", "permissions": []string{"read"}})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/tokens", body, "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	created := testutil.ParseJSON(t, w)
+	path := fmt.Sprintf("/api/tokens/%v", created["id"])
+	body = testutil.MakeJSON(t, map[string]interface{}{"permissions": []string{"read", "admin"}})
+	w = testutil.DoRequest(router, http.MethodPut, path, body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodDelete, path, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+	create, update, del := entries[0], entries[1], entries[2]
+	target := fmt.Sprintf("token:%v", created["id"])
+	if create.Action != database.AuditTokenCreate || create.Target != target || create.After["name"] != "ci" {
+		t.Errorf("unexpected create entry %+v", create)
+	}
+	if update.Action != database.AuditTokenUpdate || fmt.Sprint(update.Before) != "map[permissions:[read]]" || fmt.Sprint(update.After) != "map[permissions:[read admin]]" {
+		t.Errorf("expected permissions read -> read,admin, got %v -> %v", update.Before, update.After)
+	}
+	if del.Action != database.AuditTokenDelete || fmt.Sprint(del.Before["permissions"]) != "[read admin]" {
+		t.Errorf("unexpected delete entry %+v", del)
+	}
+	for _, e := range entries {
+		if strings.Contains(fmt.Sprint(e.Before, e.After), created["token"].(string)) {
+			t.Errorf("audit entry %s contains the token", e.Action)
+		}
+	}
+}
+
+func TestAudit_WebhookChanges(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/webhooks", CreateWebhook)
+	router.PUT("/api/webhooks/:id", UpdateWebhook)
+	router.DELETE("/api/webhooks/:id", DeleteWebhook)
+	cat := testutil.SeedCategory(t, "hooked")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "url": "https://example.com/a", "secret": "s3cret", "events": []string{"account.banned"}})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/webhooks", body, "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	path := fmt.Sprintf("/api/webhooks/%v", testutil.ParseJSON(t, w)["id"])
+	body = testutil.MakeJSON(t, map[string]interface{}{"enabled": false, "secret": "n3w"})
+	w = testutil.DoRequest(router, http.MethodPut, path, body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodDelete, path, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+	create, update, del := entries[0], entries[1], entries[2]
+	if create.Action != database.AuditWebhookCreate || create.CategoryID != cat.ID || create.After["url"] != "https://example.com/a" {
+		t.Errorf("unexpected create entry %+v", create)
+	}
+	if update.Action != database.AuditWebhookUpdate || update.Before["enabled"] != true || update.After["enabled"] != false || update.After["secret_changed"] != true {
+		t.Errorf("unexpected update entry %+v", update)
+	}
+	if del.Action != database.AuditWebhookDelete || del.Before["url"] != "https://example.com/a" {
+		t.Errorf("unexpected delete entry %+v", del)
+	}
+	for _, e := range entries {
+		if values := fmt.Sprint(e.Before, e.After); strings.Contains(values, "s3cret") || strings.Contains(values, "n3w") {
+			t.Errorf("audit entry %s contains the secret: %s", e.Action, values)
+		}
+	}
+}
+
+func TestAudit_BackupImport(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	router := setupBackupRouter()
+	cat := testutil.SeedCategory(t, "backed-up")
+	testutil.SeedAccounts(t, cat.ID, 2, "acc")
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodPost, "/api/import?mode=replace", bytes.NewReader(w.Body.Bytes()), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	entries := auditEntries(t)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	imported, _ := e.After["imported"].(map[string]interface{})
+	if e.Action != database.AuditBackupImport || e.After["mode"] != "replace" || imported["accounts"] != float64(2) {
+		t.Errorf("unexpected import entry %+v", e)
+	}
+}
+
+func TestGetAuditLogs_Filters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.GET("/api/audit", GetAuditLogs)
+	database.DB.Create(&database.AuditLog{CategoryID: 1, Actor: "passkey", Action: database.AuditCategoryCreate})
+	database.DB.Create(&database.AuditLog{CategoryID: 1, Actor: "ops", Action: database.AuditCategoryUpdate})
+	database.DB.Create(&database.AuditLog{CategoryID: 2, Actor: "ops", Action: database.AuditAccountDelete})
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/audit", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 3)
+	first := testutil.GetJSONArray(resp, "data")[0].(map[string]interface{})
+	testutil.AssertJSONField(t, first, "action", database.AuditAccountDelete)
+
+	cases := map[string]int{
+		"?category_id=1":                       2,
+		"?actor=ops":                           2,
+		"?actor=ops&action=category.update":    1,
+		"?created_after=2000-01-01T00:00:00Z":  3,
+		"?created_before=2000-01-01T00:00:00Z": 0,
+	}
+	for query, want := range cases {
+		w := testutil.DoRequest(router, http.MethodGet, "/api/audit"+query, nil, "")
+		testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", want)
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/audit?created_after=yesterday", nil, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestGetAuditLogs_TokenScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{Permissions: "admin", CategoryIDs: "1"}
+	router.GET("/api/audit", withToken(tok), GetAuditLogs)
+	database.DB.Create(&database.AuditLog{CategoryID: 1, Action: database.AuditCategoryUpdate})
+	database.DB.Create(&database.AuditLog{CategoryID: 2, Action: database.AuditCategoryUpdate})
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/audit", nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+}
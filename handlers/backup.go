@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/logger"
+	"final-account-hub/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportBackup streams a gzip-compressed backup archive. The optional
+// ?include=runs,history,snapshots adds validation runs, API call history and
+// snapshots to the categories and accounts that are always included.
+func ExportBackup(c *gin.Context) {
+	var opts database.BackupOptions
+	for _, part := range strings.Split(c.Query("include"), ",") {
+		switch strings.TrimSpace(part) {
+		case "":
+		case "runs":
+			opts.Runs = true
+		case "history":
+			opts.History = true
+		case "snapshots":
+			opts.Snapshots = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "include must be a list of runs, history, snapshots"})
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("account-hub-%s.jsonl.gz", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	gz := gzip.NewWriter(c.Writer)
+	if err := database.ExportBackup(gz, opts); err != nil {
+		// Headers are already sent; the missing footer marks the archive as incomplete
+		logger.Error.Printf("Backup export failed: %v", err)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		logger.Error.Printf("Backup export failed: %v", err)
+	}
+}
+
+// ImportBackup restores an archive from the request body or a multipart
+// "file" field, gzip-compressed or not. ?mode=replace deletes all categories
+// first; the default mode=merge keeps them and skips duplicate accounts.
+func ImportBackup(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "merge")
+	if mode != "merge" && mode != "replace" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be merge or replace"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	br := bufio.NewReader(body)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	result, err := database.ImportBackup(r, mode == "replace")
+	if errors.Is(err, database.ErrTrashedCategoryName) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	validator.ReloadAllJobs()
+	recordAudit(c, database.AuditBackupImport, 0, "backup", nil, gin.H{"mode": mode, "imported": result})
+
+	logger.Info.Printf("Backup imported (%s): %+v", mode, result)
+	c.JSON(http.StatusOK, gin.H{"mode": mode, "imported": result})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+	"final-account-hub/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupBackupRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.GET("/api/export", ExportBackup)
+	router.POST("/api/import", ImportBackup)
+	return router
+}
+
+func TestExportBackup_Gzip(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupBackupRouter()
+	cat := testutil.SeedCategory(t, "export")
+	testutil.SeedAccounts(t, cat.ID, 3, "acc")
+	testutil.SeedValidationRun(t, cat.ID, "success")
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export?include=runs", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".jsonl.gz") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("expected gzip body: %v", err)
+	}
+	raw, _ := io.ReadAll(gz)
+	archive := string(raw)
+	if strings.Count(archive, `"type":"account"`) != 3 || !strings.Contains(archive, `"type":"validation_run"`) {
+		t.Errorf("unexpected archive contents:\n%s", archive)
+	}
+	if !strings.Contains(archive, `"type":"footer"`) {
+		t.Error("expected footer record")
+	}
+}
+
+func TestExportBackup_InvalidInclude(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupBackupRouter()
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export?include=tokens", nil, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestImportBackup_ReplaceReloadsJobs(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	router := setupBackupRouter()
+	cat := testutil.SeedCategory(t, "scheduled")
+	database.DB.Model(&cat).Updates(map[string]interface{}{
+		"validation_script":  "print('ok')",
+		"validation_cron":    "0 * * * *",
+		"validation_enabled": true,
+	})
+	testutil.SeedAccounts(t, cat.ID, 2, "acc")
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	archive := w.Body.Bytes()
+
+	testutil.SeedCategory(t, "extra")
+	w = testutil.DoRequest(router, http.MethodPost, "/api/import?mode=replace", bytes.NewReader(archive), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	imported, _ := data["imported"].(map[string]interface{})
+	if imported["categories"] != float64(1) || imported["accounts"] != float64(2) {
+		t.Errorf("unexpected import result %v", data)
+	}
+
+	var count int64
+	database.DB.Model(&database.Category{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected 1 category after replace, got %d", count)
+	}
+	found := false
+	for _, job := range validator.ScheduledJobs() {
+		if strings.HasPrefix(job.Name, "validation:") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected validation job to be scheduled after import")
+	}
+}
+
+func TestImportBackup_MultipartMerge(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	router := setupBackupRouter()
+	cat := testutil.SeedCategory(t, "merge")
+	testutil.SeedAccounts(t, cat.ID, 2, "acc")
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export", nil, "")
+	archive := w.Body.Bytes()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "backup.jsonl.gz")
+	part.Write(archive)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "mode", "merge")
+	imported, _ := data["imported"].(map[string]interface{})
+	if imported["skipped"] != float64(2) || imported["accounts"] != float64(0) {
+		t.Errorf("expected duplicates to be skipped, got %v", imported)
+	}
+}
+
+func TestImportBackup_TrashedCategoryConflict(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupBackupRouter()
+	cat := testutil.SeedCategory(t, "trashed")
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/export", nil, "")
+	archive := w.Body.Bytes()
+	database.DB.Delete(&cat)
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/import", bytes.NewReader(archive), "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+	if !strings.Contains(testutil.ParseJSON(t, w)["error"].(string), "in the trash") {
+		t.Error("expected the trashed name error")
+	}
+}
+
+func TestImportBackup_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupBackupRouter()
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/import?mode=wipe", strings.NewReader("{}"), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/import", strings.NewReader(`{"type":"header","version":1}`), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+	if !strings.Contains(testutil.ParseJSON(t, w)["error"].(string), "truncated") {
+		t.Error("expected truncated archive error")
+	}
+}
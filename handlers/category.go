@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/middleware"
 	"final-account-hub/validator"
 
 	"github.com/gin-gonic/gin"
@@ -30,12 +32,16 @@ func CreateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if denyTrashedName(c, req.Name) {
+		return
+	}
 
 	category := database.Category{Name: req.Name}
 	if err := database.DB.Create(&category).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, database.AuditCategoryCreate, category.ID, categoryTarget(category.ID), nil, gin.H{"name": category.Name})
 
 	c.JSON(http.StatusCreated, category)
 }
@@ -49,15 +55,24 @@ func CreateCategoryIfNotExists(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if denyTrashedName(c, req.Name) {
+		return
+	}
 
 	var category database.Category
-	database.DB.FirstOrCreate(&category, database.Category{Name: req.Name})
+	if database.DB.FirstOrCreate(&category, database.Category{Name: req.Name}).RowsAffected > 0 {
+		recordAudit(c, database.AuditCategoryCreate, category.ID, categoryTarget(category.ID), nil, gin.H{"name": category.Name})
+	}
 	c.JSON(http.StatusOK, category)
 }
 
 func GetCategories(c *gin.Context) {
 	var categories []database.Category
-	database.DB.Order("id").Find(&categories)
+	query := database.DB.Order("id")
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("id IN ?", append(ids, 0))
+	}
+	query.Find(&categories)
 	c.JSON(http.StatusOK, categories)
 }
 
@@ -65,20 +80,23 @@ func DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
 	var catID uint
 	fmt.Sscanf(id, "%d", &catID)
+	var old database.Category
+	database.DB.Select("id, name").First(&old, catID)
 
+	// The category and its accounts stay in the trash until PurgeTrash
+	// removes them with their history
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("category_id = ?", id).Delete(&database.Account{}).Error; err != nil {
-			return err
-		}
-		return tx.Delete(&database.Category{}, id).Error
+		return database.TrashCategory(tx, catID)
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	validator.ReloadJobForCategory(catID)
 
-	// Clean up snapshots outside transaction (non-critical)
-	go database.CleanupSnapshotsForCategory(catID)
+	if old.ID != 0 {
+		recordAudit(c, database.AuditCategoryDelete, catID, categoryTarget(catID), gin.H{"name": old.Name}, nil)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
@@ -91,6 +109,12 @@ func UpdateCategoryValidationScript(c *gin.Context) {
 		ValidationCron        string `json:"validation_cron"`
 		ValidationEnabled     *bool  `json:"validation_enabled"`
 		ValidationScope       string `json:"validation_scope"`
+		ValidationMode        string `json:"validation_mode"`
+		ValidationAsyncLimit  *int   `json:"validation_async_limit"`
+		ValidationBatchSize   *int   `json:"validation_batch_size"`
+		AccountTimeoutSeconds *int   `json:"account_timeout_seconds"`
+		BatchTimeoutSeconds   *int   `json:"batch_timeout_seconds"`
+		RunDeadlineMinutes    *int   `json:"run_deadline_minutes"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -118,6 +142,10 @@ func UpdateCategoryValidationScript(c *gin.Context) {
 	} else {
 		req.ValidationScope = "available,used"
 	}
+	if req.ValidationMode != "" && req.ValidationMode != database.ValidationModeBatch && req.ValidationMode != database.ValidationModePool {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_mode must be batch or pool"})
+		return
+	}
 
 	updates := map[string]interface{}{
 		"validation_script":      req.ValidationScript,
@@ -128,18 +156,318 @@ func UpdateCategoryValidationScript(c *gin.Context) {
 	if req.ValidationEnabled != nil {
 		updates["validation_enabled"] = *req.ValidationEnabled
 	}
+	if req.ValidationMode != "" {
+		updates["validation_mode"] = req.ValidationMode
+	}
+	if req.ValidationAsyncLimit != nil {
+		updates["validation_async_limit"] = min(max(*req.ValidationAsyncLimit, 1), 500)
+	}
+	if req.ValidationBatchSize != nil {
+		updates["validation_batch_size"] = min(max(*req.ValidationBatchSize, 1), 1000)
+	}
+	if req.AccountTimeoutSeconds != nil {
+		updates["account_timeout_seconds"] = min(max(*req.AccountTimeoutSeconds, 1), 3600)
+	}
+	// Zero batch timeout derives it from the batch size; zero deadline means none
+	if req.BatchTimeoutSeconds != nil {
+		updates["batch_timeout_seconds"] = min(max(*req.BatchTimeoutSeconds, 0), 86400)
+	}
+	if req.RunDeadlineMinutes != nil {
+		updates["run_deadline_minutes"] = min(max(*req.RunDeadlineMinutes, 0), 10080)
+	}
 
-	if err := database.DB.Model(&database.Category{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+	var old database.Category
+	database.DB.First(&old, id)
+	_, author := auditActor(c)
+	var rev database.ScriptRevision
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.Category{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return nil
+		}
+		// A script saved before revisions were kept becomes the first one
+		if _, _, err := database.SaveScriptRevision(tx, old.ID, old.ValidationScript, "", ""); err != nil {
+			return err
+		}
+		var err error
+		rev, _, err = database.SaveScriptRevision(tx, old.ID, req.ValidationScript, author, "")
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditCategoryUpdate(c, old, updates)
 	// Reload cron job
 	var catID uint
 	fmt.Sscanf(id, "%d", &catID)
 	validator.ReloadJobForCategory(catID)
+	c.JSON(http.StatusOK, gin.H{"message": "updated", "script_revision": rev.Revision})
+}
+
+// UpdateMaxUses sets how many times each account in the category can be
+// fetched. Available accounts already at or past the new limit are marked used.
+func UpdateMaxUses(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		MaxUses int `json:"max_uses"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MaxUses < 1 {
+		req.MaxUses = 1
+	}
+
+	var old database.Category
+	if err := database.DB.First(&old, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	_, actor := auditActor(c)
+	source := database.HistorySource{Source: database.HistorySourceSettings, Actor: actor}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.Category{}).Where("id = ?", old.ID).Update("max_uses", req.MaxUses).Error; err != nil {
+			return err
+		}
+		if req.MaxUses > old.MaxUses {
+			// Accounts the old limit exhausted have uses left again; resting
+			// accounts come back when their cooldown ends.
+			var freed []uint
+			if err := tx.Model(&database.Account{}).
+				Where("category_id = ? AND used = ? AND banned = ? AND lease_id IS NULL AND cooldown_until IS NULL AND use_count >= ? AND use_count < ?",
+					old.ID, true, false, old.MaxUses, req.MaxUses).
+				Pluck("id", &freed).Error; err != nil {
+				return err
+			}
+			_, err := database.UpdateTrackedAccounts(tx, freed, map[string]interface{}{"used": false}, source)
+			return err
+		}
+		updates := map[string]interface{}{"used": true}
+		if cooldown := database.CategoryUsagePolicy(tx, old.ID).Cooldown; cooldown > 0 {
+			updates["cooldown_until"] = time.Now().Add(cooldown)
+		}
+		var exhausted []uint
+		if err := tx.Model(&database.Account{}).
+			Where("category_id = ? AND used = ? AND lease_id IS NULL AND use_count >= ?", old.ID, false, req.MaxUses).
+			Pluck("id", &exhausted).Error; err != nil {
+			return err
+		}
+		_, err := database.UpdateTrackedAccounts(tx, exhausted, updates, source)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"max_uses": req.MaxUses})
+	c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// UpdateCooldown sets how long exhausted accounts rest before they return to
+// the available pool. 0 disables the cooldown; accounts already resting keep
+// their current deadline.
+func UpdateCooldown(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		CooldownSeconds *int `json:"cooldown_seconds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.CooldownSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cooldown_seconds must not be negative"})
+		return
+	}
+
+	var old database.Category
+	database.DB.First(&old, id)
+	if err := database.DB.Model(&database.Category{}).Where("id = ?", id).Update("cooldown_seconds", *req.CooldownSeconds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"cooldown_seconds": *req.CooldownSeconds})
+	c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// UpdateTrashRetention sets how many days deleted accounts of the category,
+// or the category itself, stay in the trash before they are purged.
+func UpdateTrashRetention(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		TrashRetentionDays *int `json:"trash_retention_days" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.TrashRetentionDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "trash_retention_days must not be negative"})
+		return
+	}
+
+	var old database.Category
+	database.DB.First(&old, id)
+	if err := database.DB.Model(&database.Category{}).Where("id = ?", id).Update("trash_retention_days", *req.TrashRetentionDays).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"trash_retention_days": *req.TrashRetentionDays})
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
+// UpdateLowWatermark sets the available-account threshold below which the
+// category raises a stock alert (0 disables alerts) and re-evaluates its
+// alert state right away.
+func UpdateLowWatermark(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		LowWatermark *int `json:"low_watermark" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.LowWatermark < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "low_watermark must not be negative"})
+		return
+	}
+
+	var cat database.Category
+	if err := database.DB.First(&cat, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	old := cat
+	if err := database.DB.Model(&cat).Update("low_watermark", *req.LowWatermark).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"low_watermark": *req.LowWatermark})
+	database.CheckAlert(cat.ID)
+	database.DB.Select("alert_state").First(&cat, cat.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "updated", "alert_state": cat.AlertState})
+}
+
+// UpdateAccountSchema sets how account data in the category is parsed into
+// structured fields and re-parses existing accounts, trashed ones included.
+// A null schema removes the structured fields. Accounts that do not match the
+// schema keep their data but lose their fields; the response reports how many
+// failed. With ?async=true the re-parse runs as a background job.
+func UpdateAccountSchema(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		AccountSchema *database.AccountSchema `json:"account_schema"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AccountSchema != nil {
+		if err := req.AccountSchema.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var cat database.Category
+	if err := database.DB.First(&cat, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	old := cat
+	cat.AccountSchema = req.AccountSchema
+	if err := database.DB.Model(&cat).Select("account_schema").Updates(&cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"account_schema": req.AccountSchema})
+
+	if wantsAsync(c) {
+		enqueueJob(c, jobs.TypeReparseAccounts, cat.ID, nil, nil)
+		return
+	}
+	parsed, failed, err := reparseAccountFields(context.Background(), cat, func(int64) {})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "updated", "parsed": parsed, "failed": failed})
+}
+
+// reparseAccountFields re-parses the fields of every account in the category,
+// trashed ones included, with cat's schema. Each batch commits on its own, so
+// fetches and validation are not blocked for the whole category.
+func reparseAccountFields(ctx context.Context, cat database.Category, progress func(done int64)) (parsed, failed int, err error) {
+	const batchSize = 500
+	var lastID uint
+	var done int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return parsed, failed, err
+		}
+		var batch []database.Account
+		if err := database.DB.Unscoped().Select("id, data").Where("category_id = ? AND id > ?", cat.ID, lastID).
+			Order("id").Limit(batchSize).Find(&batch).Error; err != nil {
+			return parsed, failed, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, acc := range batch {
+				fields, err := cat.ParseFields(acc.Data)
+				if err != nil {
+					failed++
+				} else if fields != nil {
+					parsed++
+				}
+				encoded, err := database.EncodeFields(fields)
+				if err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Model(&database.Account{}).Where("id = ?", acc.ID).
+					UpdateColumn("fields", encoded).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return parsed, failed, err
+		}
+		done += int64(len(batch))
+		progress(done)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	return parsed, failed, nil
+}
+
+// runReparseAccountsJob is the background form of the re-parse in
+// UpdateAccountSchema. It uses the category's schema at the time it runs.
+func runReparseAccountsJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	var cat database.Category
+	if err := database.DB.First(&cat, run.CategoryID()).Error; err != nil {
+		return nil, err
+	}
+	var total int64
+	database.DB.Unscoped().Model(&database.Account{}).Where("category_id = ?", cat.ID).Count(&total)
+	run.SetProgress(0, total)
+	run.Logf("Re-parsing %d accounts", total)
+	parsed, failed, err := reparseAccountFields(ctx, cat, func(done int64) {
+		run.SetProgress(done, total)
+	})
+	run.Logf("Parsed %d accounts, %d failed", parsed, failed)
+	return gin.H{"parsed": parsed, "failed": failed}, err
+}
+
 func GetCategory(c *gin.Context) {
 	id := c.Param("id")
 	var category database.Category
@@ -225,7 +553,7 @@ func GetValidationRuns(c *gin.Context) {
 	offset := (page - 1) * limit
 
 	var runs []database.ValidationRun
-	database.DB.Select("id, category_id, status, total_count, processed_count, used_count, banned_count, error_message, started_at, finished_at").
+	database.DB.Select("id, category_id, status, total_count, processed_count, used_count, banned_count, cursor, last_account_id, resume_count, script_revision, error_message, started_at, finished_at").
 		Where("category_id = ?", id).Order("started_at desc").Offset(offset).Limit(limit).Find(&runs)
 	c.JSON(http.StatusOK, gin.H{"data": runs, "total": total, "page": page, "limit": limit})
 }
@@ -240,7 +568,7 @@ func DeleteValidationRuns(c *gin.Context) {
 		return
 	}
 	// Exclude running and stopping records from deletion
-	result := database.DB.Where("id IN ? AND category_id = ? AND status NOT IN ?", req.IDs, id, []string{"running", "stopping"}).
+	result := database.DB.Where("id IN ? AND category_id = ? AND status NOT IN ?", req.IDs, id, []string{database.RunStatusRunning, database.RunStatusStopping}).
 		Delete(&database.ValidationRun{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
@@ -268,6 +596,25 @@ func StopValidation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "validation stopped"})
 }
 
+// ResumeValidationRun continues a stopped or interrupted run after the last
+// batch it checkpointed.
+func ResumeValidationRun(c *gin.Context) {
+	id := c.Param("run_id")
+	var run database.ValidationRun
+	if err := database.DB.Select("id, category_id").First(&run, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+		return
+	}
+	if denyCategory(c, run.CategoryID) {
+		return
+	}
+	if err := validator.ResumeRun(run.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "validation resumed"})
+}
+
 func GetValidationRunLog(c *gin.Context) {
 	id := c.Param("run_id")
 	var run database.ValidationRun
@@ -275,6 +622,9 @@ func GetValidationRunLog(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
 		return
 	}
+	if denyCategory(c, run.CategoryID) {
+		return
+	}
 
 	// Empty log boundary: return early to avoid splitting "" into [""]
 	if run.Log == "" {
@@ -309,14 +659,16 @@ func getVenvPath(categoryID string) string {
 	return fmt.Sprintf("./data/venvs/%s", categoryID)
 }
 
-func ensureVenv(categoryID string) error {
+// ensureVenv creates the category's virtual environment if it does not
+// exist yet. Creation is limited to 5 minutes.
+func ensureVenv(ctx context.Context, categoryID string) error {
 	venvPath := getVenvPath(categoryID)
 	pythonPath := venvPath + "/bin/python"
 	if _, err := os.Stat(pythonPath); os.IsNotExist(err) {
 		if err := os.MkdirAll("./data/venvs", 0755); err != nil {
 			return fmt.Errorf("failed to create venvs directory: %s", err)
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 		defer cancel()
 		cmd := exec.CommandContext(ctx, "uv", "venv", venvPath, "--python", "3.12")
 		output, err := cmd.CombinedOutput()
@@ -327,9 +679,22 @@ func ensureVenv(categoryID string) error {
 	return nil
 }
 
+// installPackages runs "uv pip install" with args in the category's venv,
+// creating the venv first. The install is limited to 5 minutes.
+func installPackages(ctx context.Context, categoryID string, args ...string) (string, error) {
+	if err := ensureVenv(ctx, categoryID); err != nil {
+		return err.Error(), err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	cmdArgs := append([]string{"pip", "install", "--python", getVenvPath(categoryID) + "/bin/python"}, args...)
+	output, err := exec.CommandContext(ctx, "uv", cmdArgs...).CombinedOutput()
+	return string(output), err
+}
+
 func GetUVPackages(c *gin.Context) {
 	id := c.Param("id")
-	if err := ensureVenv(id); err != nil {
+	if err := ensureVenv(context.Background(), id); err != nil {
 		c.JSON(http.StatusOK, gin.H{"packages": []interface{}{}})
 		return
 	}
@@ -344,11 +709,11 @@ func GetUVPackages(c *gin.Context) {
 	c.Data(http.StatusOK, "application/json", output)
 }
 
+// InstallUVPackage installs a package into the category's venv. With
+// ?async=true it runs as a background job.
 func InstallUVPackage(c *gin.Context) {
 	id := c.Param("id")
-	var req struct {
-		Package string `json:"package" binding:"required"`
-	}
+	var req installPackageParams
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -357,19 +722,36 @@ func InstallUVPackage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid package name"})
 		return
 	}
-	if err := ensureVenv(id); err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "output": err.Error()})
+	var catID uint
+	fmt.Sscanf(id, "%d", &catID)
+	if wantsAsync(c) {
+		if job := enqueueJob(c, jobs.TypeInstallPackage, catID, req, nil); job != nil {
+			recordAudit(c, database.AuditPackageInstall, catID, req.Package, nil, gin.H{"job_id": job.ID})
+		}
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "uv", "pip", "install", "--python", getVenvPath(id)+"/bin/python", req.Package)
-	output, err := cmd.CombinedOutput()
+	output, err := installPackages(context.Background(), id, req.Package)
+	recordAudit(c, database.AuditPackageInstall, catID, req.Package, nil, gin.H{"success": err == nil})
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "output": string(output)})
+		c.JSON(http.StatusOK, gin.H{"success": false, "output": output})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "output": string(output)})
+	c.JSON(http.StatusOK, gin.H{"success": true, "output": output})
+}
+
+type installPackageParams struct {
+	Package string `json:"package" binding:"required"`
+}
+
+func runInstallPackageJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	var params installPackageParams
+	if err := run.Params(&params); err != nil {
+		return nil, err
+	}
+	run.Logf("Installing %s", params.Package)
+	output, err := installPackages(ctx, strconv.FormatUint(uint64(run.CategoryID()), 10), params.Package)
+	run.Logf("%s", output)
+	return nil, err
 }
 
 func UninstallUVPackage(c *gin.Context) {
@@ -389,6 +771,9 @@ func UninstallUVPackage(c *gin.Context) {
 	defer cancel()
 	cmd := exec.CommandContext(ctx, "uv", "pip", "uninstall", "--python", getVenvPath(id)+"/bin/python", req.Package)
 	output, err := cmd.CombinedOutput()
+	var catID uint
+	fmt.Sscanf(id, "%d", &catID)
+	recordAudit(c, database.AuditPackageUninstall, catID, req.Package, nil, gin.H{"success": err == nil})
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"success": false, "output": string(output)})
 		return
@@ -396,6 +781,8 @@ func UninstallUVPackage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "output": string(output)})
 }
 
+// InstallRequirements installs an uploaded requirements.txt into the
+// category's venv. With ?async=true it runs as a background job.
 func InstallRequirements(c *gin.Context) {
 	id := c.Param("id")
 	file, err := c.FormFile("file")
@@ -403,8 +790,18 @@ func InstallRequirements(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no file uploaded"})
 		return
 	}
-	if err := ensureVenv(id); err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "output": err.Error()})
+	var catID uint
+	fmt.Sscanf(id, "%d", &catID)
+	if wantsAsync(c) {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		if job := enqueueJob(c, jobs.TypeInstallRequirements, catID, nil, f); job != nil {
+			recordAudit(c, database.AuditRequirementsInstall, catID, file.Filename, nil, gin.H{"job_id": job.ID})
+		}
 		return
 	}
 	tmpFile, err := os.CreateTemp("", "requirements-*.txt")
@@ -419,15 +816,20 @@ func InstallRequirements(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "output": err.Error()})
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "uv", "pip", "install", "--python", getVenvPath(id)+"/bin/python", "-r", tmpPath)
-	output, err := cmd.CombinedOutput()
+	output, err := installPackages(context.Background(), id, "-r", tmpPath)
+	recordAudit(c, database.AuditRequirementsInstall, catID, file.Filename, nil, gin.H{"success": err == nil})
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"success": false, "output": string(output)})
+		c.JSON(http.StatusOK, gin.H{"success": false, "output": output})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "output": string(output)})
+	c.JSON(http.StatusOK, gin.H{"success": true, "output": output})
+}
+
+func runInstallRequirementsJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	run.Logf("Installing requirements")
+	output, err := installPackages(ctx, strconv.FormatUint(uint64(run.CategoryID()), 10), "-r", jobs.InputPath(run.ID()))
+	run.Logf("%s", output)
+	return nil, err
 }
 
 func GetCategoriesOverview(c *gin.Context) {
@@ -442,14 +844,21 @@ func GetCategoriesOverview(c *gin.Context) {
 	}
 
 	var categories []database.Category
-	database.DB.Order("id").Find(&categories)
+	query := database.DB.Order("id")
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("id IN ?", append(ids, 0))
+	}
+	query.Find(&categories)
 
+	now := time.Now()
+	availCond, availArgs := database.AvailableCondition("", now)
+	usedCond, usedArgs := database.UsedCondition("", now)
 	results := make([]CategoryOverview, 0, len(categories))
 	for _, cat := range categories {
 		var total, available, used, banned int64
 		database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Count(&total)
-		database.DB.Model(&database.Account{}).Where("category_id = ? AND used = ? AND banned = ?", cat.ID, false, false).Count(&available)
-		database.DB.Model(&database.Account{}).Where("category_id = ? AND used = ? AND banned = ?", cat.ID, true, false).Count(&used)
+		database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Where(availCond, availArgs...).Count(&available)
+		database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Where(usedCond, usedArgs...).Count(&used)
 		database.DB.Model(&database.Account{}).Where("category_id = ? AND banned = ?", cat.ID, true).Count(&banned)
 		results = append(results, CategoryOverview{
 			ID: cat.ID, Name: cat.Name,
@@ -473,7 +882,7 @@ func GetRecentValidationRuns(c *gin.Context) {
 
 	var runs []RunWithCategory
 	database.DB.Table("validation_runs").
-		Select("validation_runs.id, validation_runs.category_id, categories.name as category_name, validation_runs.status, validation_runs.total_count, validation_runs.processed_count, validation_runs.used_count, validation_runs.banned_count, validation_runs.started_at, validation_runs.finished_at").
+		Select("validation_runs.id, validation_runs.category_id, categories.name as category_name, validation_runs.status, validation_runs.total_count, validation_runs.processed_count, validation_runs.used_count, validation_runs.banned_count, validation_runs.resume_count, validation_runs.started_at, validation_runs.finished_at").
 		Joins("LEFT JOIN categories ON categories.id = validation_runs.category_id").
 		Order("validation_runs.started_at DESC").
 		Limit(limit).
@@ -377,6 +377,91 @@ func TestUpdateCategoryValidationScript_InvalidScope(t *testing.T) {
 	testutil.AssertStatus(t, w, http.StatusBadRequest)
 }
 
+func TestUpdateCategoryValidationScript_ValidationMode(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	t.Cleanup(func() { validator.StopScheduler() })
+
+	cat := testutil.SeedCategory(t, "ModeCat")
+
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/validation-script", UpdateCategoryValidationScript)
+	path := fmt.Sprintf("/api/categories/%d/validation-script", cat.ID)
+
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"validation_mode": "fork"}), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"validation_mode": "pool"}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	// Omitting the mode keeps the current one
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"validation_concurrency": 4}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var got database.Category
+	database.DB.First(&got, cat.ID)
+	if got.ValidationMode != database.ValidationModePool {
+		t.Errorf("expected pool mode, got %q", got.ValidationMode)
+	}
+}
+
+func TestUpdateCategoryValidationScript_AsyncLimitClamped(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	t.Cleanup(func() { validator.StopScheduler() })
+
+	cat := testutil.SeedCategory(t, "AsyncCat")
+
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/validation-script", UpdateCategoryValidationScript)
+	path := fmt.Sprintf("/api/categories/%d/validation-script", cat.ID)
+
+	var got database.Category
+	database.DB.First(&got, cat.ID)
+	if got.ValidationAsyncLimit != 10 {
+		t.Errorf("expected default async limit 10, got %d", got.ValidationAsyncLimit)
+	}
+
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"validation_async_limit": 5000}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	database.DB.First(&got, cat.ID)
+	if got.ValidationAsyncLimit != 500 {
+		t.Errorf("expected async limit clamped to 500, got %d", got.ValidationAsyncLimit)
+	}
+}
+
+func TestUpdateCategoryValidationScript_BatchAndTimeouts(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	t.Cleanup(func() { validator.StopScheduler() })
+
+	cat := testutil.SeedCategory(t, "TimeoutCat")
+
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/validation-script", UpdateCategoryValidationScript)
+	path := fmt.Sprintf("/api/categories/%d/validation-script", cat.ID)
+
+	var got database.Category
+	database.DB.First(&got, cat.ID)
+	if got.ValidationBatchSize != 50 || got.AccountTimeoutSeconds != 60 || got.BatchTimeoutSeconds != 0 || got.RunDeadlineMinutes != 0 {
+		t.Errorf("unexpected defaults %+v", got)
+	}
+
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"validation_batch_size":   5000,
+		"account_timeout_seconds": 0,
+		"batch_timeout_seconds":   -5,
+		"run_deadline_minutes":    90,
+	})
+	w := testutil.DoRequest(router, http.MethodPut, path, body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	database.DB.First(&got, cat.ID)
+	if got.ValidationBatchSize != 1000 || got.AccountTimeoutSeconds != 1 || got.BatchTimeoutSeconds != 0 || got.RunDeadlineMinutes != 90 {
+		t.Errorf("expected clamped settings, got batch %d, account %ds, batch %ds, deadline %dm",
+			got.ValidationBatchSize, got.AccountTimeoutSeconds, got.BatchTimeoutSeconds, got.RunDeadlineMinutes)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // TestValidationScript
 // ---------------------------------------------------------------------------
@@ -434,6 +519,98 @@ printf 'not-json-output\n'
 	testutil.AssertJSONField(t, data, "success", false)
 }
 
+// ---------------------------------------------------------------------------
+// UpdateMaxUses
+// ---------------------------------------------------------------------------
+
+func TestUpdateMaxUses_MarksExhausted(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/max-uses", UpdateMaxUses)
+
+	cat := testutil.SeedCategory(t, "max-uses")
+	database.DB.Model(&cat).Update("max_uses", 10)
+	heavy := testutil.SeedAccount(t, cat.ID, "heavy")
+	light := testutil.SeedAccount(t, cat.ID, "light")
+	database.DB.Model(&heavy).Update("use_count", 4)
+	database.DB.Model(&light).Update("use_count", 1)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"max_uses": 3})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/max-uses", cat.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	database.DB.First(&cat, cat.ID)
+	database.DB.First(&heavy, heavy.ID)
+	database.DB.First(&light, light.ID)
+	if cat.MaxUses != 3 {
+		t.Errorf("expected max_uses 3, got %d", cat.MaxUses)
+	}
+	if !heavy.Used || light.Used {
+		t.Errorf("expected only the exhausted account marked used, got heavy=%v light=%v", heavy.Used, light.Used)
+	}
+}
+
+func TestUpdateMaxUses_RaisingFreesAccounts(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/max-uses", UpdateMaxUses)
+
+	cat := testutil.SeedCategory(t, "max-uses-raise")
+	exhausted := testutil.SeedAccountWithStatus(t, cat.ID, "exhausted", true, false)
+	banned := testutil.SeedAccountWithStatus(t, cat.ID, "banned", true, true)
+	resting := testutil.SeedAccountWithStatus(t, cat.ID, "resting", true, false)
+	spent := testutil.SeedAccountWithStatus(t, cat.ID, "spent", true, false)
+	database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Update("use_count", 1)
+	database.DB.Model(&resting).Update("cooldown_until", time.Now().Add(time.Hour))
+	database.DB.Model(&spent).Update("use_count", 3)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"max_uses": 3})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/max-uses", cat.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	for _, tc := range []struct {
+		acc  database.Account
+		used bool
+	}{{exhausted, false}, {banned, true}, {resting, true}, {spent, true}} {
+		var acc database.Account
+		database.DB.First(&acc, tc.acc.ID)
+		if acc.Used != tc.used {
+			t.Errorf("%s: expected used=%v, got %v", acc.Data, tc.used, acc.Used)
+		}
+	}
+	var history int64
+	database.DB.Model(&database.AccountHistory{}).Where("account_id = ? AND source = ?", exhausted.ID, database.HistorySourceSettings).Count(&history)
+	if history != 1 {
+		t.Errorf("expected 1 settings history entry for the freed account, got %d", history)
+	}
+}
+
+func TestUpdateMaxUses_NotFound(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/max-uses", UpdateMaxUses)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"max_uses": 3})
+	w := testutil.DoRequest(router, http.MethodPut, "/api/categories/999/max-uses", body, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestUpdateMaxUses_ClampedToOne(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/max-uses", UpdateMaxUses)
+	cat := testutil.SeedCategory(t, "max-uses-clamp")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"max_uses": 0})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/max-uses", cat.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	database.DB.First(&cat, cat.ID)
+	if cat.MaxUses != 1 {
+		t.Errorf("expected max_uses clamped to 1, got %d", cat.MaxUses)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GetValidationRuns
 // ---------------------------------------------------------------------------
@@ -708,6 +885,46 @@ func TestGetValidationRunLog_NotFound(t *testing.T) {
 	testutil.AssertStatus(t, w, http.StatusNotFound)
 }
 
+// ---------------------------------------------------------------------------
+// ResumeValidationRun
+// ---------------------------------------------------------------------------
+
+func TestResumeValidationRun_NotFound(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/validation-runs/:run_id/resume", ResumeValidationRun)
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/validation-runs/9999/resume", nil, "")
+
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestResumeValidationRun_NotResumable(t *testing.T) {
+	testutil.SetupTestDB(t)
+	cat := testutil.SeedCategory(t, "ResumeCat")
+	finished := testutil.SeedValidationRun(t, cat.ID, database.RunStatusSuccess)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/validation-runs/:run_id/resume", ResumeValidationRun)
+
+	w := testutil.DoRequest(router, http.MethodPost, fmt.Sprintf("/api/validation-runs/%d/resume", finished.ID), nil, "")
+
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestResumeValidationRun_TokenScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	cat := testutil.SeedCategory(t, "mine")
+	other := testutil.SeedCategory(t, "theirs")
+	run := testutil.SeedValidationRun(t, other.ID, database.RunStatusInterrupted)
+	tok := &database.APIToken{Permissions: "write", CategoryIDs: fmt.Sprint(cat.ID)}
+	router := testutil.SetupTestRouter()
+	router.POST("/api/validation-runs/:run_id/resume", withToken(tok), ResumeValidationRun)
+
+	w := testutil.DoRequest(router, http.MethodPost, fmt.Sprintf("/api/validation-runs/%d/resume", run.ID), nil, "")
+
+	testutil.AssertStatus(t, w, http.StatusForbidden)
+}
+
 // ---------------------------------------------------------------------------
 // GetCategoriesOverview
 // ---------------------------------------------------------------------------
@@ -843,3 +1060,112 @@ func TestGetRecentValidationRuns_IncludesCategoryName(t *testing.T) {
 		t.Errorf("expected category_name 'NamedCat', got %v", catName)
 	}
 }
+
+func TestUpdateCooldown_Success(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/cooldown", UpdateCooldown)
+
+	cat := testutil.SeedCategory(t, "cooldown-cat")
+	path := fmt.Sprintf("/api/categories/%d/cooldown", cat.ID)
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"cooldown_seconds": 21600}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	database.DB.First(&cat, cat.ID)
+	if cat.CooldownSeconds != 21600 {
+		t.Errorf("expected cooldown_seconds 21600, got %d", cat.CooldownSeconds)
+	}
+}
+
+func TestUpdateCooldown_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/cooldown", UpdateCooldown)
+
+	cat := testutil.SeedCategory(t, "cooldown-invalid")
+	path := fmt.Sprintf("/api/categories/%d/cooldown", cat.ID)
+	for _, body := range []map[string]interface{}{{}, {"cooldown_seconds": -1}} {
+		w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestUpdateAccountSchema_ReparsesAccounts(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/account-schema", UpdateAccountSchema)
+	router.GET("/api/accounts/:category_id", GetAccounts)
+
+	cat := testutil.SeedCategory(t, "schema-update")
+	testutil.SeedAccount(t, cat.ID, `{"email": "a@x.io", "vip": true}`)
+	testutil.SeedAccount(t, cat.ID, "not json")
+
+	path := fmt.Sprintf("/api/categories/%d/account-schema", cat.ID)
+	schema := map[string]interface{}{"format": "json", "fields": []map[string]string{{"name": "email"}, {"name": "vip", "type": "bool"}}}
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"account_schema": schema}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "parsed", 1)
+	testutil.AssertJSONField(t, data, "failed", 1)
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d", cat.ID), nil, "")
+	accounts := testutil.GetJSONArray(testutil.ParseJSON(t, w), "data")
+	fields, ok := accounts[0].(map[string]interface{})["fields"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected fields on parsed account, got %v", accounts[0])
+	}
+	testutil.AssertJSONField(t, fields, "email", "a@x.io")
+	testutil.AssertJSONField(t, fields, "vip", true)
+	if _, has := accounts[1].(map[string]interface{})["fields"]; has {
+		t.Errorf("expected no fields on unparsable account")
+	}
+
+	// Removing the schema clears structured fields
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"account_schema": nil}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	var acc database.Account
+	database.DB.Where("category_id = ?", cat.ID).Order("id").First(&acc)
+	if acc.Fields != nil {
+		t.Errorf("expected fields cleared, got %v", acc.Fields)
+	}
+}
+
+func TestUpdateAccountSchema_ReparsesTrashedAccounts(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/account-schema", UpdateAccountSchema)
+
+	cat := testutil.SeedCategory(t, "schema-trash")
+	trashed := testutil.SeedAccount(t, cat.ID, "a@x.io:pw")
+	database.DB.Delete(&trashed)
+
+	path := fmt.Sprintf("/api/categories/%d/account-schema", cat.ID)
+	schema := map[string]interface{}{"format": "delimited", "delimiter": ":", "fields": []map[string]string{{"name": "email"}, {"name": "password"}}}
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"account_schema": schema}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "parsed", 1)
+
+	var acc database.Account
+	database.DB.Unscoped().First(&acc, trashed.ID)
+	if acc.Fields == nil || acc.Fields["email"] != "a@x.io" {
+		t.Errorf("expected trashed account re-parsed, got %v", acc.Fields)
+	}
+}
+
+func TestUpdateAccountSchema_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/account-schema", UpdateAccountSchema)
+
+	cat := testutil.SeedCategory(t, "schema-invalid")
+	path := fmt.Sprintf("/api/categories/%d/account-schema", cat.ID)
+	for _, schema := range []map[string]interface{}{
+		{"format": "xml", "fields": []map[string]string{{"name": "a"}}},
+		{"format": "delimited", "fields": []map[string]string{}},
+		{"format": "delimited", "fields": []map[string]string{{"name": "a b"}}},
+		{"format": "delimited", "fields": []map[string]string{{"name": "a", "type": "date"}}},
+	} {
+		w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"account_schema": schema}), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+}
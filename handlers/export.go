@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/logger"
+	"final-account-hub/metrics"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const exportBatchSize = 1000
+
+var exportContentTypes = map[string]string{
+	"txt":   "text/plain; charset=utf-8",
+	"csv":   "text/csv; charset=utf-8",
+	"jsonl": "application/x-ndjson",
+}
+
+// exportParams are the validated options of an export. They are stored as
+// job params when the export runs in the background.
+type exportParams struct {
+	CategoryID    uint      `json:"category_id"`
+	Format        string    `json:"format"`
+	MarkAsUsed    bool      `json:"mark_as_used"`
+	AccountTypes  []string  `json:"account_types"`
+	Tags          []string  `json:"tags"`
+	ExcludeTags   []string  `json:"exclude_tags"`
+	CreatedAfter  string    `json:"created_after"`
+	CreatedBefore string    `json:"created_before"`
+	UpdatedAfter  string    `json:"updated_after"`
+	UpdatedBefore string    `json:"updated_before"`
+	ClientIP      string    `json:"client_ip"`
+	RequestedAt   time.Time `json:"requested_at"`
+}
+
+// ExportAccounts streams every account of a category that matches the
+// filters as a download. GET only reads; POST also marks the exported
+// accounts as used, counting one use each like a fetch. With ?async=true the
+// file is written by a background job and downloaded from the job.
+//
+// Query parameters: format (txt, csv, jsonl; default txt), account_type
+// (comma-separated; default all), tags, exclude_tags and the RFC3339
+// created_after, created_before, updated_after, updated_before.
+func ExportAccounts(c *gin.Context) {
+	started := time.Now()
+	params, err := exportParamsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cat database.Category
+	if err := database.DB.Select("id").First(&cat, params.CategoryID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	if wantsAsync(c) {
+		enqueueJob(c, jobs.TypeExportAccounts, params.CategoryID, params, nil)
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[params.Format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, params.filename()))
+	c.Status(http.StatusOK)
+
+	// A client that disconnects stops the export, so no further batches are claimed
+	exported, err := writeAccountsExport(c.Request.Context(), c.Writer, params, func(int) { c.Writer.Flush() })
+	if err != nil {
+		// Headers are already sent, so the download just ends early
+		logger.Error.Printf("Account export for category %d failed: %v", params.CategoryID, err)
+	}
+	params.observeClaim(exported, err, started)
+}
+
+// exportParamsFromQuery validates the export query parameters.
+func exportParamsFromQuery(c *gin.Context) (exportParams, error) {
+	params := exportParams{
+		Format:        c.DefaultQuery("format", "txt"),
+		MarkAsUsed:    c.Request.Method == http.MethodPost,
+		AccountTypes:  []string{"available", "used", "banned"},
+		CreatedAfter:  c.Query("created_after"),
+		CreatedBefore: c.Query("created_before"),
+		UpdatedAfter:  c.Query("updated_after"),
+		UpdatedBefore: c.Query("updated_before"),
+		ClientIP:      c.ClientIP(),
+		RequestedAt:   time.Now(),
+	}
+	fmt.Sscanf(c.Param("category_id"), "%d", &params.CategoryID)
+
+	if _, ok := exportContentTypes[params.Format]; !ok {
+		return params, fmt.Errorf("format must be one of: txt, csv, jsonl")
+	}
+	// Claiming defaults to available accounts, like a fetch
+	if params.MarkAsUsed {
+		params.AccountTypes = []string{"available"}
+	}
+	if raw := c.Query("account_type"); raw != "" {
+		params.AccountTypes = nil
+		for _, t := range strings.Split(raw, ",") {
+			params.AccountTypes = append(params.AccountTypes, strings.TrimSpace(t))
+		}
+		if err := validateAccountTypes(params.AccountTypes); err != nil {
+			return params, err
+		}
+	}
+	if _, err := params.timeFilters(); err != nil {
+		return params, err
+	}
+	var err error
+	if params.Tags, err = database.NormalizeTags(strings.Split(c.Query("tags"), ",")); err != nil {
+		return params, err
+	}
+	if params.ExcludeTags, err = database.NormalizeTags(strings.Split(c.Query("exclude_tags"), ",")); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+func (p exportParams) timeFilters() ([]timeFilter, error) {
+	return parseTimeFilters(&p.CreatedAfter, &p.CreatedBefore, &p.UpdatedAfter, &p.UpdatedBefore)
+}
+
+func (p exportParams) filename() string {
+	return fmt.Sprintf("category-%d-%s.%s", p.CategoryID, p.RequestedAt.UTC().Format("20060102-150405"), p.Format)
+}
+
+// scope adds the export filters to query.
+func (p exportParams) scope(query *gorm.DB, timeFilters []timeFilter) *gorm.DB {
+	query = query.Where("category_id = ?", p.CategoryID)
+	// Leased accounts are never handed to another caller
+	if p.MarkAsUsed {
+		query = query.Where("lease_id IS NULL")
+	}
+	query = applyAccountTypeFilter(query, p.AccountTypes)
+	for _, tf := range timeFilters {
+		query = query.Where(tf.condition, tf.value)
+	}
+	return database.ApplyTagFilter(query, p.Tags, p.ExcludeTags)
+}
+
+// observeClaim records a claiming export like a fetch: metrics, API call
+// history and stock alerts.
+func (p exportParams) observeClaim(exported int, err error, started time.Time) {
+	if !p.MarkAsUsed {
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	metrics.ObserveFetch(p.CategoryID, exported, err, started)
+	go RecordAPICall(p.CategoryID, "/api/accounts/export", "POST", p.ClientIP, status)
+	go database.CheckAlert(p.CategoryID)
+}
+
+// writeAccountsExport writes the matching accounts to w in batches, calling
+// flushed with the running count after each one. It returns how many
+// accounts were exported.
+func writeAccountsExport(ctx context.Context, w io.Writer, p exportParams, flushed func(exported int)) (exported int, err error) {
+	timeFilters, err := p.timeFilters()
+	if err != nil {
+		return 0, err
+	}
+	filter := func(tx *gorm.DB) *gorm.DB { return p.scope(tx, timeFilters) }
+
+	csvWriter := csv.NewWriter(w)
+	if p.Format == "csv" {
+		csvWriter.Write([]string{"id", "data", "used", "banned", "use_count", "tags", "created_at", "updated_at"})
+	}
+
+	// Batches are read by ascending ID, so marking a batch as used never
+	// shifts the next one
+	var lastID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		batch, err := nextExportBatch(p.CategoryID, lastID, filter, p.MarkAsUsed)
+		if err != nil {
+			return exported, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+		exported += len(batch)
+		for _, acc := range batch {
+			var err error
+			switch p.Format {
+			case "txt":
+				_, err = io.WriteString(w, acc.Data+"\n")
+			case "csv":
+				err = csvWriter.Write([]string{
+					strconv.FormatUint(uint64(acc.ID), 10), acc.Data,
+					strconv.FormatBool(acc.Used), strconv.FormatBool(acc.Banned),
+					strconv.Itoa(acc.UseCount), strings.Join(acc.Tags, ","),
+					acc.CreatedAt.UTC().Format(time.RFC3339), acc.UpdatedAt.UTC().Format(time.RFC3339),
+				})
+			case "jsonl":
+				line, _ := json.Marshal(acc)
+				_, err = w.Write(append(line, '\n'))
+			}
+			// The reader is gone; stop before claiming another batch
+			if err != nil {
+				return exported, err
+			}
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return exported, err
+		}
+		flushed(exported)
+		if len(batch) < exportBatchSize {
+			break
+		}
+	}
+	return exported, nil
+}
+
+// nextExportBatch loads the next batch after lastID with tags. When
+// markAsUsed is set, the batch is claimed in the same transaction.
+func nextExportBatch(catID, lastID uint, filter func(*gorm.DB) *gorm.DB, markAsUsed bool) ([]database.Account, error) {
+	if markAsUsed && !database.IsPostgres() {
+		fetchMutex.Lock()
+		defer fetchMutex.Unlock()
+	}
+	var batch []database.Account
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		query := filter(tx).Where("id > ?", lastID).Order("id ASC").Limit(exportBatchSize)
+		if markAsUsed && database.IsPostgres() {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&batch).Error; err != nil {
+			return err
+		}
+		if err := database.LoadTags(tx, batch); err != nil {
+			return err
+		}
+		if !markAsUsed || len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, acc := range batch {
+			ids[i] = acc.ID
+		}
+		before := database.StatesOf(batch)
+		policy := database.CategoryUsagePolicy(tx, catID)
+		now := time.Now()
+		if _, err := database.RecordUse(tx, ids, policy, now); err != nil {
+			return err
+		}
+		applyUse(batch, policy, now)
+		return database.RecordAccountChanges(tx, before, database.HistorySource{Source: database.HistorySourceExport})
+	})
+	return batch, err
+}
+
+// runExportAccountsJob is the background form of ExportAccounts. The file is
+// served by DownloadJobOutput.
+func runExportAccountsJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	started := time.Now()
+	var params exportParams
+	if err := run.Params(&params); err != nil {
+		return nil, err
+	}
+	var total int64
+	if timeFilters, err := params.timeFilters(); err == nil {
+		params.scope(database.DB.Model(&database.Account{}), timeFilters).Count(&total)
+	}
+	run.SetProgress(0, total)
+
+	if err := os.MkdirAll(jobs.Dir, 0755); err != nil {
+		return nil, err
+	}
+	// The file holds plaintext account data until jobs.ExpireOutputs removes it
+	f, err := os.OpenFile(jobs.OutputPath(run.ID()), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	exported, err := writeAccountsExport(ctx, f, params, func(exported int) {
+		run.SetProgress(int64(exported), total)
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	params.observeClaim(exported, err, started)
+	run.Logf("Exported %d accounts", exported)
+	return gin.H{
+		"exported":     exported,
+		"filename":     params.filename(),
+		"content_type": exportContentTypes[params.Format],
+	}, err
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupExportRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.GET("/api/accounts/:category_id/export", ExportAccounts)
+	router.POST("/api/accounts/:category_id/export", ExportAccounts)
+	return router
+}
+
+func TestExportAccounts_TxtDefault(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	testutil.SeedAccount(t, cat.ID, "a:1")
+	testutil.SeedAccountWithStatus(t, cat.ID, "b:2", true, false)
+	testutil.SeedAccountWithStatus(t, cat.ID, "c:3", false, true)
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/export", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if got := w.Body.String(); got != "a:1\nb:2\nc:3\n" {
+		t.Errorf("unexpected txt export %q", got)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".txt") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	// GET never changes account state
+	var used int64
+	database.DB.Model(&database.Account{}).Where("used = ?", true).Count(&used)
+	if used != 1 {
+		t.Errorf("expected 1 used account, got %d", used)
+	}
+}
+
+func TestExportAccounts_CSVWithFilters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	a := testutil.SeedAccount(t, cat.ID, "a,with,commas")
+	testutil.SeedAccount(t, cat.ID, "b:2")
+	testutil.SeedAccountWithStatus(t, cat.ID, "c:3", true, false)
+	database.DB.Create(&database.AccountTag{AccountID: a.ID, Tag: "vip"})
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/export", cat.ID)+"?format=csv&account_type=available&tags=vip", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(records) != 2 || records[0][1] != "data" || records[1][1] != "a,with,commas" || records[1][5] != "vip" {
+		t.Errorf("unexpected csv %v", records)
+	}
+}
+
+func TestExportAccounts_JSONLMarkAsUsed(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	testutil.SeedAccounts(t, cat.ID, 3, "acc")
+	testutil.SeedAccountWithStatus(t, cat.ID, "banned", false, true)
+
+	w := testutil.DoRequest(router, http.MethodPost, fmt.Sprintf("/api/accounts/%d/export", cat.ID)+"?format=jsonl&account_type=available", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	var acc database.Account
+	if err := json.Unmarshal([]byte(lines[0]), &acc); err != nil {
+		t.Fatalf("invalid jsonl line: %v", err)
+	}
+	if !acc.Used || acc.UseCount != 1 {
+		t.Errorf("expected exported account to show its use, got %+v", acc)
+	}
+
+	var available int64
+	database.DB.Model(&database.Account{}).Where("used = ? AND banned = ?", false, false).Count(&available)
+	if available != 0 {
+		t.Errorf("expected all available accounts marked used, got %d left", available)
+	}
+}
+
+func TestExportAccounts_MarkAsUsedDefaultsToAvailable(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	testutil.SeedAccount(t, cat.ID, "a:1")
+	testutil.SeedAccountWithStatus(t, cat.ID, "b:2", true, false)
+	banned := testutil.SeedAccountWithStatus(t, cat.ID, "c:3", false, true)
+
+	w := testutil.DoRequest(router, http.MethodPost, fmt.Sprintf("/api/accounts/%d/export", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if got := w.Body.String(); got != "a:1\n" {
+		t.Errorf("expected only the available account, got %q", got)
+	}
+	var acc database.Account
+	database.DB.First(&acc, banned.ID)
+	if !acc.Banned || acc.Used || acc.UseCount != 0 {
+		t.Errorf("expected the banned account untouched, got %+v", acc)
+	}
+}
+
+// failingWriter accepts limit bytes, then fails like a closed connection.
+type failingWriter struct{ limit int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return 0, errors.New("connection closed")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteAccountsExport_StopsOnWriteError(t *testing.T) {
+	for _, format := range []string{"txt", "csv", "jsonl"} {
+		t.Run(format, func(t *testing.T) {
+			testutil.SetupTestDB(t)
+			cat := testutil.SeedCategory(t, "export-"+format)
+			for i := range 5 {
+				testutil.SeedAccounts(t, cat.ID, 500, fmt.Sprintf("acc%d", i))
+			}
+
+			params := exportParams{CategoryID: cat.ID, Format: format, MarkAsUsed: true, AccountTypes: []string{"available"}}
+			_, err := writeAccountsExport(context.Background(), &failingWriter{limit: 100}, params, func(int) {})
+			if err == nil {
+				t.Fatal("expected the write error")
+			}
+
+			// Only the batch being written was claimed
+			if n := countAvailable(cat.ID); n != 2500-exportBatchSize {
+				t.Errorf("expected %d accounts left available, got %d", 2500-exportBatchSize, n)
+			}
+		})
+	}
+}
+
+func TestExportAccounts_ClientGoneClaimsNothing(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	testutil.SeedAccounts(t, cat.ID, 3, "acc")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/accounts/%d/export", cat.ID), nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := countAvailable(cat.ID); n != 3 {
+		t.Errorf("expected a disconnected export to claim nothing, got %d left available", n)
+	}
+}
+
+func TestExportAccounts_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupExportRouter()
+	cat := testutil.SeedCategory(t, "export")
+	base := fmt.Sprintf("/api/accounts/%d/export", cat.ID)
+
+	for _, query := range []string{"?format=xml", "?account_type=sold", "?created_after=yesterday", "?tags=" + strings.Repeat("x", database.MaxTagLength+1)} {
+		w := testutil.DoRequest(router, http.MethodGet, base+query, nil, "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+	w := testutil.DoRequest(router, http.MethodGet, "/api/accounts/999/export", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
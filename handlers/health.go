@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dataDir is where the SQLite database and per-category venvs live.
+var dataDir = "./data"
+
+var startedAt = time.Now()
+
+// Component states reported by HealthReady. A "fail" in a critical component
+// makes the service not ready; "warn" is reported but does not.
+const (
+	healthOK   = "ok"
+	healthWarn = "warn"
+	healthFail = "fail"
+)
+
+type healthComponent struct {
+	Status   string      `json:"status"`
+	Critical bool        `json:"critical"`
+	Error    string      `json:"error,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// HealthLive reports that the process is up and serving requests. It does
+// not touch any dependency, so a slow database never restarts the container.
+func HealthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": healthOK, "uptime_seconds": int(time.Since(startedAt).Seconds())})
+}
+
+// HealthReady checks every dependency and returns 503 when a critical one
+// fails. Each component is reported with its own status.
+func HealthReady(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	components := map[string]healthComponent{
+		"database":        checkDatabase(ctx),
+		"data_dir":        checkDataDir(),
+		"scheduler":       checkScheduler(),
+		"uv":              checkUV(),
+		"python":          checkPython(ctx),
+		"validation_runs": checkValidationRuns(),
+	}
+
+	status := healthOK
+	for _, comp := range components {
+		if comp.Status == healthOK {
+			continue
+		}
+		if comp.Critical && comp.Status == healthFail {
+			status = healthFail
+			break
+		}
+		status = healthWarn
+	}
+	code := http.StatusOK
+	if status == healthFail {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "components": components})
+}
+
+func checkDatabase(ctx context.Context) healthComponent {
+	comp := healthComponent{Status: healthOK, Critical: true}
+	if database.DB == nil {
+		comp.Status, comp.Error = healthFail, "database not initialized"
+		return comp
+	}
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		comp.Status, comp.Error = healthFail, err.Error()
+		return comp
+	}
+	started := time.Now()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		comp.Status, comp.Error = healthFail, err.Error()
+		return comp
+	}
+	stats := sqlDB.Stats()
+	comp.Details = gin.H{
+		"latency_ms":       time.Since(started).Milliseconds(),
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+		"max_open":         stats.MaxOpenConnections,
+		"wait_count":       stats.WaitCount,
+		"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+	}
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		comp.Status, comp.Error = healthWarn, "connection pool exhausted"
+	}
+	return comp
+}
+
+func checkDataDir() healthComponent {
+	comp := healthComponent{Status: healthOK, Critical: true, Details: gin.H{"path": dataDir}}
+	f, err := os.CreateTemp(dataDir, ".healthcheck-*")
+	if err != nil {
+		comp.Status, comp.Error = healthFail, err.Error()
+		return comp
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return comp
+}
+
+func checkScheduler() healthComponent {
+	comp := healthComponent{Status: healthOK, Critical: true}
+	if !validator.SchedulerRunning() {
+		comp.Status, comp.Error = healthFail, "scheduler not running"
+		return comp
+	}
+	comp.Details = gin.H{"jobs": len(validator.ScheduledJobs()), "running_validations": validator.RunningValidations()}
+	return comp
+}
+
+// checkUV and checkPython are not critical: without them validation fails,
+// but fetching and managing accounts still works.
+func checkUV() healthComponent {
+	comp := healthComponent{Status: healthOK}
+	path, err := exec.LookPath("uv")
+	if err != nil {
+		comp.Status, comp.Error = healthFail, "uv not found in PATH"
+		return comp
+	}
+	comp.Details = gin.H{"path": path}
+	return comp
+}
+
+func checkPython(ctx context.Context) healthComponent {
+	comp := healthComponent{Status: healthOK}
+	// Validation runs through uv, so prefer the interpreter uv would pick
+	if _, err := exec.LookPath("uv"); err == nil {
+		out, err := exec.CommandContext(ctx, "uv", "python", "find").Output()
+		if err == nil {
+			comp.Details = gin.H{"path": strings.TrimSpace(string(out))}
+			return comp
+		}
+	}
+	path, err := exec.LookPath("python3")
+	if err != nil {
+		comp.Status, comp.Error = healthFail, "no Python interpreter found"
+		return comp
+	}
+	comp.Details = gin.H{"path": path}
+	return comp
+}
+
+// checkValidationRuns flags runs that have been running or stopping for
+// longer than VALIDATION_STUCK_MINUTES (default 180).
+func checkValidationRuns() healthComponent {
+	comp := healthComponent{Status: healthOK}
+	minutes := 180
+	if v, err := strconv.Atoi(os.Getenv("VALIDATION_STUCK_MINUTES")); err == nil && v > 0 {
+		minutes = v
+	}
+	if database.DB == nil {
+		return comp
+	}
+	var stuck []uint
+	err := database.DB.Model(&database.ValidationRun{}).
+		Where("status IN ? AND started_at < ?", []string{"running", "stopping"}, time.Now().Add(-time.Duration(minutes)*time.Minute)).
+		Order("id").Limit(100).Pluck("id", &stuck).Error
+	if err != nil {
+		comp.Status, comp.Error = healthFail, err.Error()
+		return comp
+	}
+	if len(stuck) > 0 {
+		comp.Status, comp.Error = healthWarn, "validation runs exceeded "+strconv.Itoa(minutes)+" minutes"
+		comp.Details = gin.H{"run_ids": stuck}
+	}
+	return comp
+}
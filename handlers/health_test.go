@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+	"final-account-hub/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupHealthRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	orig := dataDir
+	dataDir = t.TempDir()
+	t.Cleanup(func() { dataDir = orig })
+
+	r := testutil.SetupTestRouter()
+	r.GET("/health/live", HealthLive)
+	r.GET("/health/ready", HealthReady)
+	return r
+}
+
+func readyComponent(t *testing.T, data map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	components, _ := data["components"].(map[string]interface{})
+	comp, ok := components[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected component %q in %v", name, data)
+	}
+	return comp
+}
+
+func TestHealthLive(t *testing.T) {
+	r := setupHealthRouter(t)
+	w := testutil.DoRequest(r, http.MethodGet, "/health/live", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "status", "ok")
+}
+
+func TestHealthReady_Healthy(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	t.Cleanup(validator.StopScheduler)
+	r := setupHealthRouter(t)
+
+	w := testutil.DoRequest(r, http.MethodGet, "/health/ready", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	for _, name := range []string{"database", "data_dir", "scheduler", "validation_runs"} {
+		testutil.AssertJSONField(t, readyComponent(t, data, name), "status", "ok")
+	}
+	if _, ok := readyComponent(t, data, "database")["details"].(map[string]interface{})["open_connections"]; !ok {
+		t.Error("expected pool stats in database details")
+	}
+	// uv and python depend on the host; they are reported either way
+	readyComponent(t, data, "uv")
+	readyComponent(t, data, "python")
+}
+
+func TestHealthReady_CriticalFailures(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.StopScheduler()
+	r := setupHealthRouter(t)
+	dataDir = filepath.Join(dataDir, "missing")
+
+	w := testutil.DoRequest(r, http.MethodGet, "/health/ready", nil, "")
+	testutil.AssertStatus(t, w, http.StatusServiceUnavailable)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "status", "fail")
+	testutil.AssertJSONField(t, readyComponent(t, data, "data_dir"), "status", "fail")
+	testutil.AssertJSONField(t, readyComponent(t, data, "scheduler"), "status", "fail")
+
+	// A closed database fails too
+	sqlDB, _ := database.DB.DB()
+	sqlDB.Close()
+	w = testutil.DoRequest(r, http.MethodGet, "/health/ready", nil, "")
+	testutil.AssertJSONField(t, readyComponent(t, testutil.ParseJSON(t, w), "database"), "status", "fail")
+}
+
+func TestHealthReady_StuckValidationRun(t *testing.T) {
+	testutil.SetupTestDB(t)
+	validator.InitSchedulerForTest()
+	t.Cleanup(validator.StopScheduler)
+	testutil.SetEnv(t, "VALIDATION_STUCK_MINUTES", "30")
+	r := setupHealthRouter(t)
+
+	cat := testutil.SeedCategory(t, "stuck")
+	run := testutil.SeedValidationRun(t, cat.ID, "running")
+	database.DB.Model(&run).Update("started_at", time.Now().Add(-time.Hour))
+	testutil.SeedValidationRun(t, cat.ID, "running") // recent, not stuck
+
+	w := testutil.DoRequest(r, http.MethodGet, "/health/ready", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "status", "warn")
+	comp := readyComponent(t, data, "validation_runs")
+	testutil.AssertJSONField(t, comp, "status", "warn")
+	ids, _ := comp["details"].(map[string]interface{})["run_ids"].([]interface{})
+	if len(ids) != 1 || ids[0] != float64(run.ID) {
+		t.Errorf("expected run %d to be reported, got %v", run.ID, ids)
+	}
+}
@@ -115,11 +115,14 @@ func UpdateValidationHistoryLimit(c *gin.Context) {
 	if req.Limit < 1 {
 		req.Limit = 50
 	}
+	var old database.Category
+	database.DB.First(&old, id)
 	if err := database.DB.Model(&database.Category{}).Where("id = ?", id).
 		Update("validation_history_limit", req.Limit).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditCategoryUpdate(c, old, gin.H{"validation_history_limit": req.Limit})
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
@@ -135,11 +138,14 @@ func UpdateApiHistoryLimit(c *gin.Context) {
 	if req.Limit < 1 {
 		req.Limit = 1000
 	}
+	var old database.Category
+	database.DB.First(&old, id)
 	if err := database.DB.Model(&database.Category{}).Where("id = ?", id).
 		Update("api_history_limit", req.Limit).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	auditCategoryUpdate(c, old, gin.H{"api_history_limit": req.Limit})
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
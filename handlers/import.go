@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	importBatchSize = 1000
+	// maxImportErrors caps how many invalid lines are listed in the summary
+	maxImportErrors = 100
+)
+
+// importRow is one parsed line of an upload. err is set for invalid lines,
+// which are counted and skipped.
+type importRow struct {
+	line   int
+	data   string
+	tags   []string
+	fields map[string]interface{}
+	err    error
+}
+
+type importLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importStats summarizes an import. Errors lists the first invalid lines.
+type importStats struct {
+	Processed int               `json:"processed"`
+	Inserted  int               `json:"inserted"`
+	Skipped   int               `json:"skipped"`
+	Invalid   int               `json:"invalid"`
+	Errors    []importLineError `json:"errors"`
+}
+
+// importParams are stored with a background import job; the upload itself
+// is the job's input file.
+type importParams struct {
+	Format   string `json:"format"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// ImportAccountsFile streams a multipart "file" upload into a category in
+// batches, reporting progress over SSE. The format (txt, csv, jsonl) comes
+// from ?format or the file extension; gzip is detected from the content.
+// With ?async=true the upload is saved and imported by a background job.
+//
+//   - txt: one account per line
+//   - csv: a header row with a "data" column and an optional "tags" column
+//     (comma-separated)
+//   - jsonl: one {"data": "...", "tags": [...]} object per line
+//
+// Accounts already in the category or repeated in the file are skipped.
+func ImportAccountsFile(c *gin.Context) {
+	var catID uint
+	fmt.Sscanf(c.Param("category_id"), "%d", &catID)
+
+	var cat database.Category
+	if err := database.DB.Select("id, account_schema").First(&cat, catID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = importFormatFromName(fh.Filename)
+	}
+	if format != "txt" && format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of: txt, csv, jsonl"})
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	if wantsAsync(c) {
+		enqueueJob(c, jobs.TypeImportAccounts, catID, importParams{Format: format, Filename: fh.Filename, Size: fh.Size}, f)
+		return
+	}
+
+	src, err := openImportSource(f, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+
+	// Set SSE headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	stats, err := importAccounts(context.Background(), &cat, src, func(stats importStats) {
+		c.SSEvent("progress", gin.H{
+			"processed": stats.Processed, "inserted": stats.Inserted, "skipped": stats.Skipped, "invalid": stats.Invalid,
+			"bytes_read": src.counter.n, "total_bytes": fh.Size,
+		})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		c.SSEvent("error", gin.H{"error": err.Error(), "processed": stats.Processed, "inserted": stats.Inserted})
+		return
+	}
+	c.SSEvent("done", stats)
+}
+
+// runImportAccountsJob is the background form of ImportAccountsFile.
+// Progress is measured in bytes of the uploaded file.
+func runImportAccountsJob(ctx context.Context, run *jobs.Run) (interface{}, error) {
+	var params importParams
+	if err := run.Params(&params); err != nil {
+		return nil, err
+	}
+	var cat database.Category
+	if err := database.DB.Select("id, account_schema").First(&cat, run.CategoryID()).Error; err != nil {
+		return nil, errors.New("category not found")
+	}
+	f, err := os.Open(jobs.InputPath(run.ID()))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, err := openImportSource(f, params.Format)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	run.Logf("Importing %s (%s, %d bytes)", params.Filename, params.Format, params.Size)
+	stats, err := importAccounts(ctx, &cat, src, func(stats importStats) {
+		run.SetProgress(src.counter.n, params.Size)
+	})
+	run.Logf("Processed %d lines: %d inserted, %d skipped, %d invalid", stats.Processed, stats.Inserted, stats.Skipped, stats.Invalid)
+	return stats, err
+}
+
+// importSource is an opened upload that yields rows.
+type importSource struct {
+	next    func() (importRow, error)
+	counter *countingReader
+	gz      *gzip.Reader
+}
+
+// openImportSource detects gzip compression and reads the csv header, so
+// malformed uploads are rejected before any row is imported.
+func openImportSource(r io.Reader, format string) (*importSource, error) {
+	src := &importSource{counter: &countingReader{r: r}}
+	br := bufio.NewReaderSize(src.counter, 1<<16)
+	var rows io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		src.gz = gz
+		rows = gz
+	}
+	next, err := newImportRowReader(format, rows)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	src.next = next
+	return src, nil
+}
+
+func (s *importSource) Close() {
+	if s.gz != nil {
+		s.gz.Close()
+	}
+}
+
+// importAccounts reads every row of src into cat, inserting in batches and
+// calling progress after each batch. Batches already inserted are kept when
+// it fails or ctx is canceled.
+func importAccounts(ctx context.Context, cat *database.Category, src *importSource, progress func(importStats)) (importStats, error) {
+	stats := importStats{Errors: []importLineError{}}
+	batch := make([]importRow, 0, importBatchSize)
+	flush := func() error {
+		ins, skip, err := insertImportBatch(cat, batch)
+		if err != nil {
+			return err
+		}
+		stats.Inserted += ins
+		stats.Skipped += skip
+		batch = batch[:0]
+		progress(stats)
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		row, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Processed++
+		if row.err == nil && strings.TrimSpace(row.data) == "" {
+			row.err = errors.New("empty data")
+		}
+		if row.err == nil {
+			row.tags, row.err = database.NormalizeTags(row.tags)
+		}
+		if row.err == nil {
+			row.fields, row.err = cat.ParseFields(row.data)
+		}
+		if row.err != nil {
+			stats.Invalid++
+			if len(stats.Errors) < maxImportErrors {
+				stats.Errors = append(stats.Errors, importLineError{Line: row.line, Error: row.err.Error()})
+			}
+			continue
+		}
+		batch = append(batch, row)
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	err := flush()
+	if stats.Inserted > 0 {
+		go webhook.Emit(cat.ID, webhook.EventAccountsImported, gin.H{"count": stats.Inserted, "skipped": stats.Skipped})
+	}
+	return stats, err
+}
+
+// importFormatFromName picks the format from a file extension, ignoring a
+// trailing .gz. Unknown extensions are read as plain text.
+func importFormatFromName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".gz")
+	switch filepath.Ext(name) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	default:
+		return "txt"
+	}
+}
+
+// newImportRowReader returns a function yielding one row per record until
+// io.EOF. Other errors mean the stream itself is unreadable.
+func newImportRowReader(format string, r io.Reader) (func() (importRow, error), error) {
+	switch format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("reading csv header: %w", err)
+		}
+		dataCol, tagsCol := -1, -1
+		for i, name := range header {
+			switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+			case "data":
+				dataCol = i
+			case "tags":
+				tagsCol = i
+			}
+		}
+		if dataCol < 0 {
+			return nil, errors.New("csv header must contain a data column")
+		}
+		return func() (importRow, error) {
+			record, err := cr.Read()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return importRow{line: parseErr.Line, err: parseErr.Err}, nil
+			}
+			if err != nil {
+				return importRow{}, err
+			}
+			line, _ := cr.FieldPos(0)
+			row := importRow{line: line}
+			if dataCol >= len(record) {
+				row.err = errors.New("missing data column")
+				return row, nil
+			}
+			row.data = record[dataCol]
+			if tagsCol >= 0 && tagsCol < len(record) && record[tagsCol] != "" {
+				row.tags = strings.Split(record[tagsCol], ",")
+			}
+			return row, nil
+		}, nil
+
+	case "jsonl":
+		lines := newLineReader(r)
+		return func() (importRow, error) {
+			line, text, err := lines()
+			if err != nil {
+				return importRow{}, err
+			}
+			var obj struct {
+				Data *string  `json:"data"`
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal([]byte(text), &obj); err != nil {
+				return importRow{line: line, err: errors.New("invalid JSON")}, nil
+			}
+			if obj.Data == nil {
+				return importRow{line: line, err: errors.New("missing data field")}, nil
+			}
+			return importRow{line: line, data: *obj.Data, tags: obj.Tags}, nil
+		}, nil
+
+	default:
+		lines := newLineReader(r)
+		return func() (importRow, error) {
+			line, text, err := lines()
+			return importRow{line: line, data: text}, err
+		}, nil
+	}
+}
+
+// newLineReader returns the next non-blank line and its 1-based number,
+// without a line length limit.
+func newLineReader(r io.Reader) func() (int, string, error) {
+	br := bufio.NewReader(r)
+	n := 0
+	return func() (int, string, error) {
+		for {
+			text, err := br.ReadString('\n')
+			if text != "" {
+				n++
+			}
+			if text = strings.TrimRight(text, "\r\n"); strings.TrimSpace(text) != "" {
+				return n, text, nil
+			}
+			if err != nil {
+				return n, "", err
+			}
+		}
+	}
+}
+
+// insertImportBatch inserts the rows whose data is new to the category and
+// adds their tags.
+func insertImportBatch(cat *database.Category, rows []importRow) (inserted, skipped int, err error) {
+	if len(rows) == 0 {
+		return 0, 0, nil
+	}
+	hashes := make([]string, len(rows))
+	for i, row := range rows {
+		hashes[i] = database.HashData(row.data)
+	}
+	var existingHashes []string
+	if err := database.DB.Model(&database.Account{}).Where("category_id = ? AND data_hash IN ?", cat.ID, hashes).
+		Pluck("data_hash", &existingHashes).Error; err != nil {
+		return 0, 0, err
+	}
+	existingSet := make(map[string]bool, len(existingHashes))
+	for _, h := range existingHashes {
+		existingSet[h] = true
+	}
+
+	var accounts []database.Account
+	var accountTags [][]string
+	for i, row := range rows {
+		if existingSet[hashes[i]] {
+			skipped++
+			continue
+		}
+		existingSet[hashes[i]] = true // prevent duplicates within the file
+		accounts = append(accounts, database.Account{CategoryID: cat.ID, Data: row.data, Fields: row.fields})
+		accountTags = append(accountTags, row.tags)
+	}
+	if len(accounts) == 0 {
+		return 0, skipped, nil
+	}
+	if err := database.DB.CreateInBatches(&accounts, 500).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var tagRows []database.AccountTag
+	for i, acc := range accounts {
+		for _, tag := range accountTags[i] {
+			tagRows = append(tagRows, database.AccountTag{AccountID: acc.ID, Tag: tag})
+		}
+	}
+	if len(tagRows) > 0 {
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&tagRows, 500).Error; err != nil {
+			return len(accounts), skipped, err
+		}
+	}
+	return len(accounts), skipped, nil
+}
+
+// countingReader counts the bytes read from the upload for progress events.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupImportRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/:category_id/import", ImportAccountsFile)
+	return router
+}
+
+// uploadImport posts content as the multipart "file" field.
+func uploadImport(router *gin.Engine, path, filename string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", filename)
+	part.Write(content)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// importSummary returns the data of the final SSE "done" event.
+func importSummary(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	body := w.Body.String()
+	idx := strings.Index(body, "event:done\ndata:")
+	if idx < 0 {
+		t.Fatalf("expected SSE done event, body: %s", body)
+	}
+	line := strings.SplitN(body[idx+len("event:done\ndata:"):], "\n", 2)[0]
+	var summary map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &summary); err != nil {
+		t.Fatalf("invalid done event %q: %v", line, err)
+	}
+	return summary
+}
+
+func TestImportAccountsFile_TxtDedupe(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupImportRouter()
+	cat := testutil.SeedCategory(t, "import")
+	testutil.SeedAccount(t, cat.ID, "existing:1")
+
+	content := []byte("a:1\r\nb:2\n\n   \nexisting:1\na:1\nc:3")
+	w := uploadImport(router, fmt.Sprintf("/api/accounts/%d/import", cat.ID), "dump.txt", content)
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), "event:progress") {
+		t.Error("expected a progress event")
+	}
+	summary := importSummary(t, w)
+	testutil.AssertJSONField(t, summary, "inserted", 3)
+	testutil.AssertJSONField(t, summary, "skipped", 2)
+	testutil.AssertJSONField(t, summary, "invalid", 0)
+
+	var data []string
+	database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Order("id").Pluck("data", &data)
+	if strings.Join(data, ",") != "existing:1,a:1,b:2,c:3" {
+		t.Errorf("unexpected accounts %v", data)
+	}
+}
+
+func TestImportAccountsFile_CSVWithTagsAndInvalidLines(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupImportRouter()
+	cat := testutil.SeedCategory(t, "import")
+
+	content := []byte("id,data,tags\n1,\"a,with,commas\",\"vip,new\"\n2,,\n3,b:2,\n")
+	w := uploadImport(router, fmt.Sprintf("/api/accounts/%d/import", cat.ID), "export.csv", content)
+	summary := importSummary(t, w)
+	testutil.AssertJSONField(t, summary, "inserted", 2)
+	testutil.AssertJSONField(t, summary, "invalid", 1)
+	errs := testutil.GetJSONArray(summary, "errors")
+	if len(errs) != 1 || errs[0].(map[string]interface{})["line"] != float64(3) {
+		t.Errorf("expected line 3 reported invalid, got %v", errs)
+	}
+
+	var acc database.Account
+	database.DB.Where("data_hash = ?", database.HashData("a,with,commas")).First(&acc)
+	accounts := []database.Account{acc}
+	database.LoadTags(database.DB, accounts)
+	if len(accounts[0].Tags) != 2 {
+		t.Errorf("expected 2 tags, got %v", accounts[0].Tags)
+	}
+}
+
+func TestImportAccountsFile_GzipJSONL(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupImportRouter()
+	cat := testutil.SeedCategory(t, "import")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("{\"data\":\"a:1\",\"tags\":[\"vip\"]}\nnot json\n{\"tags\":[\"x\"]}\n{\"data\":\"b:2\"}\n"))
+	gz.Close()
+
+	w := uploadImport(router, fmt.Sprintf("/api/accounts/%d/import", cat.ID), "dump.jsonl.gz", buf.Bytes())
+	summary := importSummary(t, w)
+	testutil.AssertJSONField(t, summary, "processed", 4)
+	testutil.AssertJSONField(t, summary, "inserted", 2)
+	testutil.AssertJSONField(t, summary, "invalid", 2)
+}
+
+func TestImportAccountsFile_Batches(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupImportRouter()
+	cat := testutil.SeedCategory(t, "import")
+
+	var content strings.Builder
+	for i := 0; i < importBatchSize*2+5; i++ {
+		fmt.Fprintf(&content, "user%d:pw\n", i)
+	}
+	w := uploadImport(router, fmt.Sprintf("/api/accounts/%d/import?format=txt", cat.ID), "dump.dat", []byte(content.String()))
+	if n := strings.Count(w.Body.String(), "event:progress"); n != 3 {
+		t.Errorf("expected 3 progress events, got %d", n)
+	}
+	testutil.AssertJSONField(t, importSummary(t, w), "inserted", importBatchSize*2+5)
+}
+
+func TestImportAccountsFile_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupImportRouter()
+	cat := testutil.SeedCategory(t, "import")
+	path := fmt.Sprintf("/api/accounts/%d/import", cat.ID)
+
+	w := uploadImport(router, "/api/accounts/999/import", "dump.txt", []byte("a"))
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+
+	w = uploadImport(router, path+"?format=xml", "dump.txt", []byte("a"))
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+
+	w = uploadImport(router, path, "dump.csv", []byte("user,pass\na,b\n"))
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+
+	w = testutil.DoRequest(router, http.MethodPost, path, strings.NewReader("a:1"), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
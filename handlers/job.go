@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	jobs.Register(jobs.TypeDeleteAccounts, runDeleteAccountsJob)
+	jobs.Register(jobs.TypeImportAccounts, runImportAccountsJob)
+	jobs.Register(jobs.TypeExportAccounts, runExportAccountsJob)
+	jobs.Register(jobs.TypeInstallPackage, runInstallPackageJob)
+	jobs.Register(jobs.TypeInstallRequirements, runInstallRequirementsJob)
+	jobs.Register(jobs.TypeReparseAccounts, runReparseAccountsJob)
+}
+
+// wantsAsync reports whether the caller asked for ?async=true, running the
+// operation as a background job instead of in the request. Jobs are opt-in so
+// clients written against the synchronous responses keep working.
+func wantsAsync(c *gin.Context) bool {
+	async, _ := strconv.ParseBool(c.Query("async"))
+	return async
+}
+
+// enqueueJob starts a background job and answers 202 with it. It returns
+// nil after answering with an error.
+func enqueueJob(c *gin.Context, jobType string, categoryID uint, params interface{}, input io.Reader) *database.Job {
+	job, err := jobs.Enqueue(jobType, categoryID, params, input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	c.JSON(http.StatusAccepted, jobResponse(*job, false))
+	return job
+}
+
+// jobResponse renders a job with its result decoded. The log is only
+// included when withLog is set, since it can be large.
+func jobResponse(job database.Job, withLog bool) gin.H {
+	var result interface{}
+	if job.Result != "" {
+		result = json.RawMessage(job.Result)
+	}
+	h := gin.H{
+		"id":          job.ID,
+		"type":        job.Type,
+		"category_id": job.CategoryID,
+		"status":      job.Status,
+		"progress":    job.Progress,
+		"total":       job.Total,
+		"result":      result,
+		"error":       job.Error,
+		"created_at":  job.CreatedAt,
+		"started_at":  job.StartedAt,
+		"finished_at": job.FinishedAt,
+	}
+	if withLog {
+		h["log"] = job.Log
+	}
+	return h
+}
+
+// loadJob finds the job in the :id path parameter, writing 404 or 403 and
+// returning false when it is missing or outside the token's scope.
+func loadJob(c *gin.Context) (database.Job, bool) {
+	var job database.Job
+	if err := database.DB.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return job, false
+	}
+	if job.CategoryID != 0 && denyCategory(c, job.CategoryID) {
+		return job, false
+	}
+	return job, true
+}
+
+// GetJobs lists jobs newest first, filtered by ?status, ?type and ?category_id.
+func GetJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	query := database.DB.Model(&database.Job{})
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("category_id IN ?", append(ids, 0))
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+
+	var total int64
+	query.Count(&total)
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	var list []database.Job
+	if err := query.Omit("log").Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data := make([]gin.H, len(list))
+	for i, job := range list {
+		data[i] = jobResponse(job, false)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data, "total": total, "page": page, "limit": limit})
+}
+
+// GetJob reports a job's status, progress, log and result.
+func GetJob(c *gin.Context) {
+	job, ok := loadJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, jobResponse(job, true))
+}
+
+// CancelJob stops a pending or running job.
+func CancelJob(c *gin.Context) {
+	job, ok := loadJob(c)
+	if !ok {
+		return
+	}
+	if !jobs.Cancel(job.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "job is not running"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "cancel requested"})
+}
+
+// DownloadJobOutput serves the file written by a finished export job.
+func DownloadJobOutput(c *gin.Context) {
+	job, ok := loadJob(c)
+	if !ok {
+		return
+	}
+	if job.Status != jobs.StatusSuccess {
+		c.JSON(http.StatusConflict, gin.H{"error": "job has not finished successfully"})
+		return
+	}
+	var result struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+	}
+	json.Unmarshal([]byte(job.Result), &result)
+	if result.Filename == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job has no output"})
+		return
+	}
+	// The file may outlive its retention until the next sweep; never serve it then
+	if job.FinishedAt != nil && time.Since(*job.FinishedAt) >= jobs.OutputRetention {
+		c.JSON(http.StatusGone, gin.H{"error": "job output has expired"})
+		return
+	}
+	path := jobs.OutputPath(job.ID)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job has no output"})
+		return
+	}
+	c.Header("Content-Type", result.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, result.Filename))
+	c.File(path)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/jobs"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupJobRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.DELETE("/api/accounts", DeleteAccounts)
+	router.POST("/api/accounts/:category_id/import", ImportAccountsFile)
+	router.GET("/api/accounts/:category_id/export", ExportAccounts)
+	router.GET("/api/jobs", GetJobs)
+	router.GET("/api/jobs/:id", GetJob)
+	router.POST("/api/jobs/:id/cancel", CancelJob)
+	router.GET("/api/jobs/:id/download", DownloadJobOutput)
+	return router
+}
+
+// useJobDir points job files at a temp dir for the test.
+func useJobDir(t *testing.T) {
+	t.Helper()
+	oldDir := jobs.Dir
+	jobs.Dir = t.TempDir()
+	t.Cleanup(func() { jobs.Dir = oldDir })
+}
+
+// startJobWorkers runs the worker pool against a file database, since the
+// workers use their own connections.
+func startJobWorkers(t *testing.T) {
+	t.Helper()
+	testutil.SetupFileTestDB(t)
+	useJobDir(t)
+	jobs.Start(1)
+	t.Cleanup(jobs.Stop)
+}
+
+// waitForJob polls the job endpoint until the job has finished.
+func waitForJob(t *testing.T, router *gin.Engine, id interface{}) map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/jobs/%v", id), nil, "")
+		job := testutil.ParseJSON(t, w)
+		if status := job["status"]; status != jobs.StatusPending && status != jobs.StatusRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %v did not finish, status %v", id, job["status"])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeleteAccounts_Async(t *testing.T) {
+	startJobWorkers(t)
+	router := setupJobRouter()
+	cat := testutil.SeedCategory(t, "job-delete")
+	testutil.SeedAccount(t, cat.ID, "avail1")
+	testutil.SeedAccountWithStatus(t, cat.ID, "used1", true, false)
+	testutil.SeedAccountWithStatus(t, cat.ID, "used2", true, false)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"category_id": cat.ID, "used": true})
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/accounts?async=true", body, "")
+	testutil.AssertStatus(t, w, http.StatusAccepted)
+	queued := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, queued, "type", jobs.TypeDeleteAccounts)
+	testutil.AssertJSONField(t, queued, "status", jobs.StatusPending)
+
+	job := waitForJob(t, router, queued["id"])
+	testutil.AssertJSONField(t, job, "status", jobs.StatusSuccess)
+	testutil.AssertJSONField(t, job, "progress", 2)
+	result := job["result"].(map[string]interface{})
+	testutil.AssertJSONField(t, result, "deleted", 2)
+
+	var remaining int64
+	database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("expected 1 remaining account, got %d", remaining)
+	}
+}
+
+func TestImportAccountsFile_Async(t *testing.T) {
+	startJobWorkers(t)
+	router := setupJobRouter()
+	cat := testutil.SeedCategory(t, "job-import")
+	testutil.SeedAccount(t, cat.ID, "existing:1")
+
+	w := uploadImport(router, fmt.Sprintf("/api/accounts/%d/import?async=true", cat.ID), "dump.txt", []byte("a:1\nexisting:1\nb:2\n"))
+	testutil.AssertStatus(t, w, http.StatusAccepted)
+
+	job := waitForJob(t, router, testutil.ParseJSON(t, w)["id"])
+	testutil.AssertJSONField(t, job, "status", jobs.StatusSuccess)
+	result := job["result"].(map[string]interface{})
+	testutil.AssertJSONField(t, result, "inserted", 2)
+	testutil.AssertJSONField(t, result, "skipped", 1)
+	if job["progress"] != job["total"] {
+		t.Errorf("expected progress %v to reach total %v", job["progress"], job["total"])
+	}
+}
+
+func TestUpdateAccountSchema_Async(t *testing.T) {
+	startJobWorkers(t)
+	router := setupJobRouter()
+	router.PUT("/api/categories/:id/account-schema", UpdateAccountSchema)
+	cat := testutil.SeedCategory(t, "job-schema")
+	testutil.SeedAccount(t, cat.ID, "a:1")
+	testutil.SeedAccount(t, cat.ID, "b")
+
+	schema := map[string]interface{}{"format": "delimited", "delimiter": ":", "fields": []map[string]string{{"name": "user"}, {"name": "pass"}}}
+	body := testutil.MakeJSON(t, map[string]interface{}{"account_schema": schema})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/account-schema?async=true", cat.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusAccepted)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "type", jobs.TypeReparseAccounts)
+
+	job := waitForJob(t, router, testutil.ParseJSON(t, w)["id"])
+	testutil.AssertJSONField(t, job, "status", jobs.StatusSuccess)
+	testutil.AssertJSONField(t, job, "progress", 2)
+	result := job["result"].(map[string]interface{})
+	testutil.AssertJSONField(t, result, "parsed", 1)
+	testutil.AssertJSONField(t, result, "failed", 1)
+}
+
+func TestExportAccounts_AsyncDownload(t *testing.T) {
+	startJobWorkers(t)
+	router := setupJobRouter()
+	cat := testutil.SeedCategory(t, "job-export")
+	testutil.SeedAccount(t, cat.ID, "a:1")
+	testutil.SeedAccount(t, cat.ID, "b:2")
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/export?async=true", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusAccepted)
+	id := testutil.ParseJSON(t, w)["id"]
+
+	job := waitForJob(t, router, id)
+	testutil.AssertJSONField(t, job, "status", jobs.StatusSuccess)
+	testutil.AssertJSONField(t, job["result"].(map[string]interface{}), "exported", 2)
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/jobs/%v/download", id), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if w.Body.String() != "a:1\nb:2\n" {
+		t.Errorf("unexpected download %q", w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), fmt.Sprintf("category-%d-", cat.ID)) {
+		t.Errorf("unexpected Content-Disposition %q", w.Header().Get("Content-Disposition"))
+	}
+	info, err := os.Stat(jobs.OutputPath(uint(id.(float64))))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected an owner-only output file, got %v (%v)", info, err)
+	}
+
+	// Past the retention the output is refused even before the sweep deletes it
+	database.DB.Model(&database.Job{}).Where("id = ?", id).Update("finished_at", time.Now().Add(-jobs.OutputRetention-time.Minute))
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/jobs/%v/download", id), nil, "")
+	testutil.AssertStatus(t, w, http.StatusGone)
+	jobs.ExpireOutputs()
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/jobs/%v/download", id), nil, "")
+	testutil.AssertStatus(t, w, http.StatusGone)
+}
+
+func TestGetJobs_Filters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	useJobDir(t)
+	router := setupJobRouter()
+	cat := testutil.SeedCategory(t, "job-list")
+	database.DB.Create(&database.Job{Type: jobs.TypeExportAccounts, CategoryID: cat.ID, Status: jobs.StatusSuccess, Log: "done"})
+	database.DB.Create(&database.Job{Type: jobs.TypeDeleteAccounts, CategoryID: cat.ID, Status: jobs.StatusFailed})
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/jobs", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 2)
+	first := testutil.GetJSONArray(resp, "data")[0].(map[string]interface{})
+	testutil.AssertJSONField(t, first, "type", jobs.TypeDeleteAccounts)
+	if _, ok := first["log"]; ok {
+		t.Error("expected log omitted from list")
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/jobs?status=success&type="+jobs.TypeExportAccounts, nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+}
+
+func TestCancelJob(t *testing.T) {
+	testutil.SetupTestDB(t)
+	useJobDir(t)
+	router := setupJobRouter()
+	cat := testutil.SeedCategory(t, "job-cancel")
+	job, err := jobs.Enqueue(jobs.TypeDeleteAccounts, cat.ID, deleteAccountsParams{CategoryID: cat.ID}, nil)
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	path := fmt.Sprintf("/api/jobs/%d", job.ID)
+
+	w := testutil.DoRequest(router, http.MethodPost, path+"/cancel", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	w = testutil.DoRequest(router, http.MethodGet, path, nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "status", jobs.StatusCanceled)
+
+	w = testutil.DoRequest(router, http.MethodPost, path+"/cancel", nil, "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+	w = testutil.DoRequest(router, http.MethodGet, path+"/download", nil, "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+	w = testutil.DoRequest(router, http.MethodGet, "/api/jobs/999", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"final-account-hub/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errLeaseExpired = errors.New("lease expired")
+
+// leaseAccountIDs resolves the accounts held by a lease, optionally narrowed to
+// the requested subset. It writes the error response and returns false when
+// the lease does not exist or is outside the caller's token scope.
+func leaseAccountIDs(c *gin.Context, leaseID string, requested []uint) ([]uint, bool) {
+	query := database.DB.Model(&database.Account{}).Where("lease_id = ?", leaseID)
+	if len(requested) > 0 {
+		query = query.Where("id IN ?", requested)
+	}
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "lease not found"})
+		return nil, false
+	}
+	if denyAccounts(c, ids) {
+		return nil, false
+	}
+	return ids, true
+}
+
+// bindOptionalJSON binds a JSON body that may be omitted entirely.
+func bindOptionalJSON(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// ReleaseLease returns leased accounts to the available pool.
+func ReleaseLease(c *gin.Context) {
+	leaseID := c.Param("id")
+	var req struct {
+		AccountIDs []uint `json:"account_ids"`
+	}
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, ok := leaseAccountIDs(c, leaseID, req.AccountIDs)
+	if !ok {
+		return
+	}
+	_, actor := auditActor(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		states, err := database.LoadAccountStates(tx, ids)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&database.Account{}).Where("id IN ? AND lease_id = ?", ids, leaseID).
+			Updates(map[string]interface{}{"used": false, "lease_id": nil, "lease_expires_at": nil}).Error; err != nil {
+			return err
+		}
+		return database.RecordAccountChanges(tx, states, database.HistorySource{Source: database.HistorySourceLease, Actor: actor})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "released", "count": len(ids)})
+}
+
+// RenewLease pushes the lease deadline lease_seconds into the future.
+// Leases that already expired cannot be renewed.
+func RenewLease(c *gin.Context) {
+	leaseID := c.Param("id")
+	var req struct {
+		LeaseSeconds int    `json:"lease_seconds" binding:"required"`
+		AccountIDs   []uint `json:"account_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.LeaseSeconds < 1 || req.LeaseSeconds > database.MaxLeaseSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lease_seconds must be between 1 and 86400"})
+		return
+	}
+
+	ids, ok := leaseAccountIDs(c, leaseID, req.AccountIDs)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(req.LeaseSeconds) * time.Second)
+	result := database.DB.Model(&database.Account{}).
+		Where("id IN ? AND lease_id = ? AND lease_expires_at >= ?", ids, leaseID, now).
+		Update("lease_expires_at", expiresAt)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errLeaseExpired.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "renewed", "count": result.RowsAffected, "lease_expires_at": expiresAt})
+}
+
+// ConsumeLease ends the lease and counts one use of each account. Multi-use
+// accounts that still have uses left return to the available pool.
+func ConsumeLease(c *gin.Context) {
+	leaseID := c.Param("id")
+	var req struct {
+		AccountIDs []uint `json:"account_ids"`
+	}
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, ok := leaseAccountIDs(c, leaseID, req.AccountIDs)
+	if !ok {
+		return
+	}
+	var account database.Account
+	database.DB.Select("category_id").First(&account, ids[0])
+	policy := database.CategoryUsagePolicy(database.DB, account.CategoryID)
+	_, actor := auditActor(c)
+	var consumed int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		states, err := database.LoadAccountStates(tx, ids)
+		if err != nil {
+			return err
+		}
+		// The lease may have expired or been released since it was looked up
+		now := time.Now()
+		consumed, err = database.RecordUse(tx, ids, policy, now, "lease_id = ? AND lease_expires_at >= ?", leaseID, now)
+		if err != nil {
+			return err
+		}
+		if consumed == 0 {
+			return errLeaseExpired
+		}
+		return database.RecordAccountChanges(tx, states, database.HistorySource{Source: database.HistorySourceLease, Actor: actor})
+	})
+	if errors.Is(err, errLeaseExpired) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "consumed", "count": consumed})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupLeaseRouter registers fetch and lease routes without auth middleware.
+func setupLeaseRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/fetch", FetchAccounts)
+	router.POST("/api/accounts/leases/:id/release", ReleaseLease)
+	router.POST("/api/accounts/leases/:id/renew", RenewLease)
+	router.POST("/api/accounts/leases/:id/consume", ConsumeLease)
+	return router
+}
+
+// leaseAccounts performs a lease-mode fetch and returns the lease ID.
+func leaseAccounts(t *testing.T, router *gin.Engine, categoryID uint, count, seconds int) string {
+	t.Helper()
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"category_id":   categoryID,
+		"count":         count,
+		"lease_seconds": seconds,
+	})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != count {
+		t.Fatalf("expected %d leased accounts, got %d", count, len(arr))
+	}
+	leaseID, _ := arr[0]["lease_id"].(string)
+	if leaseID == "" {
+		t.Fatalf("expected lease_id in response, got %v", arr[0])
+	}
+	if arr[0]["lease_expires_at"] == nil {
+		t.Fatal("expected lease_expires_at in response")
+	}
+	return leaseID
+}
+
+func countAvailable(categoryID uint) int64 {
+	var n int64
+	database.DB.Model(&database.Account{}).
+		Where("category_id = ? AND used = ? AND banned = ?", categoryID, false, false).Count(&n)
+	return n
+}
+
+func TestFetchAccounts_LeaseChecksOut(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-cat")
+	testutil.SeedAccounts(t, cat.ID, 3, "ls")
+
+	leaseAccounts(t, router, cat.ID, 2, 60)
+	if n := countAvailable(cat.ID); n != 1 {
+		t.Errorf("expected 1 available after lease, got %d", n)
+	}
+
+	// Leased accounts are not visible to a non-marking fetch of used accounts either
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"category_id": cat.ID, "count": 10, "account_type": "used", "mark_as_used": false,
+	})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", body, "")
+	if arr := testutil.ParseJSONArray(t, w); len(arr) != 0 {
+		t.Errorf("expected leased accounts to be hidden, got %d", len(arr))
+	}
+}
+
+func TestFetchAccounts_LeaseInvalidOptions(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-invalid")
+
+	cases := []map[string]interface{}{
+		{"category_id": cat.ID, "count": 1, "lease_seconds": -1},
+		{"category_id": cat.ID, "count": 1, "lease_seconds": database.MaxLeaseSeconds + 1},
+		{"category_id": cat.ID, "count": 1, "lease_seconds": 60, "mark_as_used": false},
+		{"category_id": cat.ID, "count": 1, "lease_seconds": 60, "account_type": "used"},
+	}
+	for _, tc := range cases {
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, tc), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestReleaseLease_ReturnsToPool(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-release")
+	testutil.SeedAccounts(t, cat.ID, 2, "rl")
+
+	leaseID := leaseAccounts(t, router, cat.ID, 2, 60)
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/release", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "count", 2)
+
+	if n := countAvailable(cat.ID); n != 2 {
+		t.Errorf("expected 2 available after release, got %d", n)
+	}
+	var leased int64
+	database.DB.Model(&database.Account{}).Where("lease_id IS NOT NULL").Count(&leased)
+	if leased != 0 {
+		t.Errorf("expected lease to be cleared, got %d leased", leased)
+	}
+}
+
+func TestConsumeLease_PartialSubset(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-consume")
+	accs := testutil.SeedAccounts(t, cat.ID, 2, "cs")
+
+	leaseID := leaseAccounts(t, router, cat.ID, 2, 60)
+	body := testutil.MakeJSON(t, map[string]interface{}{"account_ids": []uint{accs[0].ID}})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/consume", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var consumed database.Account
+	database.DB.First(&consumed, accs[0].ID)
+	if !consumed.Used || consumed.LeaseID != nil {
+		t.Errorf("expected consumed account used with no lease, got used=%v lease=%v", consumed.Used, consumed.LeaseID)
+	}
+	var still database.Account
+	database.DB.First(&still, accs[1].ID)
+	if still.LeaseID == nil || *still.LeaseID != leaseID {
+		t.Error("expected the other account to remain leased")
+	}
+}
+
+func TestConsumeLease_MultiUseReturnsToPool(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-multi-use")
+	database.DB.Model(&cat).Update("max_uses", 2)
+	accs := testutil.SeedAccounts(t, cat.ID, 1, "mu")
+
+	for i := 1; i <= 2; i++ {
+		leaseID := leaseAccounts(t, router, cat.ID, 1, 60)
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/consume", nil, "")
+		testutil.AssertStatus(t, w, http.StatusOK)
+	}
+
+	var acc database.Account
+	database.DB.First(&acc, accs[0].ID)
+	if acc.UseCount != 2 || !acc.Used {
+		t.Errorf("expected account exhausted after 2 consumed leases, got use_count=%d used=%v", acc.UseCount, acc.Used)
+	}
+}
+
+func TestRenewLease_ExtendsDeadline(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-renew")
+	accs := testutil.SeedAccounts(t, cat.ID, 1, "rn")
+
+	leaseID := leaseAccounts(t, router, cat.ID, 1, 10)
+	body := testutil.MakeJSON(t, map[string]interface{}{"lease_seconds": 3600})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/renew", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var acc database.Account
+	database.DB.First(&acc, accs[0].ID)
+	if acc.LeaseExpiresAt == nil || time.Until(*acc.LeaseExpiresAt) < 30*time.Minute {
+		t.Errorf("expected deadline about an hour out, got %v", acc.LeaseExpiresAt)
+	}
+}
+
+func TestRenewLease_Expired(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-renew-expired")
+	testutil.SeedAccounts(t, cat.ID, 1, "re")
+
+	leaseID := leaseAccounts(t, router, cat.ID, 1, 60)
+	database.DB.Model(&database.Account{}).Where("lease_id = ?", leaseID).
+		Update("lease_expires_at", time.Now().Add(-time.Minute))
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"lease_seconds": 60})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/renew", body, "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+}
+
+func TestConsumeLease_Expired(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-consume-expired")
+	testutil.SeedAccounts(t, cat.ID, 1, "ce")
+
+	leaseID := leaseAccounts(t, router, cat.ID, 1, 60)
+	database.DB.Model(&database.Account{}).Where("lease_id = ?", leaseID).
+		Update("lease_expires_at", time.Now().Add(-time.Minute))
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/"+leaseID+"/consume", nil, "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+	var acc database.Account
+	database.DB.Where("category_id = ?", cat.ID).First(&acc)
+	if acc.UseCount != 0 || acc.LastUsedAt != nil {
+		t.Errorf("expected an expired lease not to count a use, got %+v", acc)
+	}
+}
+
+func TestLease_UnknownID(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/nope/release", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/leases/nope/consume", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestReleaseExpiredLeases_Sweeper(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupLeaseRouter()
+	cat := testutil.SeedCategory(t, "lease-sweep")
+	testutil.SeedAccounts(t, cat.ID, 3, "sw")
+
+	expired := leaseAccounts(t, router, cat.ID, 2, 60)
+	leaseAccounts(t, router, cat.ID, 1, 60)
+	database.DB.Model(&database.Account{}).Where("lease_id = ?", expired).
+		Update("lease_expires_at", time.Now().Add(-time.Second))
+
+	if n := database.ReleaseExpiredLeases(); n != 2 {
+		t.Errorf("expected 2 accounts released, got %d", n)
+	}
+	if n := countAvailable(cat.ID); n != 2 {
+		t.Errorf("expected 2 available after sweep, got %d", n)
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"final-account-hub/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the line-by-line comparison table of a diff.
+const maxDiffCells = 4 << 20
+
+var errDiffTooLarge = errors.New("scripts are too large to diff")
+
+// GetScriptRevisions lists a category's validation script revisions, newest
+// first and without the script text.
+func GetScriptRevisions(c *gin.Context) {
+	id := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	var cat database.Category
+	if err := database.DB.Select("id, script_revision").First(&cat, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	var total int64
+	database.DB.Model(&database.ScriptRevision{}).Where("category_id = ?", cat.ID).Count(&total)
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	var revisions []database.ScriptRevision
+	if err := database.DB.Omit("script").Where("category_id = ?", cat.ID).Order("revision DESC").
+		Offset((page - 1) * limit).Limit(limit).Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": revisions, "total": total, "page": page, "limit": limit, "current": cat.ScriptRevision})
+}
+
+// loadScriptRevision finds the revision in the :rev path parameter of the
+// category in :id, writing 404 and returning false when it does not exist.
+func loadScriptRevision(c *gin.Context) (database.ScriptRevision, bool) {
+	var rev database.ScriptRevision
+	err := database.DB.Where("category_id = ? AND revision = ?", c.Param("id"), c.Param("rev")).First(&rev).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return rev, false
+	}
+	return rev, true
+}
+
+// GetScriptRevision returns one revision with its script.
+func GetScriptRevision(c *gin.Context) {
+	rev, ok := loadScriptRevision(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// DiffScriptRevision returns a unified diff from the revision in ?from
+// (default the previous one) to the revision in the path.
+func DiffScriptRevision(c *gin.Context) {
+	to, ok := loadScriptRevision(c)
+	if !ok {
+		return
+	}
+	var from database.ScriptRevision
+	query := database.DB.Where("category_id = ?", to.CategoryID)
+	if raw := c.Query("from"); raw != "" {
+		if err := query.Where("revision = ?", raw).First(&from).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+			return
+		}
+	} else {
+		// The first revision is compared against an empty script
+		query.Where("revision < ?", to.Revision).Order("revision DESC").Limit(1).Find(&from)
+	}
+
+	diff, err := unifiedDiff(fmt.Sprintf("revision %d", from.Revision), fmt.Sprintf("revision %d", to.Revision), from.Script, to.Script)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from.Revision, "to": to.Revision, "diff": diff})
+}
+
+// RollbackScriptRevision makes the revision's script the category's
+// validation script again, saved as a new revision.
+func RollbackScriptRevision(c *gin.Context) {
+	target, ok := loadScriptRevision(c)
+	if !ok {
+		return
+	}
+	var old database.Category
+	if err := database.DB.First(&old, target.CategoryID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	_, author := auditActor(c)
+	var rev database.ScriptRevision
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Keep the script being replaced if it was never saved as a revision
+		if _, _, err := database.SaveScriptRevision(tx, old.ID, old.ValidationScript, "", ""); err != nil {
+			return err
+		}
+		if err := tx.Model(&database.Category{}).Where("id = ?", old.ID).Update("validation_script", target.Script).Error; err != nil {
+			return err
+		}
+		var err error
+		rev, _, err = database.SaveScriptRevision(tx, old.ID, target.Script, author,
+			fmt.Sprintf("rollback to revision %d", target.Revision))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auditCategoryUpdate(c, old, gin.H{"validation_script": target.Script})
+	c.JSON(http.StatusOK, gin.H{"message": "rolled back", "script_revision": rev.Revision})
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns a unified diff from a to b, or "" when they are equal.
+func unifiedDiff(fromName, toName, a, b string) (string, error) {
+	ops, err := diffLines(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+
+	// before[i] counts the lines of a and b preceding ops[i]
+	aBefore := make([]int, len(ops)+1)
+	bBefore := make([]int, len(ops)+1)
+	var changes []int
+	for i, op := range ops {
+		aBefore[i+1], bBefore[i+1] = aBefore[i], bBefore[i]
+		if op.kind != '+' {
+			aBefore[i+1]++
+		}
+		if op.kind != '-' {
+			bBefore[i+1]++
+		}
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(changes); {
+		// Changes whose context would touch share a hunk
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext+1 {
+			j++
+		}
+		start := max(changes[i]-diffContext, 0)
+		end := min(changes[j]+diffContext+1, len(ops))
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(aBefore[start], aBefore[end]-aBefore[start]),
+			hunkRange(bBefore[start], bBefore[end]-bBefore[start]))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		i = j + 1
+	}
+	return sb.String(), nil
+}
+
+// hunkRange formats a hunk's line range; an empty range names the line
+// before it, as in diff -u.
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script between a and b from their
+// longest common subsequence.
+func diffLines(a, b []string) ([]diffOp, error) {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return nil, errDiffTooLarge
+	}
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops, nil
+}
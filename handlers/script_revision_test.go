@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupScriptRevisionRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/validation-script", UpdateCategoryValidationScript)
+	router.GET("/api/categories/:id/script-revisions", GetScriptRevisions)
+	router.GET("/api/categories/:id/script-revisions/:rev", GetScriptRevision)
+	router.GET("/api/categories/:id/script-revisions/:rev/diff", DiffScriptRevision)
+	router.POST("/api/categories/:id/script-revisions/:rev/rollback", RollbackScriptRevision)
+	return router
+}
+
+func saveScript(t *testing.T, router *gin.Engine, catID uint, script string) {
+	t.Helper()
+	body := testutil.MakeJSON(t, map[string]interface{}{"validation_script": script})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/categories/%d/validation-script", catID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	diff, err := unifiedDiff("a", "b", a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a\n+++ b\n" +
+		"@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n" +
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+	if diff != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff, want)
+	}
+
+	if diff, _ := unifiedDiff("a", "b", a, a); diff != "" {
+		t.Errorf("expected empty diff for equal texts, got %q", diff)
+	}
+	if diff, _ := unifiedDiff("a", "b", "", "x\n"); diff != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("unexpected diff from empty text %q", diff)
+	}
+	huge := strings.Repeat("x\n", 3000)
+	if _, err := unifiedDiff("a", "b", huge, huge+"y"); err != errDiffTooLarge {
+		t.Errorf("expected errDiffTooLarge, got %v", err)
+	}
+}
+
+func TestScriptRevisions_SaveListAndDiff(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupScriptRevisionRouter()
+	cat := testutil.SeedCategory(t, "revisions")
+	// A script saved before revisions were kept becomes revision 1
+	database.DB.Model(&cat).Update("validation_script", "legacy")
+
+	saveScript(t, router, cat.ID, "v2")
+	saveScript(t, router, cat.ID, "v2")
+	saveScript(t, router, cat.ID, "v3")
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 3)
+	testutil.AssertJSONField(t, resp, "current", 3)
+	latest := testutil.GetJSONArray(resp, "data")[0].(map[string]interface{})
+	testutil.AssertJSONField(t, latest, "revision", 3)
+	testutil.AssertJSONField(t, latest, "author", "passkey")
+	if latest["script"] != "" {
+		t.Errorf("expected script omitted from list, got %v", latest["script"])
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions/1", cat.ID), nil, "")
+	rev := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, rev, "script", "legacy")
+	testutil.AssertJSONField(t, rev, "author", "")
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions/3/diff", cat.ID), nil, "")
+	diff := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, diff, "from", 2)
+	testutil.AssertJSONField(t, diff, "diff", "--- revision 2\n+++ revision 3\n@@ -1,1 +1,1 @@\n-v2\n+v3\n")
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions/3/diff?from=1", cat.ID), nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "from", 1)
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions/9", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/categories/%d/script-revisions/3/diff?from=9", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestRollbackScriptRevision(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupScriptRevisionRouter()
+	cat := testutil.SeedCategory(t, "rollback")
+	saveScript(t, router, cat.ID, "good")
+	saveScript(t, router, cat.ID, "broken")
+
+	w := testutil.DoRequest(router, http.MethodPost, fmt.Sprintf("/api/categories/%d/script-revisions/1/rollback", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "script_revision", 3)
+
+	var got database.Category
+	database.DB.First(&got, cat.ID)
+	if got.ValidationScript != "good" || got.ScriptRevision != 3 {
+		t.Errorf("expected script good at revision 3, got %q at %d", got.ValidationScript, got.ScriptRevision)
+	}
+	var rev database.ScriptRevision
+	database.DB.Where("category_id = ? AND revision = 3", cat.ID).First(&rev)
+	if rev.Message != "rollback to revision 1" {
+		t.Errorf("unexpected rollback message %q", rev.Message)
+	}
+	var audit database.AuditLog
+	database.DB.Order("id DESC").First(&audit)
+	if audit.Before["validation_script"] != "broken" || audit.After["validation_script"] != "good" {
+		t.Errorf("expected rollback audited, got %v -> %v", audit.Before, audit.After)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+
+	"final-account-hub/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// bindTagRequest parses the shared {"ids": [...], "tags": [...]} body of the
+// tag endpoints. It writes the error response and returns false on failure.
+func bindTagRequest(c *gin.Context) ([]uint, []string, bool) {
+	var req struct {
+		IDs  []uint   `json:"ids" binding:"required"`
+		Tags []string `json:"tags" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if len(req.IDs) > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max 10000 IDs per request"})
+		return nil, nil, false
+	}
+	tags, err := database.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one tag required"})
+		return nil, nil, false
+	}
+	if denyAccounts(c, req.IDs) {
+		return nil, nil, false
+	}
+	return req.IDs, tags, true
+}
+
+// AddAccountTags attaches tags to accounts. Tags an account already has are
+// left untouched.
+func AddAccountTags(c *gin.Context) {
+	ids, tags, ok := bindTagRequest(c)
+	if !ok {
+		return
+	}
+
+	var existingIDs []uint
+	if err := database.DB.Model(&database.Account{}).Where("id IN ?", ids).Pluck("id", &existingIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []database.AccountTag
+	for _, id := range existingIDs {
+		for _, t := range tags {
+			rows = append(rows, database.AccountTag{AccountID: id, Tag: t})
+		}
+	}
+	var added int64
+	if len(rows) > 0 {
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, 500)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		added = result.RowsAffected
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "tagged", "accounts": len(existingIDs), "added": added})
+}
+
+// RemoveAccountTags detaches tags from accounts.
+func RemoveAccountTags(c *gin.Context) {
+	ids, tags, ok := bindTagRequest(c)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Where("account_id IN ? AND tag IN ?", ids, tags).Delete(&database.AccountTag{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "untagged", "removed": result.RowsAffected})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTagRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.POST("/api/accounts/tags", AddAccountTags)
+	router.DELETE("/api/accounts/tags", RemoveAccountTags)
+	router.GET("/api/accounts/:category_id", GetAccounts)
+	router.POST("/api/accounts/fetch", FetchAccounts)
+	router.GET("/api/accounts/:category_id/stats", GetAccountStats)
+	return router
+}
+
+func tagAccounts(t *testing.T, router *gin.Engine, ids []uint, tags ...string) {
+	t.Helper()
+	body := testutil.MakeJSON(t, map[string]interface{}{"ids": ids, "tags": tags})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/tags", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+}
+
+func TestAddAccountTags_Success(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	cat := testutil.SeedCategory(t, "tags-add")
+	accs := testutil.SeedAccounts(t, cat.ID, 2, "t")
+	ids := []uint{accs[0].ID, accs[1].ID, 9999}
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"ids": ids, "tags": []string{" eu ", "gold", "eu", ""}})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/tags", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "accounts", 2)
+	testutil.AssertJSONField(t, data, "added", 4)
+
+	// Re-tagging is a no-op
+	w = testutil.DoRequest(router, http.MethodPost, "/api/accounts/tags", testutil.MakeJSON(t, map[string]interface{}{"ids": ids, "tags": []string{"eu"}}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "added", 0)
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d", cat.ID), nil, "")
+	first := testutil.GetJSONArray(testutil.ParseJSON(t, w), "data")[0].(map[string]interface{})
+	tags, _ := first["tags"].([]interface{})
+	if len(tags) != 2 || tags[0] != "eu" || tags[1] != "gold" {
+		t.Errorf("expected tags [eu gold], got %v", first["tags"])
+	}
+}
+
+func TestAddAccountTags_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	for _, body := range []map[string]interface{}{
+		{"ids": []uint{1}},
+		{"ids": []uint{1}, "tags": []string{" "}},
+		{"tags": []string{"eu"}},
+	} {
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/tags", testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusBadRequest)
+	}
+}
+
+func TestRemoveAccountTags_Success(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	cat := testutil.SeedCategory(t, "tags-remove")
+	acc := testutil.SeedAccount(t, cat.ID, "r1")
+	tagAccounts(t, router, []uint{acc.ID}, "eu", "gold")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{acc.ID}, "tags": []string{"gold", "missing"}})
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/accounts/tags", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "removed", 1)
+
+	var remaining []string
+	database.DB.Model(&database.AccountTag{}).Where("account_id = ?", acc.ID).Pluck("tag", &remaining)
+	if len(remaining) != 1 || remaining[0] != "eu" {
+		t.Errorf("expected only eu to remain, got %v", remaining)
+	}
+}
+
+func TestFetchAccounts_TagFilters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	cat := testutil.SeedCategory(t, "tags-fetch")
+	eu := testutil.SeedAccount(t, cat.ID, "eu-basic")
+	euGold := testutil.SeedAccount(t, cat.ID, "eu-gold")
+	us := testutil.SeedAccount(t, cat.ID, "us-gold")
+	tagAccounts(t, router, []uint{eu.ID, euGold.ID}, "eu")
+	tagAccounts(t, router, []uint{euGold.ID, us.ID}, "gold")
+
+	cases := []struct {
+		tags, exclude []string
+		want          []string
+	}{
+		{[]string{"eu"}, nil, []string{"eu-basic", "eu-gold"}},
+		{[]string{"eu", "gold"}, nil, []string{"eu-gold"}},
+		{nil, []string{"gold"}, []string{"eu-basic"}},
+		{[]string{"gold"}, []string{"eu"}, []string{"us-gold"}},
+	}
+	for _, tc := range cases {
+		body := map[string]interface{}{"category_id": cat.ID, "count": 10, "mark_as_used": false, "tags": tc.tags, "exclude_tags": tc.exclude}
+		w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", testutil.MakeJSON(t, body), "")
+		testutil.AssertStatus(t, w, http.StatusOK)
+		arr := testutil.ParseJSONArray(t, w)
+		if len(arr) != len(tc.want) {
+			t.Errorf("tags=%v exclude=%v: expected %v, got %d accounts", tc.tags, tc.exclude, tc.want, len(arr))
+			continue
+		}
+		for i, acc := range arr {
+			if acc["data"] != tc.want[i] {
+				t.Errorf("tags=%v exclude=%v: expected %v, got %v", tc.tags, tc.exclude, tc.want[i], acc["data"])
+			}
+		}
+	}
+}
+
+func TestGetAccounts_TagFilters(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	cat := testutil.SeedCategory(t, "tags-list")
+	a := testutil.SeedAccount(t, cat.ID, "a")
+	testutil.SeedAccount(t, cat.ID, "b")
+	tagAccounts(t, router, []uint{a.ID}, "eu")
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d?tags=eu", cat.ID), nil, "")
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "total", 1)
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d?exclude_tags=eu,apac", cat.ID), nil, "")
+	data = testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "total", 1)
+	if first := testutil.GetJSONArray(data, "data")[0].(map[string]interface{}); first["data"] != "b" {
+		t.Errorf("expected untagged account b, got %v", first["data"])
+	}
+}
+
+func TestGetAccountStats_TagCounts(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+
+	cat := testutil.SeedCategory(t, "tags-stats")
+	a := testutil.SeedAccount(t, cat.ID, "a")
+	b := testutil.SeedAccountWithStatus(t, cat.ID, "b", true, false)
+	tagAccounts(t, router, []uint{a.ID, b.ID}, "eu")
+	tagAccounts(t, router, []uint{b.ID}, "gold")
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/accounts/%d/stats", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	tags := testutil.GetJSONArray(testutil.ParseJSON(t, w), "tags")
+	if len(tags) != 2 {
+		t.Fatalf("expected 2 tag counts, got %v", tags)
+	}
+	eu := tags[0].(map[string]interface{})
+	testutil.AssertJSONField(t, eu, "tag", "eu")
+	testutil.AssertJSONField(t, eu, "total", 2)
+	testutil.AssertJSONField(t, eu, "available", 1)
+	gold := tags[1].(map[string]interface{})
+	testutil.AssertJSONField(t, gold, "tag", "gold")
+	testutil.AssertJSONField(t, gold, "available", 0)
+}
+
+func TestDeleteAccountsByIds_KeepsTagsUntilPurged(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupTagRouter()
+	router.DELETE("/api/accounts/by-ids", DeleteAccountsByIds)
+	router.DELETE("/api/trash/accounts", PurgeTrashAccounts)
+
+	cat := testutil.SeedCategory(t, "tags-delete")
+	acc := testutil.SeedAccount(t, cat.ID, "gone")
+	tagAccounts(t, router, []uint{acc.ID}, "eu")
+
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/accounts/by-ids", testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{acc.ID}}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var count int64
+	database.DB.Model(&database.AccountTag{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected tags to stay with the trashed account, got %d", count)
+	}
+
+	w = testutil.DoRequest(router, http.MethodDelete, "/api/trash/accounts", testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{acc.ID}}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	database.DB.Model(&database.AccountTag{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected tags to be deleted with the purged account, got %d", count)
+	}
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenResponse renders a token with its permissions and category scope as arrays.
+func tokenResponse(t database.APIToken) gin.H {
+	perms := []string{}
+	for _, p := range strings.Split(t.Permissions, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			perms = append(perms, p)
+		}
+	}
+	categoryIDs := t.CategoryIDList()
+	if categoryIDs == nil {
+		categoryIDs = []uint{}
+	}
+	return gin.H{
+		"id":           t.ID,
+		"name":         t.Name,
+		"prefix":       t.Prefix,
+		"permissions":  perms,
+		"category_ids": categoryIDs,
+		"expires_at":   t.ExpiresAt,
+		"last_used_at": t.LastUsedAt,
+		"created_at":   t.CreatedAt,
+		"updated_at":   t.UpdatedAt,
+	}
+}
+
+// tokenAudit is the audited view of a token: what it may do, never its hash.
+func tokenAudit(t database.APIToken) gin.H {
+	resp := tokenResponse(t)
+	return gin.H{
+		"name":         resp["name"],
+		"permissions":  resp["permissions"],
+		"category_ids": resp["category_ids"],
+		"expires_at":   resp["expires_at"],
+	}
+}
+
+// validateTokenPermissions checks every value against database.TokenPermissions
+// and returns them in canonical comma-separated form.
+func validateTokenPermissions(perms []string) (string, bool) {
+	valid := map[string]bool{}
+	for _, p := range database.TokenPermissions {
+		valid[p] = true
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if !valid[p] {
+			return "", false
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ","), len(out) > 0
+}
+
+func CreateToken(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Permissions []string `json:"permissions" binding:"required"`
+		CategoryIDs []uint   `json:"category_ids"`
+		ExpiresAt   *string  `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	perms, ok := validateTokenPermissions(req.Permissions)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "permissions must be a non-empty subset of: fetch, read, write, admin"})
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil && *req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expires_at: must be RFC3339 format (e.g. 2025-01-01T00:00:00Z)"})
+			return
+		}
+		expiresAt = &t
+	}
+
+	plain, err := database.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := database.APIToken{
+		Name:        req.Name,
+		TokenHash:   database.HashToken(plain),
+		Prefix:      plain[:len(database.TokenPrefix)+6],
+		Permissions: perms,
+		CategoryIDs: database.JoinCategoryIDs(req.CategoryIDs),
+		ExpiresAt:   expiresAt,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c, database.AuditTokenCreate, 0, tokenTarget(token.ID), nil, tokenAudit(token))
+
+	// The plaintext token is only ever returned here.
+	resp := tokenResponse(token)
+	resp["token"] = plain
+	c.JSON(http.StatusCreated, resp)
+}
+
+func GetTokens(c *gin.Context) {
+	var tokens []database.APIToken
+	if err := database.DB.Order("id").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]gin.H, 0, len(tokens))
+	for _, t := range tokens {
+		results = append(results, tokenResponse(t))
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func UpdateToken(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Name        *string  `json:"name"`
+		Permissions []string `json:"permissions"`
+		CategoryIDs *[]uint  `json:"category_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var token database.APIToken
+	if err := database.DB.First(&token, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Permissions != nil {
+		perms, ok := validateTokenPermissions(req.Permissions)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "permissions must be a non-empty subset of: fetch, read, write, admin"})
+			return
+		}
+		updates["permissions"] = perms
+	}
+	if req.CategoryIDs != nil {
+		updates["category_ids"] = database.JoinCategoryIDs(*req.CategoryIDs)
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one field required"})
+		return
+	}
+
+	old := token
+	if err := database.DB.Model(&token).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.First(&token, id)
+	before, after := auditChangedKeys(updates, tokenAudit(old), tokenAudit(token))
+	recordAudit(c, database.AuditTokenUpdate, 0, tokenTarget(token.ID), before, after)
+	c.JSON(http.StatusOK, tokenResponse(token))
+}
+
+func DeleteToken(c *gin.Context) {
+	id := c.Param("id")
+	var token database.APIToken
+	database.DB.First(&token, id)
+	result := database.DB.Delete(&database.APIToken{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	recordAudit(c, database.AuditTokenDelete, 0, tokenTarget(token.ID), tokenAudit(token), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// denyCategory writes a 403 and returns true when the caller's token is not
+// allowed to act on categoryID.
+func denyCategory(c *gin.Context, categoryID uint) bool {
+	if middleware.CategoryAllowed(c, categoryID) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "token not allowed for this category"})
+	return true
+}
+
+// denyAccounts writes a 403 and returns true when any of the given accounts,
+// trashed ones included, belongs to a category outside the caller's token
+// scope.
+func denyAccounts(c *gin.Context, ids []uint) bool {
+	allowed, scoped := middleware.AllowedCategoryIDs(c)
+	if !scoped || len(ids) == 0 {
+		return false
+	}
+	var outside int64
+	database.DB.Unscoped().Model(&database.Account{}).
+		Where("id IN ? AND category_id NOT IN ?", ids, append(allowed, 0)).
+		Count(&outside)
+	if outside == 0 {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "token not allowed for this category"})
+	return true
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/middleware"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withToken injects a token into the request context the way AuthMiddleware does.
+func withToken(token *database.APIToken) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_token", token)
+		c.Next()
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Token CRUD
+// ---------------------------------------------------------------------------
+
+func TestCreateToken_Success(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/tokens", CreateToken)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"name":         "worker",
+		"permissions":  []string{"fetch", "read", "fetch"},
+		"category_ids": []uint{1, 2},
+	})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/tokens", body, "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+
+	data := testutil.ParseJSON(t, w)
+	plain, _ := data["token"].(string)
+	if !strings.HasPrefix(plain, database.TokenPrefix) {
+		t.Fatalf("expected plaintext token with prefix %q, got %q", database.TokenPrefix, plain)
+	}
+	if len(testutil.GetJSONArray(data, "permissions")) != 2 {
+		t.Errorf("expected de-duplicated permissions, got %v", data["permissions"])
+	}
+
+	var stored database.APIToken
+	database.DB.First(&stored)
+	if stored.TokenHash != database.HashToken(plain) {
+		t.Error("expected only the token hash to be stored")
+	}
+	if stored.Permissions != "fetch,read" || stored.CategoryIDs != "1,2" {
+		t.Errorf("unexpected stored scope: %q / %q", stored.Permissions, stored.CategoryIDs)
+	}
+}
+
+func TestCreateToken_InvalidPermission(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/tokens", CreateToken)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"name": "bad", "permissions": []string{"root"}})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/tokens", body, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+
+	body = testutil.MakeJSON(t, map[string]interface{}{"name": "empty", "permissions": []string{}})
+	w = testutil.DoRequest(router, http.MethodPost, "/api/tokens", body, "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestGetTokens_OmitsSecrets(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.GET("/api/tokens", GetTokens)
+	database.DB.Create(&database.APIToken{Name: "a", TokenHash: "h1", Permissions: "read"})
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/tokens", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "h1") {
+		t.Error("token hash must not be returned")
+	}
+	if arr := testutil.ParseJSONArray(t, w); len(arr) != 1 {
+		t.Fatalf("expected 1 token, got %d", len(arr))
+	}
+}
+
+func TestUpdateToken_Permissions(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/tokens/:id", UpdateToken)
+	tok := database.APIToken{Name: "a", TokenHash: "h1", Permissions: "read"}
+	database.DB.Create(&tok)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"permissions": []string{"write"}, "category_ids": []uint{5}})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/tokens/%d", tok.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	database.DB.First(&tok, tok.ID)
+	if tok.Permissions != "write" || tok.CategoryIDs != "5" {
+		t.Errorf("unexpected scope after update: %q / %q", tok.Permissions, tok.CategoryIDs)
+	}
+}
+
+func TestDeleteToken_NotFound(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.DELETE("/api/tokens/:id", DeleteToken)
+
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/tokens/999", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+// ---------------------------------------------------------------------------
+// Category scope enforcement inside handlers
+// ---------------------------------------------------------------------------
+
+func TestFetchAccounts_TokenOutOfScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	allowed := testutil.SeedCategory(t, "allowed")
+	other := testutil.SeedCategory(t, "other")
+	testutil.SeedAccounts(t, other.ID, 2, "o")
+
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{Permissions: "fetch", CategoryIDs: fmt.Sprintf("%d", allowed.ID)}
+	router.POST("/api/accounts/fetch", withToken(tok), middleware.RequirePermission("fetch"), FetchAccounts)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"category_id": other.ID, "count": 1})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/accounts/fetch", body, "")
+	testutil.AssertStatus(t, w, http.StatusForbidden)
+
+	var used int64
+	database.DB.Model(&database.Account{}).Where("used = ?", true).Count(&used)
+	if used != 0 {
+		t.Errorf("expected no accounts to be consumed, got %d", used)
+	}
+}
+
+func TestDeleteAccountsByIds_TokenOutOfScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	allowed := testutil.SeedCategory(t, "allowed")
+	other := testutil.SeedCategory(t, "other")
+	mine := testutil.SeedAccount(t, allowed.ID, "mine")
+	theirs := testutil.SeedAccount(t, other.ID, "theirs")
+
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{Permissions: "write", CategoryIDs: fmt.Sprintf("%d", allowed.ID)}
+	router.DELETE("/api/accounts/by-ids", withToken(tok), DeleteAccountsByIds)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{mine.ID, theirs.ID}})
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/accounts/by-ids", body, "")
+	testutil.AssertStatus(t, w, http.StatusForbidden)
+
+	body = testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{mine.ID}})
+	w = testutil.DoRequest(router, http.MethodDelete, "/api/accounts/by-ids", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+}
+
+func TestGetCategories_FilteredByTokenScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	allowed := testutil.SeedCategory(t, "allowed")
+	testutil.SeedCategory(t, "other")
+
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{Permissions: "read", CategoryIDs: fmt.Sprintf("%d", allowed.ID)}
+	router.GET("/api/categories", withToken(tok), GetCategories)
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/categories", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != 1 || arr[0]["name"] != "allowed" {
+		t.Errorf("expected only the in-scope category, got %v", arr)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/middleware"
+	"final-account-hub/validator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// trashedCategory is a category in the trash with the number of accounts
+// trashed with it and when it will be purged.
+type trashedCategory struct {
+	database.Category
+	Accounts int64     `json:"accounts"`
+	PurgeAt  time.Time `json:"purge_at"`
+}
+
+// trashedAccount is an account in the trash with when it will be purged.
+type trashedAccount struct {
+	database.Account
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// purgeAt returns when an item deleted at deletedAt leaves the trash.
+func purgeAt(deletedAt gorm.DeletedAt, retentionDays int) time.Time {
+	return deletedAt.Time.AddDate(0, 0, max(retentionDays, 0))
+}
+
+// denyTrashedName writes a 409 and returns true when a category in the trash
+// holds name, which the unique index keeps from being reused.
+func denyTrashedName(c *gin.Context, name string) bool {
+	var count int64
+	database.DB.Unscoped().Model(&database.Category{}).Where("name = ? AND deleted_at IS NOT NULL", name).Count(&count)
+	if count == 0 {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": database.ErrTrashedCategoryName.Error()})
+	return true
+}
+
+// trashPage reads the page and limit query parameters and clamps page to the
+// number of pages for total.
+func trashPage(c *gin.Context, total int64) (page, limit int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+	return page, limit
+}
+
+// GetTrashCategories lists trashed categories, most recently deleted first.
+func GetTrashCategories(c *gin.Context) {
+	query := database.DB.Unscoped().Model(&database.Category{}).Where("deleted_at IS NOT NULL")
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("id IN ?", append(ids, 0))
+	}
+	var total int64
+	query.Count(&total)
+	page, limit := trashPage(c, total)
+
+	var categories []database.Category
+	if err := query.Order("deleted_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data := make([]trashedCategory, len(categories))
+	for i, cat := range categories {
+		data[i] = trashedCategory{Category: cat, PurgeAt: purgeAt(cat.DeletedAt, cat.TrashRetentionDays)}
+		database.DB.Unscoped().Model(&database.Account{}).Where("category_id = ?", cat.ID).Count(&data[i].Accounts)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data, "total": total, "page": page, "limit": limit})
+}
+
+// GetTrashAccounts lists trashed accounts of active categories, most recently
+// deleted first, optionally filtered by ?category_id.
+func GetTrashAccounts(c *gin.Context) {
+	query := database.DB.Unscoped().Model(&database.Account{}).Where("deleted_at IS NOT NULL").
+		Where("category_id IN (?)", database.DB.Model(&database.Category{}).Select("id"))
+	if ids, scoped := middleware.AllowedCategoryIDs(c); scoped {
+		query = query.Where("category_id IN ?", append(ids, 0))
+	}
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	var total int64
+	query.Count(&total)
+	page, limit := trashPage(c, total)
+
+	var accounts []database.Account
+	if err := query.Order("deleted_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.LoadTags(database.DB, accounts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	retention := map[uint]int{}
+	data := make([]trashedAccount, len(accounts))
+	for i, acc := range accounts {
+		days, ok := retention[acc.CategoryID]
+		if !ok {
+			var cat database.Category
+			database.DB.Select("id, trash_retention_days").First(&cat, acc.CategoryID)
+			days = cat.TrashRetentionDays
+			retention[acc.CategoryID] = days
+		}
+		data[i] = trashedAccount{Account: acc, PurgeAt: purgeAt(acc.DeletedAt, days)}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data, "total": total, "page": page, "limit": limit})
+}
+
+// RestoreTrashCategory takes a category out of the trash together with the
+// accounts deleted with it.
+func RestoreTrashCategory(c *gin.Context) {
+	var catID uint
+	fmt.Sscanf(c.Param("id"), "%d", &catID)
+	restored, err := database.RestoreCategory(catID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not in trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	validator.ReloadJobForCategory(catID)
+	recordAudit(c, database.AuditCategoryRestore, catID, categoryTarget(catID), nil, gin.H{"accounts": restored})
+	c.JSON(http.StatusOK, gin.H{"message": "restored", "accounts": restored})
+}
+
+// PurgeTrashCategory permanently deletes a trashed category and everything
+// that belongs to it without waiting for its retention period.
+func PurgeTrashCategory(c *gin.Context) {
+	var catID uint
+	fmt.Sscanf(c.Param("id"), "%d", &catID)
+	var cat database.Category
+	database.DB.Unscoped().Select("id, name").First(&cat, catID)
+	err := database.PurgeCategory(database.DB, catID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not in trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, database.AuditCategoryPurge, catID, categoryTarget(catID), gin.H{"name": cat.Name}, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "purged"})
+}
+
+// RestoreTrashAccounts takes accounts out of the trash. Accounts that
+// duplicate an active account or belong to a trashed category are skipped.
+func RestoreTrashAccounts(c *gin.Context) {
+	var req struct {
+		IDs []uint `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max 10000 IDs per request"})
+		return
+	}
+	if denyAccounts(c, req.IDs) {
+		return
+	}
+	restored, skipped, err := database.RestoreAccounts(req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for catID, ids := range accountIDsByCategory(database.DB, restored) {
+		recordAudit(c, database.AuditAccountRestore, catID, categoryTarget(catID), nil, gin.H{"ids": ids, "restored": len(ids)})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "restored", "restored": len(restored), "skipped": skipped})
+}
+
+// PurgeTrashAccounts permanently deletes trashed accounts without waiting
+// for their retention period.
+func PurgeTrashAccounts(c *gin.Context) {
+	var req struct {
+		IDs []uint `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) > 10000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max 10000 IDs per request"})
+		return
+	}
+	if denyAccounts(c, req.IDs) {
+		return
+	}
+	grouped := accountIDsByCategory(database.DB.Unscoped().Where("deleted_at IS NOT NULL"), req.IDs)
+	purged, err := database.PurgeAccounts(database.DB, "id IN ?", req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for catID, ids := range grouped {
+		recordAudit(c, database.AuditAccountPurge, catID, categoryTarget(catID), nil, gin.H{"ids": ids, "purged": len(ids)})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "purged", "count": purged})
+}
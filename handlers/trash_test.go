@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+func TestDeleteCategory_MovesToTrash(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.POST("/api/categories", CreateCategory)
+	router.DELETE("/api/categories/:id", DeleteCategory)
+	router.GET("/api/trash/categories", GetTrashCategories)
+	router.POST("/api/trash/categories/:id/restore", RestoreTrashCategory)
+	router.DELETE("/api/trash/categories/:id", PurgeTrashCategory)
+	cat := testutil.SeedCategory(t, "binned")
+	testutil.SeedAccount(t, cat.ID, "a")
+	testutil.SeedAccount(t, cat.ID, "b")
+	path := fmt.Sprintf("/api/categories/%d", cat.ID)
+
+	w := testutil.DoRequest(router, http.MethodDelete, path, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/trash/categories", nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 1)
+	item := testutil.GetJSONArray(resp, "data")[0].(map[string]interface{})
+	testutil.AssertJSONField(t, item, "name", "binned")
+	testutil.AssertJSONField(t, item, "accounts", 2)
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/categories", testutil.MakeJSON(t, map[string]string{"name": "binned"}), "")
+	testutil.AssertStatus(t, w, http.StatusConflict)
+
+	restorePath := fmt.Sprintf("/api/trash/categories/%d/restore", cat.ID)
+	w = testutil.DoRequest(router, http.MethodPost, restorePath, nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "accounts", 2)
+	w = testutil.DoRequest(router, http.MethodPost, restorePath, nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+
+	w = testutil.DoRequest(router, http.MethodDelete, fmt.Sprintf("/api/trash/categories/%d", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+	testutil.DoRequest(router, http.MethodDelete, path, nil, "")
+	w = testutil.DoRequest(router, http.MethodDelete, fmt.Sprintf("/api/trash/categories/%d", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var remaining int64
+	database.DB.Unscoped().Model(&database.Account{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected accounts purged with the category, got %d", remaining)
+	}
+	w = testutil.DoRequest(router, http.MethodPost, "/api/categories", testutil.MakeJSON(t, map[string]string{"name": "binned"}), "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+}
+
+func TestTrashAccounts_ListAndRestore(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.DELETE("/api/accounts/by-ids", DeleteAccountsByIds)
+	router.GET("/api/trash/accounts", GetTrashAccounts)
+	router.POST("/api/trash/accounts/restore", RestoreTrashAccounts)
+	cat := testutil.SeedCategory(t, "pool")
+	other := testutil.SeedCategory(t, "other")
+	a := testutil.SeedAccount(t, cat.ID, "a")
+	b := testutil.SeedAccount(t, cat.ID, "b")
+	c := testutil.SeedAccount(t, other.ID, "c")
+
+	w := testutil.DoRequest(router, http.MethodDelete, "/api/accounts/by-ids", testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID, c.ID}}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	testutil.SeedAccount(t, cat.ID, "b")
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/trash/accounts?category_id=%d", cat.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "total", 2)
+	item := testutil.GetJSONArray(resp, "data")[0].(map[string]interface{})
+	if item["deleted_at"] == nil || item["purge_at"] == nil {
+		t.Errorf("expected deleted_at and purge_at, got %v", item)
+	}
+
+	w = testutil.DoRequest(router, http.MethodPost, "/api/trash/accounts/restore", testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID}}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	resp = testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, resp, "restored", 1)
+	testutil.AssertJSONField(t, resp, "skipped", 1)
+
+	entries := auditEntries(t)
+	last := entries[len(entries)-1]
+	if last.Action != database.AuditAccountRestore || last.CategoryID != cat.ID {
+		t.Errorf("unexpected restore audit entry %+v", last)
+	}
+}
+
+func TestTrash_TokenScope(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	cat := testutil.SeedCategory(t, "mine")
+	other := testutil.SeedCategory(t, "theirs")
+	acc := testutil.SeedAccount(t, other.ID, "x")
+	database.DB.Delete(&database.Account{}, acc.ID)
+	database.TrashCategory(database.DB, cat.ID)
+	database.TrashCategory(database.DB, other.ID)
+	tok := &database.APIToken{Permissions: "admin", CategoryIDs: fmt.Sprint(cat.ID)}
+	router.GET("/api/trash/categories", withToken(tok), GetTrashCategories)
+	router.DELETE("/api/trash/accounts", withToken(tok), PurgeTrashAccounts)
+
+	w := testutil.DoRequest(router, http.MethodGet, "/api/trash/categories", nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+	w = testutil.DoRequest(router, http.MethodDelete, "/api/trash/accounts", testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{acc.ID}}), "")
+	testutil.AssertStatus(t, w, http.StatusForbidden)
+}
+
+func TestUpdateTrashRetention(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := testutil.SetupTestRouter()
+	router.PUT("/api/categories/:id/trash-retention", UpdateTrashRetention)
+	cat := testutil.SeedCategory(t, "retention")
+	path := fmt.Sprintf("/api/categories/%d/trash-retention", cat.ID)
+
+	w := testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]int{"trash_retention_days": -1}), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]int{"trash_retention_days": 0}), "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+
+	var got database.Category
+	database.DB.First(&got, cat.ID)
+	if got.TrashRetentionDays != 0 {
+		t.Errorf("expected retention 0, got %d", got.TrashRetentionDays)
+	}
+}
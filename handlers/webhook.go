@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"final-account-hub/database"
+	"final-account-hub/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookResponse renders a webhook with its events as an array. The secret
+// is never included.
+func webhookResponse(h database.Webhook) gin.H {
+	events := []string{}
+	for _, e := range strings.Split(h.Events, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+	return gin.H{
+		"id":          h.ID,
+		"category_id": h.CategoryID,
+		"url":         h.URL,
+		"events":      events,
+		"enabled":     h.Enabled,
+		"created_at":  h.CreatedAt,
+		"updated_at":  h.UpdatedAt,
+	}
+}
+
+// webhookAudit is the audited view of a webhook. The secret is left out.
+func webhookAudit(h database.Webhook) gin.H {
+	resp := webhookResponse(h)
+	return gin.H{
+		"url":     resp["url"],
+		"events":  resp["events"],
+		"enabled": resp["enabled"],
+	}
+}
+
+// validateWebhookEvents checks every value against webhook.Events and returns
+// them in canonical comma-separated form.
+func validateWebhookEvents(events []string) (string, bool) {
+	valid := map[string]bool{}
+	for _, e := range webhook.Events {
+		valid[e] = true
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if !valid[e] {
+			return "", false
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return strings.Join(out, ","), len(out) > 0
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var invalidEventsError = "events must be a non-empty subset of: " + strings.Join(webhook.Events, ", ")
+
+func CreateWebhook(c *gin.Context) {
+	var req struct {
+		CategoryID uint     `json:"category_id"`
+		URL        string   `json:"url" binding:"required"`
+		Secret     string   `json:"secret"`
+		Events     []string `json:"events" binding:"required"`
+		Enabled    *bool    `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validWebhookURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+	events, ok := validateWebhookEvents(req.Events)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidEventsError})
+		return
+	}
+	if req.CategoryID != 0 {
+		var count int64
+		database.DB.Model(&database.Category{}).Where("id = ?", req.CategoryID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		}
+	}
+	secret := req.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	hook := database.Webhook{
+		CategoryID: req.CategoryID,
+		URL:        req.URL,
+		Secret:     secret,
+		Events:     events,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+	}
+	if err := database.DB.Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c, database.AuditWebhookCreate, hook.CategoryID, webhookTarget(hook.ID), nil, webhookAudit(hook))
+
+	// The secret is only ever returned here.
+	resp := webhookResponse(hook)
+	resp["secret"] = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+func GetWebhooks(c *gin.Context) {
+	query := database.DB.Order("id")
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	var hooks []database.Webhook
+	if err := query.Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]gin.H, 0, len(hooks))
+	for _, h := range hooks {
+		results = append(results, webhookResponse(h))
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func UpdateWebhook(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		URL     *string  `json:"url"`
+		Secret  *string  `json:"secret"`
+		Events  []string `json:"events"`
+		Enabled *bool    `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var hook database.Webhook
+	if err := database.DB.First(&hook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.URL != nil {
+		if !validWebhookURL(*req.URL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+			return
+		}
+		updates["url"] = *req.URL
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "secret cannot be empty"})
+			return
+		}
+		// Map updates bypass the serializer, so encrypt here
+		encrypted, err := database.EncryptData(*req.Secret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		updates["secret"] = encrypted
+	}
+	if req.Events != nil {
+		events, ok := validateWebhookEvents(req.Events)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalidEventsError})
+			return
+		}
+		updates["events"] = events
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one field required"})
+		return
+	}
+
+	old := hook
+	if err := database.DB.Model(&hook).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.First(&hook, id)
+	before, after := auditChangedKeys(updates, webhookAudit(old), webhookAudit(hook))
+	if _, ok := updates["secret"]; ok {
+		// Like account data, a new secret is recorded without its value
+		delete(before, "secret")
+		delete(after, "secret")
+		after["secret_changed"] = true
+	}
+	recordAudit(c, database.AuditWebhookUpdate, hook.CategoryID, webhookTarget(hook.ID), before, after)
+	c.JSON(http.StatusOK, webhookResponse(hook))
+}
+
+func DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	var hook database.Webhook
+	database.DB.First(&hook, id)
+	result := database.DB.Delete(&database.Webhook{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	database.DB.Where("webhook_id = ?", id).Delete(&database.WebhookDelivery{})
+	recordAudit(c, database.AuditWebhookDelete, hook.CategoryID, webhookTarget(hook.ID), webhookAudit(hook), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first.
+func GetWebhookDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	var hook database.Webhook
+	if err := database.DB.First(&hook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+
+	query := database.DB.Model(&database.WebhookDelivery{}).Where("webhook_id = ?", hook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	query.Count(&total)
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+	offset := (page - 1) * limit
+
+	var deliveries []database.WebhookDelivery
+	query.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries)
+	c.JSON(http.StatusOK, gin.H{"data": deliveries, "total": total, "page": page, "limit": limit})
+}
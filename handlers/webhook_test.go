@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupWebhookRouter() *gin.Engine {
+	router := testutil.SetupTestRouter()
+	router.POST("/api/webhooks", CreateWebhook)
+	router.GET("/api/webhooks", GetWebhooks)
+	router.PUT("/api/webhooks/:id", UpdateWebhook)
+	router.DELETE("/api/webhooks/:id", DeleteWebhook)
+	router.GET("/api/webhooks/:id/deliveries", GetWebhookDeliveries)
+	return router
+}
+
+func TestCreateWebhook_Success(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupWebhookRouter()
+	cat := testutil.SeedCategory(t, "hooks")
+
+	body := testutil.MakeJSON(t, map[string]interface{}{
+		"category_id": cat.ID,
+		"url":         "https://example.com/hook",
+		"events":      []string{"pool.low_watermark", "account.banned", "pool.low_watermark"},
+	})
+	w := testutil.DoRequest(router, http.MethodPost, "/api/webhooks", body, "")
+	testutil.AssertStatus(t, w, http.StatusCreated)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "enabled", true)
+	if n := len(testutil.GetJSONArray(data, "events")); n != 2 {
+		t.Errorf("expected 2 deduplicated events, got %d", n)
+	}
+	secret, _ := data["secret"].(string)
+	if len(secret) != 64 {
+		t.Errorf("expected generated secret, got %q", secret)
+	}
+
+	var hook database.Webhook
+	database.DB.First(&hook)
+	if hook.Secret != secret || hook.Events != "pool.low_watermark,account.banned" {
+		t.Errorf("unexpected stored webhook %+v", hook)
+	}
+
+	// The secret is not listed afterwards
+	w = testutil.DoRequest(router, http.MethodGet, "/api/webhooks", nil, "")
+	arr := testutil.ParseJSONArray(t, w)
+	if len(arr) != 1 || arr[0]["secret"] != nil {
+		t.Errorf("expected one webhook without secret, got %v", arr)
+	}
+}
+
+func TestCreateWebhook_Invalid(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupWebhookRouter()
+
+	cases := []struct {
+		body map[string]interface{}
+		code int
+	}{
+		{map[string]interface{}{"events": []string{"account.banned"}}, http.StatusBadRequest},
+		{map[string]interface{}{"url": "ftp://example.com", "events": []string{"account.banned"}}, http.StatusBadRequest},
+		{map[string]interface{}{"url": "https://example.com", "events": []string{"nope"}}, http.StatusBadRequest},
+		{map[string]interface{}{"url": "https://example.com", "events": []string{}}, http.StatusBadRequest},
+		{map[string]interface{}{"url": "https://example.com", "events": []string{"account.banned"}, "category_id": 999}, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		w := testutil.DoRequest(router, http.MethodPost, "/api/webhooks", testutil.MakeJSON(t, tc.body), "")
+		if w.Code != tc.code {
+			t.Errorf("body %v: expected %d, got %d (%s)", tc.body, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestUpdateWebhook(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupWebhookRouter()
+	enableEncryption(t)
+
+	hook := database.Webhook{URL: "https://example.com/a", Secret: "old", Events: "account.banned", Enabled: true}
+	database.DB.Create(&hook)
+	path := fmt.Sprintf("/api/webhooks/%d", hook.ID)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"enabled": false, "secret": "new-secret", "events": []string{"accounts.imported"}})
+	w := testutil.DoRequest(router, http.MethodPut, path, body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "enabled", false)
+
+	var raw string
+	database.DB.Table("webhooks").Select("secret").Where("id = ?", hook.ID).Scan(&raw)
+	if strings.Contains(raw, "new-secret") {
+		t.Error("expected secret to be encrypted at rest")
+	}
+	var got database.Webhook
+	database.DB.First(&got, hook.ID)
+	if got.Secret != "new-secret" || got.Events != "accounts.imported" {
+		t.Errorf("unexpected webhook after update %+v", got)
+	}
+
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{"url": "not a url"}), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+	w = testutil.DoRequest(router, http.MethodPut, path, testutil.MakeJSON(t, map[string]interface{}{}), "")
+	testutil.AssertStatus(t, w, http.StatusBadRequest)
+	w = testutil.DoRequest(router, http.MethodPut, "/api/webhooks/999", testutil.MakeJSON(t, map[string]interface{}{"enabled": true}), "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupWebhookRouter()
+
+	hook := database.Webhook{URL: "https://example.com", Events: "account.banned", Enabled: true}
+	database.DB.Create(&hook)
+	database.DB.Create(&database.WebhookDelivery{WebhookID: hook.ID, Event: "account.banned", Status: "success"})
+
+	w := testutil.DoRequest(router, http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", hook.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	var count int64
+	database.DB.Model(&database.WebhookDelivery{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected deliveries to be deleted, got %d", count)
+	}
+
+	w = testutil.DoRequest(router, http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", hook.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	testutil.SetupTestDB(t)
+	router := setupWebhookRouter()
+
+	hook := database.Webhook{URL: "https://example.com", Events: "account.banned", Enabled: true}
+	database.DB.Create(&hook)
+	for i := 0; i < 3; i++ {
+		database.DB.Create(&database.WebhookDelivery{WebhookID: hook.ID, Event: "account.banned", Status: "success"})
+	}
+	database.DB.Create(&database.WebhookDelivery{WebhookID: hook.ID, Event: "account.banned", Status: "failed"})
+
+	w := testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/webhooks/%d/deliveries?limit=2", hook.ID), nil, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := testutil.ParseJSON(t, w)
+	testutil.AssertJSONField(t, data, "total", 4)
+	rows := testutil.GetJSONArray(data, "data")
+	if len(rows) != 2 || rows[0].(map[string]interface{})["status"] != "failed" {
+		t.Errorf("expected newest first, got %v", rows)
+	}
+
+	w = testutil.DoRequest(router, http.MethodGet, fmt.Sprintf("/api/webhooks/%d/deliveries?status=failed", hook.ID), nil, "")
+	testutil.AssertJSONField(t, testutil.ParseJSON(t, w), "total", 1)
+
+	w = testutil.DoRequest(router, http.MethodGet, "/api/webhooks/999/deliveries", nil, "")
+	testutil.AssertStatus(t, w, http.StatusNotFound)
+}
+
+// receiveWebhooks starts a server that passes every delivered payload to the
+// returned channel.
+func receiveWebhooks(t *testing.T) (string, <-chan map[string]interface{}) {
+	t.Helper()
+	received := make(chan map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+// nextWebhook waits for the next delivered payload.
+func nextWebhook(t *testing.T, received <-chan map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	select {
+	case payload := <-received:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+		return nil
+	}
+}
+
+func TestManualBan_EmitsAccountBanned(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	router := testutil.SetupTestRouter()
+	tok := &database.APIToken{ID: 4, Name: "ops", Permissions: "write"}
+	router.PUT("/api/accounts/:id", withToken(tok), UpdateAccount)
+	router.PUT("/api/accounts/batch/update", BatchUpdateAccounts)
+	cat := testutil.SeedCategory(t, "banned-by-hand")
+	url, received := receiveWebhooks(t)
+	database.DB.Create(&database.Webhook{CategoryID: cat.ID, URL: url, Secret: "s", Events: "account.banned", Enabled: true})
+
+	a := testutil.SeedAccount(t, cat.ID, "a")
+	b := testutil.SeedAccount(t, cat.ID, "b")
+	already := testutil.SeedAccountWithStatus(t, cat.ID, "c", false, true)
+
+	body := testutil.MakeJSON(t, map[string]interface{}{"banned": true})
+	w := testutil.DoRequest(router, http.MethodPut, fmt.Sprintf("/api/accounts/%d", a.ID), body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data := nextWebhook(t, received)["data"].(map[string]interface{})
+	if data["source"] != "manual" || data["actor"] != "ops" || fmt.Sprint(data["account_ids"]) != fmt.Sprintf("[%d]", a.ID) || data["run_id"] != nil {
+		t.Errorf("unexpected manual ban payload %v", data)
+	}
+
+	// Only accounts that were not banned yet are reported
+	body = testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID, already.ID}, "banned": true})
+	w = testutil.DoRequest(router, http.MethodPut, "/api/accounts/batch/update", body, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	data = nextWebhook(t, received)["data"].(map[string]interface{})
+	if data["source"] != "batch" || data["actor"] != "passkey" || fmt.Sprint(data["account_ids"]) != fmt.Sprintf("[%d]", b.ID) {
+		t.Errorf("unexpected batch ban payload %v", data)
+	}
+
+	// Unbanning sends nothing
+	body = testutil.MakeJSON(t, map[string]interface{}{"ids": []uint{a.ID, b.ID}, "banned": false})
+	testutil.DoRequest(router, http.MethodPut, "/api/accounts/batch/update", body, "")
+	select {
+	case payload := <-received:
+		t.Errorf("expected no event for unbanning, got %v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
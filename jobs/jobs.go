@@ -0,0 +1,388 @@
+// Package jobs runs long operations in a persistent background worker pool.
+// Each job is a row in the jobs table, so clients can disconnect and poll
+// /api/jobs/:id for progress, logs and the result.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/logger"
+
+	"gorm.io/gorm"
+)
+
+// Job statuses.
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Job types registered by the handlers package.
+const (
+	TypeDeleteAccounts      = "delete_accounts"
+	TypeImportAccounts      = "import_accounts"
+	TypeExportAccounts      = "export_accounts"
+	TypeInstallPackage      = "install_package"
+	TypeInstallRequirements = "install_requirements"
+	TypeReparseAccounts     = "reparse_accounts"
+)
+
+// maxLogSize is how much of a job's log is kept; older output is dropped.
+const maxLogSize = 64 << 10
+
+// saveInterval throttles progress writes to the database.
+const saveInterval = time.Second
+
+// Dir holds job input and output files.
+var Dir = "./data/jobs"
+
+// OutputRetention is how long a finished job's output file, which holds
+// plaintext account data, stays available for download.
+const OutputRetention = 30 * time.Minute
+
+// Func executes a job. Its result is stored as JSON. When ctx is canceled
+// the job should stop and return ctx.Err().
+type Func func(ctx context.Context, run *Run) (interface{}, error)
+
+var (
+	registry = map[string]Func{}
+
+	mu      sync.Mutex
+	cancels = map[uint]context.CancelFunc{}
+	wake    = make(chan struct{}, 1)
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+)
+
+// Register makes a job type available. It is called from init functions.
+func Register(jobType string, fn Func) {
+	registry[jobType] = fn
+}
+
+// InputPath is where a job's uploaded input is stored.
+func InputPath(id uint) string {
+	return filepath.Join(Dir, strconv.FormatUint(uint64(id), 10)+".input")
+}
+
+// OutputPath is where a job writes a downloadable file.
+func OutputPath(id uint) string {
+	return filepath.Join(Dir, strconv.FormatUint(uint64(id), 10)+".output")
+}
+
+// Enqueue stores a pending job with its params and optional input file and
+// wakes the worker pool.
+func Enqueue(jobType string, categoryID uint, params interface{}, input io.Reader) (*database.Job, error) {
+	if _, ok := registry[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type %s", jobType)
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := &database.Job{Type: jobType, CategoryID: categoryID, Status: StatusPending, Params: string(raw)}
+	if input == nil {
+		if err := database.DB.Create(job).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		tmp, err := saveInput(input)
+		if err != nil {
+			return nil, err
+		}
+		// The input is moved into place before the row becomes visible, so a
+		// worker never picks up a job without its input
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(job).Error; err != nil {
+				return err
+			}
+			return os.Rename(tmp, InputPath(job.ID))
+		})
+		if err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// saveInput writes an upload to a temporary file in Dir.
+func saveInput(input io.Reader) (string, error) {
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(Dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, input); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Cancel stops a pending or running job. It returns false when the job has
+// already finished.
+func Cancel(id uint) bool {
+	result := database.DB.Model(&database.Job{}).Where("id = ? AND status = ?", id, StatusPending).
+		Updates(map[string]interface{}{"status": StatusCanceled, "finished_at": time.Now()})
+	if result.Error == nil && result.RowsAffected > 0 {
+		os.Remove(InputPath(id))
+		return true
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if cancel, ok := cancels[id]; ok {
+		cancel()
+		return true
+	}
+	return false
+}
+
+// Start launches the given number of workers. Jobs left running by a
+// previous process are marked failed; pending ones are picked up.
+func Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	database.DB.Model(&database.Job{}).Where("status = ?", StatusRunning).
+		Updates(map[string]interface{}{"status": StatusFailed, "error": "interrupted by restart", "finished_at": time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	stop = cancel
+	mu.Unlock()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker(ctx)
+	}
+	logger.Info.Printf("Started %d job workers", workers)
+}
+
+// Stop cancels running jobs and waits for the workers to exit.
+func Stop() {
+	mu.Lock()
+	if stop != nil {
+		stop()
+		stop = nil
+	}
+	mu.Unlock()
+	wg.Wait()
+}
+
+func worker(ctx context.Context) {
+	defer wg.Done()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		// Drain every pending job before sleeping
+		for ctx.Err() == nil {
+			job, ok := claimNext()
+			if !ok {
+				break
+			}
+			execute(ctx, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimNext marks the oldest pending job as running. The status is updated
+// conditionally so each job is claimed by one worker.
+func claimNext() (*database.Job, bool) {
+	for {
+		var job database.Job
+		if err := database.DB.Where("status = ?", StatusPending).Order("id").First(&job).Error; err != nil {
+			return nil, false
+		}
+		now := time.Now()
+		result := database.DB.Model(&database.Job{}).Where("id = ? AND status = ?", job.ID, StatusPending).
+			Updates(map[string]interface{}{"status": StatusRunning, "started_at": now})
+		if result.Error != nil {
+			logger.Error.Printf("Failed to claim job %d: %v", job.ID, result.Error)
+			return nil, false
+		}
+		if result.RowsAffected == 1 {
+			job.Status = StatusRunning
+			job.StartedAt = &now
+			return &job, true
+		}
+	}
+}
+
+func execute(parent context.Context, job *database.Job) {
+	ctx, cancel := context.WithCancel(parent)
+	mu.Lock()
+	cancels[job.ID] = cancel
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(cancels, job.ID)
+		mu.Unlock()
+		cancel()
+	}()
+
+	run := &Run{job: job}
+	result, err := runSafely(ctx, run)
+	os.Remove(InputPath(job.ID))
+
+	updates := map[string]interface{}{"finished_at": time.Now()}
+	switch {
+	case err == nil:
+		updates["status"] = StatusSuccess
+	case parent.Err() != nil:
+		updates["status"] = StatusFailed
+		updates["error"] = "interrupted by shutdown"
+	case ctx.Err() != nil:
+		updates["status"] = StatusCanceled
+	default:
+		updates["status"] = StatusFailed
+		updates["error"] = err.Error()
+	}
+	// Failed and canceled jobs keep their partial result, such as how many
+	// accounts were deleted before stopping
+	if result != nil {
+		raw, _ := json.Marshal(result)
+		updates["result"] = string(raw)
+	}
+	if updates["status"] != StatusSuccess {
+		os.Remove(OutputPath(job.ID))
+	}
+	run.mu.Lock()
+	updates["progress"], updates["total"], updates["log"] = run.progress, run.total, run.log.String()
+	run.mu.Unlock()
+	if err := database.DB.Model(&database.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		logger.Error.Printf("Failed to finish job %d: %v", job.ID, err)
+	}
+	logger.Info.Printf("Job %d (%s) finished: %v", job.ID, job.Type, updates["status"])
+}
+
+// runSafely turns a panicking job into a failed one.
+func runSafely(ctx context.Context, run *Run) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	fn, ok := registry[run.job.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %s", run.job.Type)
+	}
+	return fn(ctx, run)
+}
+
+// Run is the handle a job function uses to read its params and report
+// progress and log output.
+type Run struct {
+	job *database.Job
+
+	mu       sync.Mutex
+	progress int64
+	total    int64
+	log      strings.Builder
+	lastSave time.Time
+}
+
+// ID returns the job ID.
+func (r *Run) ID() uint { return r.job.ID }
+
+// CategoryID returns the category the job belongs to.
+func (r *Run) CategoryID() uint { return r.job.CategoryID }
+
+// Params decodes the job's params into v.
+func (r *Run) Params(v interface{}) error {
+	return json.Unmarshal([]byte(r.job.Params), v)
+}
+
+// SetProgress records how far the job is. total may be 0 when unknown.
+func (r *Run) SetProgress(progress, total int64) {
+	r.mu.Lock()
+	r.progress, r.total = progress, total
+	r.mu.Unlock()
+	r.save(false)
+}
+
+// Logf appends a line to the job log.
+func (r *Run) Logf(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.log.WriteString(fmt.Sprintf(format, args...))
+	r.log.WriteByte('\n')
+	if r.log.Len() > maxLogSize {
+		tail := r.log.String()[r.log.Len()-maxLogSize:]
+		r.log.Reset()
+		r.log.WriteString(tail)
+	}
+	r.mu.Unlock()
+	r.save(false)
+}
+
+// save writes progress and log to the database at most once per interval
+// unless forced.
+func (r *Run) save(force bool) {
+	r.mu.Lock()
+	if !force && time.Since(r.lastSave) < saveInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSave = time.Now()
+	updates := map[string]interface{}{"progress": r.progress, "total": r.total, "log": r.log.String()}
+	r.mu.Unlock()
+	database.DB.Model(&database.Job{}).Where("id = ?", r.job.ID).Updates(updates)
+}
+
+// ExpireOutputs deletes the output files of jobs that finished more than
+// OutputRetention ago. The job rows stay until Cleanup.
+func ExpireOutputs() {
+	var ids []uint
+	database.DB.Model(&database.Job{}).
+		Where("finished_at < ? AND status = ?", time.Now().Add(-OutputRetention), StatusSuccess).
+		Pluck("id", &ids)
+	for _, id := range ids {
+		if err := os.Remove(OutputPath(id)); err != nil && !os.IsNotExist(err) {
+			logger.Error.Printf("Failed to remove output of job %d: %v", id, err)
+		}
+	}
+}
+
+// Cleanup deletes finished jobs older than 7 days and their files.
+func Cleanup() {
+	var ids []uint
+	database.DB.Model(&database.Job{}).
+		Where("created_at < ? AND status IN ?", time.Now().AddDate(0, 0, -7), []string{StatusSuccess, StatusFailed, StatusCanceled}).
+		Pluck("id", &ids)
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		os.Remove(InputPath(id))
+		os.Remove(OutputPath(id))
+	}
+	database.DB.Where("id IN ?", ids).Delete(&database.Job{})
+}
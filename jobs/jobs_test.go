@@ -0,0 +1,265 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+const (
+	typeEcho  = "test_echo"
+	typeBlock = "test_block"
+	typePanic = "test_panic"
+	typeFail  = "test_fail"
+)
+
+func init() {
+	Register(typeEcho, func(ctx context.Context, run *Run) (interface{}, error) {
+		var params struct {
+			Word string `json:"word"`
+		}
+		if err := run.Params(&params); err != nil {
+			return nil, err
+		}
+		input, _ := os.ReadFile(InputPath(run.ID()))
+		run.SetProgress(1, 1)
+		run.Logf("echo %s", params.Word)
+		return map[string]string{"word": params.Word, "input": string(input)}, nil
+	})
+	Register(typeBlock, func(ctx context.Context, run *Run) (interface{}, error) {
+		run.Logf("waiting")
+		<-ctx.Done()
+		return map[string]int{"done": 0}, ctx.Err()
+	})
+	Register(typePanic, func(ctx context.Context, run *Run) (interface{}, error) {
+		panic("boom")
+	})
+	Register(typeFail, func(ctx context.Context, run *Run) (interface{}, error) {
+		return nil, errors.New("broken")
+	})
+}
+
+// startPool runs a worker pool against a file database and temp job dir.
+func startPool(t *testing.T) {
+	t.Helper()
+	testutil.SetupFileTestDB(t)
+	oldDir := Dir
+	Dir = t.TempDir()
+	Start(2)
+	t.Cleanup(func() {
+		Stop()
+		Dir = oldDir
+	})
+}
+
+// waitForStatus polls until the job reaches one of the given statuses.
+func waitForStatus(t *testing.T, id uint, statuses ...string) database.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var job database.Job
+		database.DB.First(&job, id)
+		for _, s := range statuses {
+			if job.Status == s {
+				return job
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d: expected status %v, got %s", id, statuses, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEnqueue_RunsJob(t *testing.T) {
+	startPool(t)
+	job, err := Enqueue(typeEcho, 7, map[string]string{"word": "hi"}, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if job.Status != StatusPending || job.CategoryID != 7 {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	done := waitForStatus(t, job.ID, StatusSuccess, StatusFailed)
+	if done.Status != StatusSuccess {
+		t.Fatalf("expected success, got %s: %s", done.Status, done.Error)
+	}
+	if done.Result != `{"input":"payload","word":"hi"}` {
+		t.Errorf("unexpected result %s", done.Result)
+	}
+	if done.Log != "echo hi\n" || done.Progress != 1 || done.Total != 1 {
+		t.Errorf("unexpected progress %d/%d log %q", done.Progress, done.Total, done.Log)
+	}
+	if done.StartedAt == nil || done.FinishedAt == nil {
+		t.Error("expected started and finished times")
+	}
+	if _, err := os.Stat(InputPath(job.ID)); !os.IsNotExist(err) {
+		t.Error("expected input file removed")
+	}
+}
+
+func TestEnqueue_UnknownType(t *testing.T) {
+	testutil.SetupTestDB(t)
+	if _, err := Enqueue("nope", 0, nil, nil); err == nil {
+		t.Error("expected error for unknown job type")
+	}
+}
+
+func TestCancel_Running(t *testing.T) {
+	startPool(t)
+	job, _ := Enqueue(typeBlock, 0, nil, nil)
+	waitForStatus(t, job.ID, StatusRunning)
+
+	if !Cancel(job.ID) {
+		t.Fatal("expected cancel to succeed")
+	}
+	done := waitForStatus(t, job.ID, StatusCanceled, StatusFailed)
+	if done.Status != StatusCanceled {
+		t.Errorf("expected canceled, got %s", done.Status)
+	}
+	if done.Result != `{"done":0}` || done.Log != "waiting\n" {
+		t.Errorf("expected partial result and log kept, got %s %q", done.Result, done.Log)
+	}
+	if Cancel(job.ID) {
+		t.Error("expected cancel of finished job to fail")
+	}
+}
+
+func TestCancel_Pending(t *testing.T) {
+	testutil.SetupTestDB(t)
+	oldDir := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = oldDir }()
+
+	job, _ := Enqueue(typeEcho, 0, nil, strings.NewReader("x"))
+	if !Cancel(job.ID) {
+		t.Fatal("expected cancel to succeed")
+	}
+	var got database.Job
+	database.DB.First(&got, job.ID)
+	if got.Status != StatusCanceled || got.FinishedAt == nil {
+		t.Errorf("expected canceled job, got %+v", got)
+	}
+	if _, err := os.Stat(InputPath(job.ID)); !os.IsNotExist(err) {
+		t.Error("expected input file removed")
+	}
+}
+
+func TestExecute_FailureAndPanic(t *testing.T) {
+	startPool(t)
+	failed, _ := Enqueue(typeFail, 0, nil, nil)
+	panicked, _ := Enqueue(typePanic, 0, nil, nil)
+
+	if job := waitForStatus(t, failed.ID, StatusFailed); job.Error != "broken" {
+		t.Errorf("expected error broken, got %q", job.Error)
+	}
+	if job := waitForStatus(t, panicked.ID, StatusFailed); !strings.Contains(job.Error, "boom") {
+		t.Errorf("expected panic message, got %q", job.Error)
+	}
+}
+
+func TestStop_FailsRunningJob(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	oldDir := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = oldDir }()
+
+	Start(1)
+	job, _ := Enqueue(typeBlock, 0, nil, nil)
+	waitForStatus(t, job.ID, StatusRunning)
+	Stop()
+
+	var got database.Job
+	database.DB.First(&got, job.ID)
+	if got.Status != StatusFailed || got.Error != "interrupted by shutdown" {
+		t.Errorf("expected job failed by shutdown, got %s %q", got.Status, got.Error)
+	}
+}
+
+func TestStart_FailsInterruptedJobs(t *testing.T) {
+	startPool(t)
+	Stop()
+	job := database.Job{Type: typeEcho, Status: StatusRunning}
+	database.DB.Create(&job)
+
+	Start(1)
+	var got database.Job
+	database.DB.First(&got, job.ID)
+	if got.Status != StatusFailed || got.Error != "interrupted by restart" {
+		t.Errorf("expected job failed by restart, got %s %q", got.Status, got.Error)
+	}
+}
+
+func TestRun_LogIsTruncated(t *testing.T) {
+	run := &Run{job: &database.Job{}, lastSave: time.Now().Add(time.Hour)}
+	line := strings.Repeat("x", 1023)
+	for i := 0; i < 100; i++ {
+		run.Logf("%s", line)
+	}
+	if run.log.Len() != maxLogSize {
+		t.Errorf("expected log truncated to %d bytes, got %d", maxLogSize, run.log.Len())
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	testutil.SetupTestDB(t)
+	oldDir := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = oldDir }()
+
+	old := database.Job{Type: typeEcho, Status: StatusSuccess, CreatedAt: time.Now().AddDate(0, 0, -8)}
+	oldPending := database.Job{Type: typeEcho, Status: StatusPending, CreatedAt: time.Now().AddDate(0, 0, -8)}
+	recent := database.Job{Type: typeEcho, Status: StatusSuccess}
+	database.DB.Create(&old)
+	database.DB.Create(&oldPending)
+	database.DB.Create(&recent)
+	os.WriteFile(OutputPath(old.ID), []byte("data"), 0644)
+
+	Cleanup()
+
+	var ids []uint
+	database.DB.Model(&database.Job{}).Order("id").Pluck("id", &ids)
+	if len(ids) != 2 || ids[0] != oldPending.ID || ids[1] != recent.ID {
+		t.Errorf("expected only old finished job removed, got %v", ids)
+	}
+	if _, err := os.Stat(OutputPath(old.ID)); !os.IsNotExist(err) {
+		t.Error("expected output file removed")
+	}
+}
+
+func TestExpireOutputs(t *testing.T) {
+	testutil.SetupTestDB(t)
+	oldDir := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = oldDir }()
+
+	expired := time.Now().Add(-OutputRetention - time.Minute)
+	fresh := time.Now()
+	old := database.Job{Type: typeEcho, Status: StatusSuccess, FinishedAt: &expired}
+	recent := database.Job{Type: typeEcho, Status: StatusSuccess, FinishedAt: &fresh}
+	database.DB.Create(&old)
+	database.DB.Create(&recent)
+	os.WriteFile(OutputPath(old.ID), []byte("data"), 0600)
+	os.WriteFile(OutputPath(recent.ID), []byte("data"), 0600)
+
+	ExpireOutputs()
+
+	if _, err := os.Stat(OutputPath(old.ID)); !os.IsNotExist(err) {
+		t.Error("expected the expired output removed")
+	}
+	if _, err := os.Stat(OutputPath(recent.ID)); err != nil {
+		t.Errorf("expected the recent output kept: %v", err)
+	}
+	var count int64
+	database.DB.Model(&database.Job{}).Count(&count)
+	if count != 2 {
+		t.Errorf("expected the job rows kept, got %d", count)
+	}
+}
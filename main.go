@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"final-account-hub/database"
+	"final-account-hub/jobs"
 	"final-account-hub/logger"
 	"final-account-hub/routes"
 	"final-account-hub/validator"
@@ -25,8 +27,29 @@ func main() {
 	}
 	logger.Init()
 	database.InitDB()
+
+	// "rotate-key" re-encrypts all account data and webhook secrets with
+	// ENCRYPTION_KEY and exits
+	if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+		n, err := database.RotateEncryptionKey()
+		if err != nil {
+			logger.Error.Fatal("Key rotation failed: ", err)
+		}
+		logger.Info.Printf("Re-encrypted %d accounts", n)
+		return
+	}
+
 	database.CleanupAllValidationRuns()
 	validator.StartScheduler()
+	if os.Getenv("VALIDATION_AUTO_RESUME") != "false" {
+		validator.ResumeInterruptedRuns()
+	}
+
+	workers := 2
+	if v, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+	jobs.Start(workers)
 
 	r := gin.New()
 	r.Use(logger.GinLogger(), gin.Recovery())
@@ -67,6 +90,7 @@ func main() {
 
 	logger.Info.Println("Shutting down server...")
 	validator.StopScheduler()
+	jobs.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
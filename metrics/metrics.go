@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "account_hub"
+
+// Registry holds every metric served at /metrics. Packages that own state
+// only they can read (such as the cron scheduler) register collectors here.
+var Registry = prometheus.NewRegistry()
+
+var (
+	FetchRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_requests_total",
+		Help:      "Fetch requests by category and result (ok, empty, error).",
+	}, []string{"category_id", "result"})
+
+	FetchedAccounts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetched_accounts_total",
+		Help:      "Accounts returned by fetch requests.",
+	}, []string{"category_id"})
+
+	FetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Fetch request latency.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"category_id"})
+
+	AuthFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Requests rejected because of a missing or invalid passkey or token.",
+	})
+
+	AuthBlocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_ip_blocks_total",
+		Help:      "Times a client IP was blocked after too many failed attempts.",
+	})
+
+	AuthBlockedRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_blocked_requests_total",
+		Help:      "Requests rejected because the client IP is blocked.",
+	})
+
+	ValidationRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "validation_run_duration_seconds",
+		Help:      "Duration of validation runs by final status.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"category_id", "status"})
+
+	ValidationBatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_batches_total",
+		Help:      "Validation batches by outcome (ok, error, timeout, invalid_output).",
+	}, []string{"category_id", "outcome"})
+
+	ValidationAccounts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_accounts_total",
+		Help:      "Validated accounts by result (ok, used, banned, error).",
+	}, []string{"category_id", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		poolCollector{},
+		FetchRequests, FetchedAccounts, FetchDuration,
+		AuthFailures, AuthBlocks, AuthBlockedRequests,
+		ValidationRunDuration, ValidationBatches, ValidationAccounts,
+	)
+}
+
+// CategoryLabel formats a category ID for use as a label value.
+func CategoryLabel(categoryID uint) string {
+	return fmt.Sprintf("%d", categoryID)
+}
+
+// ObserveFetch records one fetch request that returned count accounts.
+func ObserveFetch(categoryID uint, count int, err error, started time.Time) {
+	label := CategoryLabel(categoryID)
+	result := "ok"
+	switch {
+	case err != nil:
+		result = "error"
+	case count == 0:
+		result = "empty"
+	}
+	FetchRequests.WithLabelValues(label, result).Inc()
+	if err == nil {
+		FetchedAccounts.WithLabelValues(label).Add(float64(count))
+	}
+	FetchDuration.WithLabelValues(label).Observe(time.Since(started).Seconds())
+}
+
+// Handler serves the registry in the Prometheus text format. When
+// METRICS_TOKEN is set, scrapers must send it as a bearer token.
+func Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if token := os.Getenv("METRICS_TOKEN"); token != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+var poolDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "pool_accounts"),
+	"Accounts per category and status (available, used, banned).",
+	[]string{"category_id", "category", "status"}, nil,
+)
+
+// poolCollector reads pool sizes from the database on each scrape so the
+// numbers always match the stats endpoints.
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolDesc
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if database.DB == nil {
+		return
+	}
+	var rows []struct {
+		ID        uint
+		Name      string
+		Available int64
+		Used      int64
+		Banned    int64
+	}
+	now := time.Now()
+	available, availArgs := database.AvailableCondition("accounts", now)
+	used, usedArgs := database.UsedCondition("accounts", now)
+	args := append(append(availArgs, usedArgs...), true)
+	err := database.DB.Table("categories").
+		Select("categories.id, categories.name, "+
+			"COALESCE(SUM(CASE WHEN "+available+" THEN 1 ELSE 0 END), 0) AS available, "+
+			"COALESCE(SUM(CASE WHEN "+used+" THEN 1 ELSE 0 END), 0) AS used, "+
+			"COALESCE(SUM(CASE WHEN accounts.banned = ? THEN 1 ELSE 0 END), 0) AS banned",
+			args...).
+		Joins("LEFT JOIN accounts ON accounts.category_id = categories.id AND accounts.deleted_at IS NULL").
+		Where("categories.deleted_at IS NULL").
+		Group("categories.id, categories.name").
+		Scan(&rows).Error
+	if err != nil {
+		logger.Error.Printf("Failed to collect pool metrics: %v", err)
+		return
+	}
+	for _, r := range rows {
+		id := CategoryLabel(r.ID)
+		ch <- prometheus.MustNewConstMetric(poolDesc, prometheus.GaugeValue, float64(r.Available), id, r.Name, "available")
+		ch <- prometheus.MustNewConstMetric(poolDesc, prometheus.GaugeValue, float64(r.Used), id, r.Name, "used")
+		ch <- prometheus.MustNewConstMetric(poolDesc, prometheus.GaugeValue, float64(r.Banned), id, r.Name, "banned")
+	}
+}
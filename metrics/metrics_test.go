@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"final-account-hub/testutil"
+
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrape(t *testing.T, header string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := testutil.SetupTestRouter()
+	router.GET("/metrics", Handler())
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_PoolSizes(t *testing.T) {
+	testutil.SetupTestDB(t)
+	cat := testutil.SeedCategory(t, "pool")
+	testutil.SeedAccounts(t, cat.ID, 2, "a")
+	testutil.SeedAccountWithStatus(t, cat.ID, "u", true, false)
+	testutil.SeedAccountWithStatus(t, cat.ID, "b", false, true)
+	testutil.SeedCategory(t, "empty")
+
+	w := scrape(t, "")
+	testutil.AssertStatus(t, w, http.StatusOK)
+	body := w.Body.String()
+	for _, want := range []string{
+		`account_hub_pool_accounts{category="pool",category_id="1",status="available"} 2`,
+		`account_hub_pool_accounts{category="pool",category_id="1",status="used"} 1`,
+		`account_hub_pool_accounts{category="pool",category_id="1",status="banned"} 1`,
+		`account_hub_pool_accounts{category="empty",category_id="2",status="available"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
+
+func TestHandler_Token(t *testing.T) {
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "METRICS_TOKEN", "scrape-me")
+
+	testutil.AssertStatus(t, scrape(t, ""), http.StatusUnauthorized)
+	testutil.AssertStatus(t, scrape(t, "Bearer wrong"), http.StatusUnauthorized)
+	testutil.AssertStatus(t, scrape(t, "Bearer scrape-me"), http.StatusOK)
+}
+
+func TestObserveFetch(t *testing.T) {
+	FetchRequests.Reset()
+	FetchedAccounts.Reset()
+
+	ObserveFetch(7, 3, nil, time.Now())
+	ObserveFetch(7, 0, nil, time.Now())
+	ObserveFetch(7, 5, errors.New("boom"), time.Now())
+
+	for result, want := range map[string]float64{"ok": 1, "empty": 1, "error": 1} {
+		if got := promtest.ToFloat64(FetchRequests.WithLabelValues("7", result)); got != want {
+			t.Errorf("fetch_requests_total{result=%q} = %v, want %v", result, got, want)
+		}
+	}
+	if got := promtest.ToFloat64(FetchedAccounts.WithLabelValues("7")); got != 3 {
+		t.Errorf("expected failed fetches not to count accounts, got %v", got)
+	}
+}
+
+func TestRegistry_Lint(t *testing.T) {
+	testutil.SetupTestDB(t)
+	problems, err := promtest.GatherAndLint(Registry)
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	for _, p := range problems {
+		if strings.HasPrefix(p.Metric, "account_hub_") {
+			t.Errorf("lint: %s: %s", p.Metric, p.Text)
+		}
+	}
+}
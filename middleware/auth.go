@@ -5,9 +5,13 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"final-account-hub/database"
+	"final-account-hub/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -58,19 +62,31 @@ func AuthMiddleware() gin.HandlerFunc {
 		rateMutex.RLock()
 		if until, blocked := blockedUntil[ip]; blocked && time.Now().Before(until) {
 			rateMutex.RUnlock()
+			metrics.AuthBlockedRequests.Inc()
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts"})
 			c.Abort()
 			return
 		}
 		rateMutex.RUnlock()
 
+		// X-Passkey carries either the master PASSKEY or a scoped API token.
 		providedKey := c.GetHeader("X-Passkey")
-		if subtle.ConstantTimeCompare([]byte(providedKey), []byte(passkey)) != 1 {
+		authorized := subtle.ConstantTimeCompare([]byte(providedKey), []byte(passkey)) == 1
+		var token *database.APIToken
+		if !authorized && strings.HasPrefix(providedKey, database.TokenPrefix) {
+			if t, err := database.FindActiveToken(providedKey); err == nil {
+				token = t
+				authorized = true
+			}
+		}
+		if !authorized {
+			metrics.AuthFailures.Inc()
 			rateMutex.Lock()
 			failedAttempts[ip]++
 			if failedAttempts[ip] >= maxAttempts {
 				blockedUntil[ip] = time.Now().Add(time.Duration(blockMinutes) * time.Minute)
 				delete(failedAttempts, ip)
+				metrics.AuthBlocks.Inc()
 			}
 			rateMutex.Unlock()
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
@@ -83,6 +99,11 @@ func AuthMiddleware() gin.HandlerFunc {
 		delete(blockedUntil, ip)
 		rateMutex.Unlock()
 
+		if token != nil {
+			c.Set(tokenContextKey, token)
+			database.TouchToken(token)
+		}
+
 		c.Next()
 	}
 }
@@ -7,6 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -164,3 +167,126 @@ func TestAuthMiddleware_RateLimit_BlockExpiry(t *testing.T) {
 		t.Errorf("expected 200 after block expiry, got %d", w.Code)
 	}
 }
+
+// seedToken stores a token with the given scope and returns its plaintext.
+func seedToken(t *testing.T, permissions, categoryIDs string, expiresAt *time.Time) string {
+	t.Helper()
+	plain, err := database.GenerateToken()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	tok := database.APIToken{
+		Name:        "test",
+		TokenHash:   database.HashToken(plain),
+		Permissions: permissions,
+		CategoryIDs: categoryIDs,
+		ExpiresAt:   expiresAt,
+	}
+	if err := database.DB.Create(&tok).Error; err != nil {
+		t.Fatalf("failed to seed token: %v", err)
+	}
+	return plain
+}
+
+// newScopedRouter registers routes gated the same way routes.SetupRoutes does.
+func newScopedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthMiddleware())
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	r.POST("/fetch", RequirePermission("fetch"), ok)
+	r.DELETE("/categories/:id", RequirePermission("admin"), RequireCategoryParam("id"), ok)
+	r.GET("/categories/:id", RequirePermission("read"), RequireCategoryParam("id"), ok)
+	r.GET("/stats", RequirePermission("read"), RequireAllCategories(), ok)
+	return r
+}
+
+func doTokenReq(r *gin.Engine, method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Passkey", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddleware_Token_FetchOnly(t *testing.T) {
+	resetRateLimitState()
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "PASSKEY", "correct")
+	token := seedToken(t, "fetch", "", nil)
+
+	r := newScopedRouter()
+	if w := doTokenReq(r, http.MethodPost, "/fetch", token); w.Code != http.StatusOK {
+		t.Errorf("fetch: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doTokenReq(r, http.MethodDelete, "/categories/1", token); w.Code != http.StatusForbidden {
+		t.Errorf("delete category: expected 403, got %d", w.Code)
+	}
+	if w := doTokenReq(r, http.MethodGet, "/categories/1", token); w.Code != http.StatusForbidden {
+		t.Errorf("read category: expected 403, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_Token_AdminImpliesAll(t *testing.T) {
+	resetRateLimitState()
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "PASSKEY", "correct")
+	token := seedToken(t, "admin", "", nil)
+
+	r := newScopedRouter()
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/fetch"},
+		{http.MethodGet, "/categories/1"},
+		{http.MethodDelete, "/categories/1"},
+		{http.MethodGet, "/stats"},
+	} {
+		if w := doTokenReq(r, tc.method, tc.path, token); w.Code != http.StatusOK {
+			t.Errorf("%s %s: expected 200, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+}
+
+func TestAuthMiddleware_Token_CategoryScope(t *testing.T) {
+	resetRateLimitState()
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "PASSKEY", "correct")
+	token := seedToken(t, "read", "1,3", nil)
+
+	r := newScopedRouter()
+	if w := doTokenReq(r, http.MethodGet, "/categories/3", token); w.Code != http.StatusOK {
+		t.Errorf("in-scope category: expected 200, got %d", w.Code)
+	}
+	if w := doTokenReq(r, http.MethodGet, "/categories/2", token); w.Code != http.StatusForbidden {
+		t.Errorf("out-of-scope category: expected 403, got %d", w.Code)
+	}
+	if w := doTokenReq(r, http.MethodGet, "/stats", token); w.Code != http.StatusForbidden {
+		t.Errorf("global endpoint with scoped token: expected 403, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_Token_ExpiredOrUnknown(t *testing.T) {
+	resetRateLimitState()
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "PASSKEY", "correct")
+	past := time.Now().Add(-time.Hour)
+	expired := seedToken(t, "admin", "", &past)
+
+	r := newScopedRouter()
+	if w := doTokenReq(r, http.MethodGet, "/stats", expired); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired token: expected 401, got %d", w.Code)
+	}
+	if w := doTokenReq(r, http.MethodGet, "/stats", database.TokenPrefix+"deadbeef"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token: expected 401, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_Passkey_BypassesPermissions(t *testing.T) {
+	resetRateLimitState()
+	testutil.SetupTestDB(t)
+	testutil.SetEnv(t, "PASSKEY", "correct")
+
+	r := newScopedRouter()
+	if w := doTokenReq(r, http.MethodDelete, "/categories/7", "correct"); w.Code != http.StatusOK {
+		t.Errorf("master passkey: expected 200, got %d", w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"final-account-hub/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tokenContextKey = "api_token"
+
+// TokenFromContext returns the API token that authenticated the request,
+// or nil when the request was authenticated with the master PASSKEY.
+func TokenFromContext(c *gin.Context) *database.APIToken {
+	if v, ok := c.Get(tokenContextKey); ok {
+		if t, ok := v.(*database.APIToken); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// RequirePermission rejects token-authenticated requests whose token does not
+// grant perm. Requests using the master PASSKEY always pass.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := TokenFromContext(c); t != nil && !t.HasPermission(perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token lacks " + perm + " permission"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireCategoryParam rejects requests whose category ID path parameter is
+// outside the token's category scope.
+func RequireCategoryParam(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 64)
+		if err == nil && !CategoryAllowed(c, uint(id)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token not allowed for this category"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAllCategories rejects tokens restricted to specific categories.
+// Used for endpoints that aggregate or manage data across every category.
+func RequireAllCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := TokenFromContext(c); t != nil && !t.AllCategories() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token is restricted to specific categories"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CategoryAllowed reports whether the caller may act on categoryID.
+func CategoryAllowed(c *gin.Context, categoryID uint) bool {
+	t := TokenFromContext(c)
+	return t == nil || t.AllowsCategory(categoryID)
+}
+
+// AllowedCategoryIDs returns the caller's category scope. ok is false when the
+// caller is not restricted, in which case ids should be ignored.
+func AllowedCategoryIDs(c *gin.Context) (ids []uint, ok bool) {
+	t := TokenFromContext(c)
+	if t == nil || t.AllCategories() {
+		return nil, false
+	}
+	return t.CategoryIDList(), true
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"final-account-hub/handlers"
+	"final-account-hub/metrics"
 	"final-account-hub/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -9,47 +10,105 @@ import (
 
 func SetupRoutes(r *gin.Engine) {
 	r.GET("/health", handlers.HealthCheck)
+	r.GET("/health/live", handlers.HealthLive)
+	r.GET("/health/ready", handlers.HealthReady)
+	r.GET("/metrics", metrics.Handler())
+
+	// Permission gates for token-authenticated requests. The master PASSKEY
+	// passes all of them; see middleware.RequirePermission.
+	fetch := middleware.RequirePermission("fetch")
+	read := middleware.RequirePermission("read")
+	write := middleware.RequirePermission("write")
+	admin := middleware.RequirePermission("admin")
+	category := middleware.RequireCategoryParam("id")
+	accountCategory := middleware.RequireCategoryParam("category_id")
+	global := middleware.RequireAllCategories()
 
 	api := r.Group("/api")
 	api.Use(middleware.AuthMiddleware())
 	{
-		api.POST("/categories", handlers.CreateCategory)
-		api.POST("/categories/ensure", handlers.CreateCategoryIfNotExists)
-		api.GET("/categories", handlers.GetCategories)
-		api.GET("/categories/overview", handlers.GetCategoriesOverview)
-		api.DELETE("/categories/:id", handlers.DeleteCategory)
-		api.GET("/categories/:id", handlers.GetCategory)
-		api.PUT("/categories/:id/validation-script", handlers.UpdateCategoryValidationScript)
-		api.POST("/categories/:id/test-validation", handlers.TestValidationScript)
-		api.GET("/categories/:id/validation-runs", handlers.GetValidationRuns)
-		api.DELETE("/categories/:id/validation-runs", handlers.DeleteValidationRuns)
-		api.POST("/categories/:id/run-validation", handlers.RunValidationNow)
-		api.POST("/categories/:id/stop-validation", handlers.StopValidation)
-		api.GET("/validation-runs/:run_id/log", handlers.GetValidationRunLog)
-		api.GET("/categories/:id/packages", handlers.GetUVPackages)
-		api.POST("/categories/:id/packages/install", handlers.InstallUVPackage)
-		api.POST("/categories/:id/packages/uninstall", handlers.UninstallUVPackage)
-		api.POST("/categories/:id/packages/requirements", handlers.InstallRequirements)
-
-		api.POST("/accounts", handlers.AddAccount)
-		api.POST("/accounts/bulk", handlers.AddAccountsBulk)
-		api.GET("/accounts/:category_id", handlers.GetAccounts)
-		api.POST("/accounts/fetch", handlers.FetchAccounts)
-		api.PUT("/accounts/batch/update", handlers.BatchUpdateAccounts)
-		api.PUT("/accounts/:id", handlers.UpdateAccount)
-		api.DELETE("/accounts", handlers.DeleteAccounts)
-		api.DELETE("/accounts/by-ids", handlers.DeleteAccountsByIds)
-		api.GET("/accounts/:category_id/stats", handlers.GetAccountStats)
-		api.GET("/accounts/:category_id/snapshots", handlers.GetSnapshots)
-		api.GET("/stats", handlers.GetGlobalStats)
-		api.GET("/snapshots", handlers.GetGlobalSnapshots)
-		api.GET("/validation-runs/recent", handlers.GetRecentValidationRuns)
-		api.GET("/history/frequency", handlers.GetAPICallFrequency)
-
-		api.GET("/categories/:id/history", handlers.GetAPICallHistory)
-		api.DELETE("/categories/:id/history", handlers.DeleteAPICallHistory)
-		api.DELETE("/categories/:id/history/all", handlers.ClearAPICallHistory)
-		api.PUT("/categories/:id/validation-history-limit", handlers.UpdateValidationHistoryLimit)
-		api.PUT("/categories/:id/api-history-limit", handlers.UpdateApiHistoryLimit)
+		api.POST("/categories", admin, global, handlers.CreateCategory)
+		api.POST("/categories/ensure", admin, global, handlers.CreateCategoryIfNotExists)
+		api.GET("/categories", read, handlers.GetCategories)
+		api.GET("/categories/overview", read, handlers.GetCategoriesOverview)
+		api.DELETE("/categories/:id", admin, category, handlers.DeleteCategory)
+		api.GET("/categories/:id", read, category, handlers.GetCategory)
+		api.PUT("/categories/:id/validation-script", admin, category, handlers.UpdateCategoryValidationScript)
+		api.POST("/categories/:id/test-validation", admin, category, handlers.TestValidationScript)
+		api.GET("/categories/:id/script-revisions", read, category, handlers.GetScriptRevisions)
+		api.GET("/categories/:id/script-revisions/:rev", read, category, handlers.GetScriptRevision)
+		api.GET("/categories/:id/script-revisions/:rev/diff", read, category, handlers.DiffScriptRevision)
+		api.POST("/categories/:id/script-revisions/:rev/rollback", admin, category, handlers.RollbackScriptRevision)
+		api.GET("/categories/:id/validation-runs", read, category, handlers.GetValidationRuns)
+		api.DELETE("/categories/:id/validation-runs", write, category, handlers.DeleteValidationRuns)
+		api.POST("/categories/:id/run-validation", write, category, handlers.RunValidationNow)
+		api.POST("/categories/:id/stop-validation", write, category, handlers.StopValidation)
+		api.GET("/validation-runs/:run_id/log", read, handlers.GetValidationRunLog)
+		api.POST("/validation-runs/:run_id/resume", write, handlers.ResumeValidationRun)
+		api.GET("/categories/:id/packages", read, category, handlers.GetUVPackages)
+		api.POST("/categories/:id/packages/install", admin, category, handlers.InstallUVPackage)
+		api.POST("/categories/:id/packages/uninstall", admin, category, handlers.UninstallUVPackage)
+		api.POST("/categories/:id/packages/requirements", admin, category, handlers.InstallRequirements)
+
+		api.POST("/accounts", write, handlers.AddAccount)
+		api.POST("/accounts/bulk", write, handlers.AddAccountsBulk)
+		api.POST("/accounts/:category_id/import", write, accountCategory, handlers.ImportAccountsFile)
+		api.GET("/accounts/:category_id", read, accountCategory, handlers.GetAccounts)
+		api.POST("/accounts/fetch", fetch, handlers.FetchAccounts)
+		api.POST("/accounts/leases/:id/release", fetch, handlers.ReleaseLease)
+		api.POST("/accounts/leases/:id/renew", fetch, handlers.RenewLease)
+		api.POST("/accounts/leases/:id/consume", fetch, handlers.ConsumeLease)
+		api.POST("/accounts/tags", write, handlers.AddAccountTags)
+		api.DELETE("/accounts/tags", write, handlers.RemoveAccountTags)
+		api.PUT("/accounts/batch/update", write, handlers.BatchUpdateAccounts)
+		api.PUT("/accounts/:id", write, handlers.UpdateAccount)
+		api.DELETE("/accounts", write, handlers.DeleteAccounts)
+		api.DELETE("/accounts/by-ids", write, handlers.DeleteAccountsByIds)
+		api.GET("/accounts/:category_id/stats", read, accountCategory, handlers.GetAccountStats)
+		api.GET("/accounts/:category_id/history", read, handlers.GetAccountHistory)
+		api.GET("/accounts/:category_id/snapshots", read, accountCategory, handlers.GetSnapshots)
+		api.GET("/accounts/:category_id/export", read, accountCategory, handlers.ExportAccounts)
+		api.POST("/accounts/:category_id/export", fetch, accountCategory, handlers.ExportAccounts)
+		api.GET("/stats", read, global, handlers.GetGlobalStats)
+		api.GET("/snapshots", read, global, handlers.GetGlobalSnapshots)
+		api.GET("/validation-runs/recent", read, global, handlers.GetRecentValidationRuns)
+		api.GET("/history/frequency", read, global, handlers.GetAPICallFrequency)
+		api.GET("/alerts", read, handlers.GetAlerts)
+		api.GET("/jobs", read, handlers.GetJobs)
+		api.GET("/jobs/:id", read, handlers.GetJob)
+		api.POST("/jobs/:id/cancel", write, handlers.CancelJob)
+		api.GET("/jobs/:id/download", read, handlers.DownloadJobOutput)
+		api.GET("/audit", admin, handlers.GetAuditLogs)
+		api.GET("/trash/categories", read, handlers.GetTrashCategories)
+		api.POST("/trash/categories/:id/restore", admin, category, handlers.RestoreTrashCategory)
+		api.DELETE("/trash/categories/:id", admin, category, handlers.PurgeTrashCategory)
+		api.GET("/trash/accounts", read, handlers.GetTrashAccounts)
+		api.POST("/trash/accounts/restore", write, handlers.RestoreTrashAccounts)
+		api.DELETE("/trash/accounts", admin, handlers.PurgeTrashAccounts)
+
+		api.GET("/categories/:id/history", read, category, handlers.GetAPICallHistory)
+		api.DELETE("/categories/:id/history", write, category, handlers.DeleteAPICallHistory)
+		api.DELETE("/categories/:id/history/all", write, category, handlers.ClearAPICallHistory)
+		api.PUT("/categories/:id/validation-history-limit", admin, category, handlers.UpdateValidationHistoryLimit)
+		api.PUT("/categories/:id/api-history-limit", admin, category, handlers.UpdateApiHistoryLimit)
+		api.PUT("/categories/:id/max-uses", admin, category, handlers.UpdateMaxUses)
+		api.PUT("/categories/:id/cooldown", admin, category, handlers.UpdateCooldown)
+		api.PUT("/categories/:id/account-schema", admin, category, handlers.UpdateAccountSchema)
+		api.PUT("/categories/:id/low-watermark", admin, category, handlers.UpdateLowWatermark)
+		api.PUT("/categories/:id/trash-retention", admin, category, handlers.UpdateTrashRetention)
+
+		api.POST("/tokens", admin, global, handlers.CreateToken)
+		api.GET("/tokens", admin, global, handlers.GetTokens)
+		api.PUT("/tokens/:id", admin, global, handlers.UpdateToken)
+		api.DELETE("/tokens/:id", admin, global, handlers.DeleteToken)
+
+		api.POST("/webhooks", admin, global, handlers.CreateWebhook)
+		api.GET("/webhooks", admin, global, handlers.GetWebhooks)
+		api.PUT("/webhooks/:id", admin, global, handlers.UpdateWebhook)
+		api.DELETE("/webhooks/:id", admin, global, handlers.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", admin, global, handlers.GetWebhookDeliveries)
+
+		api.GET("/export", admin, global, handlers.ExportBackup)
+		api.POST("/import", admin, global, handlers.ImportBackup)
 	}
 }
@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"final-account-hub/database"
@@ -28,12 +29,25 @@ import (
 // output. The returned cleanup function closes the underlying sql.DB.
 func SetupTestDB(t *testing.T) {
 	t.Helper()
+	openTestDB(t, ":memory:")
+}
+
+// SetupFileTestDB is like SetupTestDB but backs the database with a file in a
+// temporary directory, so every pooled connection sees the same data. Use it
+// for tests that exercise concurrent transactions.
+func SetupFileTestDB(t *testing.T) {
+	t.Helper()
+	openTestDB(t, filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000&_txlock=immediate")
+}
+
+func openTestDB(t *testing.T, dsn string) {
+	t.Helper()
 
 	// Suppress logger output during tests
 	logger.Info = log.New(io.Discard, "", 0)
 	logger.Error = log.New(io.Discard, "", 0)
 
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
 	})
 	if err != nil {
@@ -46,6 +60,15 @@ func SetupTestDB(t *testing.T) {
 		&database.ValidationRun{},
 		&database.APICallHistory{},
 		&database.AccountSnapshot{},
+		&database.APIToken{},
+		&database.AccountTag{},
+		&database.Webhook{},
+		&database.WebhookDelivery{},
+		&database.Alert{},
+		&database.Job{},
+		&database.AuditLog{},
+		&database.ScriptRevision{},
+		&database.AccountHistory{},
 	); err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
@@ -0,0 +1,42 @@
+package validator
+
+import (
+	"final-account-hub/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cronNextRunDesc = prometheus.NewDesc(
+		"account_hub_cron_next_run_timestamp_seconds",
+		"Unix time of the next scheduled run of each cron job.",
+		[]string{"job"}, nil,
+	)
+	runningValidationsDesc = prometheus.NewDesc(
+		"account_hub_validation_running",
+		"Validation runs currently in progress.",
+		nil, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(schedulerCollector{})
+}
+
+// schedulerCollector exports the cron schedule and running validations.
+type schedulerCollector struct{}
+
+func (schedulerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cronNextRunDesc
+	ch <- runningValidationsDesc
+}
+
+func (schedulerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, job := range ScheduledJobs() {
+		if job.Next.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(cronNextRunDesc, prometheus.GaugeValue, float64(job.Next.Unix()), job.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(runningValidationsDesc, prometheus.GaugeValue, float64(RunningValidations()))
+}
@@ -8,16 +8,23 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"final-account-hub/database"
+	"final-account-hub/jobs"
 	"final-account-hub/logger"
+	"final-account-hub/metrics"
+	"final-account-hub/webhook"
 
 	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
 )
 
 const defaultBatchSize = 50
+
+// accountPageSize is how many accounts a run loads from the database at a
+// time; pages are fetched by ID so memory stays bounded on any category size.
+const accountPageSize = 1000
 const batchResultSentinel = "---BATCH_RESULT---"
 const testResultSentinel = "---TEST_RESULT---"
 
@@ -45,6 +52,8 @@ type TestScriptResult struct {
 
 var cronScheduler *cron.Cron
 var categoryJobs = make(map[uint]cron.EntryID)
+var systemJobs = make(map[cron.EntryID]string)
+var schedulerRunning bool
 var jobsMutex sync.Mutex
 var runningValidations = make(map[uint]context.CancelFunc)
 var runningMutex sync.Mutex
@@ -52,12 +61,37 @@ var runningMutex sync.Mutex
 func StartScheduler() {
 	cronScheduler = cron.New()
 	cronScheduler.Start()
+	jobsMutex.Lock()
+	systemJobs = make(map[cron.EntryID]string)
+	schedulerRunning = true
+	jobsMutex.Unlock()
+
+	// Return accounts whose lease deadline passed to the available pool
+	addSystemJob("release_expired_leases", "@every 1m", func() { database.ReleaseExpiredLeases() })
+
+	// Return accounts whose cooldown elapsed to the available pool
+	addSystemJob("release_cooled_down_accounts", "@every 1m", func() { database.ReleaseCooledDownAccounts() })
+
+	// Retry failed webhook deliveries and trim the delivery log
+	addSystemJob("webhook_retry", "@every 30s", webhook.RetryDue)
+	addSystemJob("webhook_cleanup", "30 1 * * *", webhook.CleanupDeliveries)
+
+	// Drop export files shortly after their job finishes, and finished
+	// background jobs after a week
+	addSystemJob("job_output_expiry", "@every 1m", jobs.ExpireOutputs)
+	addSystemJob("job_cleanup", "45 1 * * *", jobs.Cleanup)
+
+	// Permanently delete trash past each category's retention period
+	addSystemJob("trash_purge", "15 2 * * *", func() { database.PurgeTrash() })
+
+	// Drop account history older than 90 days
+	addSystemJob("account_history_cleanup", "20 2 * * *", database.CleanupAccountHistory)
 
 	// Snapshot cron jobs
-	cronScheduler.AddFunc("@every 1h", func() { database.TakeSnapshots("1h") })
-	cronScheduler.AddFunc("0 0 * * *", func() { database.TakeSnapshots("1d") })
-	cronScheduler.AddFunc("0 0 * * 1", func() { database.TakeSnapshots("1w") })
-	cronScheduler.AddFunc("0 1 * * *", func() { database.CleanupOldSnapshots() })
+	addSystemJob("snapshot_1h", "@every 1h", func() { database.TakeSnapshots("1h") })
+	addSystemJob("snapshot_1d", "0 0 * * *", func() { database.TakeSnapshots("1d") })
+	addSystemJob("snapshot_1w", "0 0 * * 1", func() { database.TakeSnapshots("1w") })
+	addSystemJob("snapshot_cleanup", "0 1 * * *", func() { database.CleanupOldSnapshots() })
 
 	// Take initial snapshots on startup so charts are not empty
 	go func() {
@@ -69,6 +103,56 @@ func StartScheduler() {
 	ReloadAllJobs()
 }
 
+// addSystemJob schedules a named maintenance job.
+func addSystemJob(name, spec string, fn func()) {
+	entryID, err := cronScheduler.AddFunc(spec, fn)
+	if err != nil {
+		logger.Error.Printf("Failed to add cron job %s: %v", name, err)
+		return
+	}
+	jobsMutex.Lock()
+	systemJobs[entryID] = name
+	jobsMutex.Unlock()
+}
+
+// ScheduledJob is a cron entry with its next run time. Validation jobs are
+// named "validation:<category id>".
+type ScheduledJob struct {
+	Name string
+	Next time.Time
+}
+
+// ScheduledJobs lists the scheduler's jobs. It returns nil when the
+// scheduler has not been started.
+func ScheduledJobs() []ScheduledJob {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	if cronScheduler == nil {
+		return nil
+	}
+	names := make(map[cron.EntryID]string, len(systemJobs)+len(categoryJobs))
+	for id, name := range systemJobs {
+		names[id] = name
+	}
+	for catID, id := range categoryJobs {
+		names[id] = fmt.Sprintf("validation:%d", catID)
+	}
+	var jobs []ScheduledJob
+	for _, e := range cronScheduler.Entries() {
+		if name, ok := names[e.ID]; ok {
+			jobs = append(jobs, ScheduledJob{Name: name, Next: e.Next})
+		}
+	}
+	return jobs
+}
+
+// RunningValidations returns how many categories are being validated.
+func RunningValidations() int {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	return len(runningValidations)
+}
+
 func ReloadAllJobs() {
 	jobsMutex.Lock()
 	defer jobsMutex.Unlock()
@@ -127,6 +211,12 @@ func addJobForCategory(cat database.Category) {
 }
 
 func validateCategory(cat database.Category) {
+	runValidation(cat, nil)
+}
+
+// runValidation validates the category's accounts in scope. With resume set,
+// it continues that run after its cursor instead of starting a new one.
+func runValidation(cat database.Category, resume *database.ValidationRun) {
 	// Skip if already running for this category
 	runningMutex.Lock()
 	if _, running := runningValidations[cat.ID]; running {
@@ -145,31 +235,68 @@ func validateCategory(cat database.Category) {
 		delete(runningValidations, cat.ID)
 		runningMutex.Unlock()
 	}()
+	if cat.RunDeadlineMinutes > 0 {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithTimeout(ctx, time.Duration(cat.RunDeadlineMinutes)*time.Minute)
+		defer cancelDeadline()
+	}
 
 	logger.Info.Printf("Starting validation for category %s (ID: %d)", cat.Name, cat.ID)
 
 	// Build scope-based WHERE clause
 	scopeConditions := buildScopeConditions(cat.ValidationScope)
-	var accounts []database.Account
-	database.DB.Where("category_id = ? AND ("+scopeConditions+")", cat.ID).Limit(100000).Find(&accounts)
-	logger.Info.Printf("Found %d accounts to validate (scope: %s)", len(accounts), cat.ValidationScope)
-
-	// Create run record
-	run := database.ValidationRun{
-		CategoryID: cat.ID,
-		Status:     "running",
-		TotalCount: len(accounts),
-		StartedAt:  time.Now(),
-	}
-	if err := database.DB.Create(&run).Error; err != nil {
-		logger.Error.Printf("Failed to create run record: %v", err)
-		return
+	inScope := func() *gorm.DB {
+		return database.DB.Model(&database.Account{}).Where("category_id = ? AND ("+scopeConditions+")", cat.ID)
 	}
-	logger.Info.Printf("Created run record ID: %d", run.ID)
-	if err := database.CleanupValidationRuns(cat.ID, cat.ValidationHistoryLimit); err != nil {
-		logger.Error.Printf("Failed to cleanup old validation runs: %v", err)
+
+	var run database.ValidationRun
+	if resume != nil {
+		run = *resume
+		run.Status = database.RunStatusRunning
+		run.ResumeCount++
+		if err := database.DB.Model(&run).Updates(map[string]interface{}{
+			"status":       run.Status,
+			"resume_count": run.ResumeCount,
+			"finished_at":  nil,
+		}).Error; err != nil {
+			logger.Error.Printf("Failed to resume run %d: %v", run.ID, err)
+			return
+		}
+		logger.Info.Printf("Resuming run ID: %d after account %d", run.ID, run.Cursor)
+	} else {
+		// The run covers the accounts in scope now; accounts added later
+		// wait for the next run
+		var total int64
+		inScope().Count(&total)
+		var lastAccountID uint
+		inScope().Select("COALESCE(MAX(id), 0)").Scan(&lastAccountID)
+		logger.Info.Printf("Found %d accounts to validate (scope: %s)", total, cat.ValidationScope)
+
+		// A new run supersedes runs still waiting to be resumed
+		database.DB.Model(&database.ValidationRun{}).
+			Where("category_id = ? AND status = ?", cat.ID, database.RunStatusInterrupted).
+			Update("status", database.RunStatusStopped)
+
+		// Create run record
+		run = database.ValidationRun{
+			CategoryID:     cat.ID,
+			Status:         database.RunStatusRunning,
+			TotalCount:     int(total),
+			LastAccountID:  lastAccountID,
+			ScriptRevision: cat.ScriptRevision,
+			StartedAt:      time.Now(),
+		}
+		if err := database.DB.Create(&run).Error; err != nil {
+			logger.Error.Printf("Failed to create run record: %v", err)
+			return
+		}
+		logger.Info.Printf("Created run record ID: %d", run.ID)
+		if err := database.CleanupValidationRuns(cat.ID, cat.ValidationHistoryLimit); err != nil {
+			logger.Error.Printf("Failed to cleanup old validation runs: %v", err)
+		}
 	}
 	var stopped bool
+	catLabel := metrics.CategoryLabel(cat.ID)
 
 	concurrency := cat.ValidationConcurrency
 	if concurrency < 1 {
@@ -179,12 +306,10 @@ func validateCategory(cat database.Category) {
 	}
 
 	var wg sync.WaitGroup
-	var bannedCount int32
-	var usedCount int32
-	var processedCount int32
 	var logMutex sync.Mutex
 	var logBuilder strings.Builder
 	const maxLogSize = 1 << 20 // 1MB
+	logBuilder.WriteString(run.Log)
 	logDirty := false
 
 	appendLog := func(msg string) {
@@ -217,13 +342,76 @@ func validateCategory(cat database.Category) {
 		}
 	}()
 
-	// Split accounts into batches for efficient Python execution
-	batches := splitIntoBatches(accounts, defaultBatchSize)
-	appendLog(fmt.Sprintf("[%s] Starting validation for %d accounts in %d batches (batch size: %d)",
-		time.Now().Format("15:04:05"), len(accounts), len(batches), defaultBatchSize))
+	// Accounts are validated in batches for efficient Python execution
+	batchSize := cat.ValidationBatchSize
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+	// Pages hold whole batches so every batch but the last is full
+	pageSize := max(accountPageSize/batchSize, 1) * batchSize
+	accountTimeout := time.Duration(cat.AccountTimeoutSeconds) * time.Second
+	if resume != nil {
+		var remaining int64
+		inScope().Where("id > ? AND id <= ?", run.Cursor, run.LastAccountID).Count(&remaining)
+		appendLog(fmt.Sprintf("[%s] Resuming after account %d: %d accounts left (batch size: %d)",
+			time.Now().Format("15:04:05"), run.Cursor, remaining, batchSize))
+		if cat.ScriptRevision != run.ScriptRevision {
+			appendLog(fmt.Sprintf("[%s] Validation script changed since the run started; continuing with revision %d",
+				time.Now().Format("15:04:05"), cat.ScriptRevision))
+		}
+	} else {
+		appendLog(fmt.Sprintf("[%s] Starting validation for %d accounts (batch size: %d)",
+			time.Now().Format("15:04:05"), run.TotalCount, batchSize))
+	}
+
+	// Batches finish out of order; the cursor and the counts only move past a
+	// batch once every batch dispatched before it has finished, so a resumed
+	// run neither skips nor double counts accounts. Only batches in flight
+	// are kept.
+	var checkpointMutex sync.Mutex
+	inFlight := map[int]*pendingBatch{}
+	nextBatch := 0
+	dispatched := func(batchIdx int, batch []database.Account) {
+		checkpointMutex.Lock()
+		defer checkpointMutex.Unlock()
+		inFlight[batchIdx] = &pendingBatch{lastID: batch[len(batch)-1].ID, size: len(batch)}
+	}
+	checkpoint := func(batchIdx int, tally batchTally) {
+		checkpointMutex.Lock()
+		defer checkpointMutex.Unlock()
+		// The first call for a batch wins; a panic after the batch's own
+		// checkpoint must not count it again
+		pending, ok := inFlight[batchIdx]
+		if !ok || pending.tally != nil {
+			return
+		}
+		pending.tally = &tally
+		for {
+			b, ok := inFlight[nextBatch]
+			if !ok || b.tally == nil {
+				break
+			}
+			run.Cursor = b.lastID
+			run.ProcessedCount += b.size
+			run.UsedCount += b.tally.used
+			run.BannedCount += b.tally.banned
+			delete(inFlight, nextBatch)
+			nextBatch++
+		}
+		database.DB.Model(&database.ValidationRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+			"cursor":          run.Cursor,
+			"processed_count": run.ProcessedCount,
+			"used_count":      run.UsedCount,
+			"banned_count":    run.BannedCount,
+		})
+	}
 
 	// Create a single shared script file for the entire validation run
-	scriptContent := buildBatchScript(cat.ValidationScript)
+	poolMode := cat.ValidationMode == database.ValidationModePool
+	scriptContent := buildBatchScript(cat.ValidationScript, cat.ValidationAsyncLimit, cat.AccountTimeoutSeconds)
+	if poolMode {
+		scriptContent = buildWorkerScript(cat.ValidationScript, cat.AccountTimeoutSeconds)
+	}
 	scriptFile, err := os.CreateTemp("", "validate-batch-*.py")
 	if err != nil {
 		appendLog(fmt.Sprintf("[%s] ERROR creating script file: %v", time.Now().Format("15:04:05"), err))
@@ -245,157 +433,263 @@ func validateCategory(cat database.Category) {
 		workerSlots <- i
 	}
 
-	for batchIdx, batch := range batches {
-		select {
-		case <-ctx.Done():
-			stopped = true
-			appendLog(fmt.Sprintf("[%s] Validation stopped by user", time.Now().Format("15:04:05")))
-			goto done
-		default:
+	// In pool mode each worker slot keeps a Python process for the whole
+	// run. A slot is only used by the goroutine holding it, and a process
+	// that crashes or times out is replaced on the slot's next account.
+	workers := make([]*pythonWorker, concurrency+1)
+	defer func() {
+		for _, w := range workers {
+			if w != nil {
+				w.stop()
+			}
 		}
-		wg.Add(1)
-		worker := <-workerSlots
-		go func(batch []database.Account, batchIdx, worker int) {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error.Printf("validator worker panic: %v", r)
+	}()
+	workerCommand := []string{"uv", "run", "--isolated", "--no-project", scriptFile.Name()}
+	if useVenv {
+		workerCommand = []string{venvPython, scriptFile.Name()}
+	}
+	validateOnWorker := func(batch []database.Account, batchIdx, worker int) ([]batchResult, bool) {
+		results := make([]batchResult, 0, len(batch))
+		for _, acc := range batch {
+			if workers[worker] == nil {
+				w, err := startPythonWorker(ctx, workerCommand, func(line string) {
+					appendLog(fmt.Sprintf("[%s] [W%d] output: %s", time.Now().Format("15:04:05"), worker, line))
+				})
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, false
+					}
+					metrics.ValidationBatches.WithLabelValues(catLabel, "error").Inc()
+					appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR starting worker - %v",
+						time.Now().Format("15:04:05"), worker, batchIdx+1, err))
+					// Count the batch as processed even on error
+					checkpoint(batchIdx, batchTally{})
+					return nil, false
 				}
-			}()
-			defer func() { workerSlots <- worker }()
-			defer wg.Done()
-
-			// Write batch data to a temp JSON file
-			items := make([]batchInputItem, len(batch))
-			for i, acc := range batch {
-				items[i] = batchInputItem{ID: acc.ID, Data: acc.Data}
+				workers[worker] = w
 			}
-			dataJSON, err := json.Marshal(items)
+			// The script times the account out itself and keeps running; the
+			// grace period only catches calls it cannot interrupt
+			r, err := workers[worker].validate(batchInputItem{ID: acc.ID, Data: acc.Data}, accountTimeout+workerTimeoutGrace)
 			if err != nil {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR marshaling data: %v",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, err))
-				return
-			}
-			dataFile, err := os.CreateTemp("", "validate-data-*.json")
-			if err != nil {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR creating data file: %v",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, err))
-				return
-			}
-			dataFile.Write(dataJSON)
-			dataFile.Close()
-			defer os.Remove(dataFile.Name())
-
-			// Dynamic timeout: base 60s + 2s per account, capped at 300s
-			timeout := time.Duration(60+len(batch)*2) * time.Second
-			if timeout > 300*time.Second {
-				timeout = 300 * time.Second
-			}
-			execCtx, execCancel := context.WithTimeout(ctx, timeout)
-			defer execCancel()
-
-			var cmd *exec.Cmd
-			if useVenv {
-				cmd = exec.CommandContext(execCtx, venvPython, scriptFile.Name(), dataFile.Name())
-			} else {
-				cmd = exec.CommandContext(execCtx, "uv", "run", "--isolated", "--no-project", scriptFile.Name(), dataFile.Name())
-			}
-			output, err := cmd.CombinedOutput()
-			outputStr := strings.TrimSpace(string(output))
-			if err != nil {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR - %s",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, outputStr))
-				// Count the batch as processed even on error
-				newCount := atomic.AddInt32(&processedCount, int32(len(batch)))
-				database.DB.Model(&run).Update("processed_count", int(newCount))
-				return
+				workers[worker].stop()
+				workers[worker] = nil
+				if ctx.Err() != nil {
+					// Killed by a stop; a resumed run validates the batch again
+					return nil, false
+				}
+				appendLog(fmt.Sprintf("[%s] [W%d] Account %d: worker restarted - %v",
+					time.Now().Format("15:04:05"), worker, acc.ID, err))
+				r = batchResult{ID: acc.ID, Error: err.Error()}
 			}
+			results = append(results, r)
+		}
+		return results, true
+	}
 
-			// Parse output: everything before the sentinel is script output,
-			// the content after is JSON results.
-			var results []batchResult
-			scriptOutput, resultJSON, err := splitSentinelOutput(outputStr, batchResultSentinel)
-			if err != nil {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR - no result sentinel found in output: %s",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, outputStr))
-				newCount := atomic.AddInt32(&processedCount, int32(len(batch)))
-				database.DB.Model(&run).Update("processed_count", int(newCount))
-				return
-			}
+	batchIdx := 0
+	afterID := run.Cursor
+	for {
+		var page []database.Account
+		if err := inScope().Where("id > ? AND id <= ?", afterID, run.LastAccountID).
+			Order("id").Limit(pageSize).Find(&page).Error; err != nil {
+			// Stop so the run can be resumed once the database recovers
+			stopped = true
+			appendLog(fmt.Sprintf("[%s] ERROR loading accounts: %v", time.Now().Format("15:04:05"), err))
+			goto done
+		}
+		if len(page) == 0 {
+			break
+		}
+		afterID = page[len(page)-1].ID
 
-			if scriptOutput != "" {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d output: %s",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, scriptOutput))
+		for _, batch := range splitIntoBatches(page, batchSize) {
+			select {
+			case <-ctx.Done():
+				stopped = true
+				// A reached deadline is logged once the run winds down
+				if ctx.Err() != context.DeadlineExceeded {
+					appendLog(fmt.Sprintf("[%s] Validation stopped by user", time.Now().Format("15:04:05")))
+				}
+				goto done
+			default:
 			}
+			wg.Add(1)
+			worker := <-workerSlots
+			dispatched(batchIdx, batch)
+			go func(batch []database.Account, batchIdx, worker int) {
+				defer wg.Done()
+				defer func() { workerSlots <- worker }()
+				// Runs before wg.Done so the checkpoint lands before the run finishes
+				defer func() {
+					if r := recover(); r != nil {
+						logger.Error.Printf("validator worker panic: %v", r)
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR - worker panic: %v",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, r))
+						checkpoint(batchIdx, batchTally{})
+					}
+				}()
+
+				var results []batchResult
+				if poolMode {
+					var ok bool
+					if results, ok = validateOnWorker(batch, batchIdx, worker); !ok {
+						return
+					}
+				} else {
+					// Write batch data to a temp JSON file
+					items := make([]batchInputItem, len(batch))
+					for i, acc := range batch {
+						items[i] = batchInputItem{ID: acc.ID, Data: acc.Data}
+					}
+					dataJSON, err := json.Marshal(items)
+					if err != nil {
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR marshaling data: %v",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, err))
+						checkpoint(batchIdx, batchTally{})
+						return
+					}
+					dataFile, err := os.CreateTemp("", "validate-data-*.json")
+					if err != nil {
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR creating data file: %v",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, err))
+						checkpoint(batchIdx, batchTally{})
+						return
+					}
+					dataFile.Write(dataJSON)
+					dataFile.Close()
+					defer os.Remove(dataFile.Name())
+
+					timeout := batchTimeout(cat, len(batch))
+					execCtx, execCancel := context.WithTimeout(ctx, timeout)
+					defer execCancel()
+
+					var cmd *exec.Cmd
+					if useVenv {
+						cmd = exec.CommandContext(execCtx, venvPython, scriptFile.Name(), dataFile.Name())
+					} else {
+						cmd = exec.CommandContext(execCtx, "uv", "run", "--isolated", "--no-project", scriptFile.Name(), dataFile.Name())
+					}
+					output, err := cmd.CombinedOutput()
+					outputStr := strings.TrimSpace(string(output))
+					if err != nil && ctx.Err() != nil {
+						// Killed by a stop; a resumed run validates the batch again
+						return
+					}
+					if err != nil {
+						outcome := "error"
+						if execCtx.Err() == context.DeadlineExceeded {
+							outcome = "timeout"
+						}
+						metrics.ValidationBatches.WithLabelValues(catLabel, outcome).Inc()
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR - %s",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, outputStr))
+						// Count the batch as processed even on error
+						checkpoint(batchIdx, batchTally{})
+						return
+					}
+
+					// Parse output: everything before the sentinel is script output,
+					// the content after is JSON results.
+					scriptOutput, resultJSON, err := splitSentinelOutput(outputStr, batchResultSentinel)
+					if err != nil {
+						metrics.ValidationBatches.WithLabelValues(catLabel, "invalid_output").Inc()
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR - no result sentinel found in output: %s",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, outputStr))
+						checkpoint(batchIdx, batchTally{})
+						return
+					}
+
+					if scriptOutput != "" {
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d output: %s",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, scriptOutput))
+					}
+
+					if err := json.Unmarshal([]byte(resultJSON), &results); err != nil {
+						metrics.ValidationBatches.WithLabelValues(catLabel, "invalid_output").Inc()
+						appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR parsing results: %v",
+							time.Now().Format("15:04:05"), worker, batchIdx+1, err))
+						checkpoint(batchIdx, batchTally{})
+						return
+					}
+				}
 
-			if err := json.Unmarshal([]byte(resultJSON), &results); err != nil {
-				appendLog(fmt.Sprintf("[%s] [W%d] Batch %d: ERROR parsing results: %v",
-					time.Now().Format("15:04:05"), worker, batchIdx+1, err))
-				newCount := atomic.AddInt32(&processedCount, int32(len(batch)))
-				database.DB.Model(&run).Update("processed_count", int(newCount))
-				return
-			}
+				// Process results: batch DB updates by status group
+				metrics.ValidationBatches.WithLabelValues(catLabel, "ok").Inc()
+				var okIDs, usedIDs, bannedIDs []uint
+				var errorCount int
+				for _, r := range results {
+					if r.Error != "" {
+						errorCount++
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: ERROR - %s",
+							time.Now().Format("15:04:05"), worker, r.ID, r.Error))
+						continue
+					}
+					if r.Banned {
+						bannedIDs = append(bannedIDs, r.ID)
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: BANNED",
+							time.Now().Format("15:04:05"), worker, r.ID))
+					} else if r.Used {
+						usedIDs = append(usedIDs, r.ID)
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: USED",
+							time.Now().Format("15:04:05"), worker, r.ID))
+					} else {
+						okIDs = append(okIDs, r.ID)
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: OK",
+							time.Now().Format("15:04:05"), worker, r.ID))
+					}
+				}
+
+				metrics.ValidationAccounts.WithLabelValues(catLabel, "ok").Add(float64(len(okIDs)))
+				metrics.ValidationAccounts.WithLabelValues(catLabel, "used").Add(float64(len(usedIDs)))
+				metrics.ValidationAccounts.WithLabelValues(catLabel, "banned").Add(float64(len(bannedIDs)))
+				metrics.ValidationAccounts.WithLabelValues(catLabel, "error").Add(float64(errorCount))
 
-			// Process results: batch DB updates by status group
-			var okIDs, usedIDs, bannedIDs []uint
-			for _, r := range results {
-				if r.Error != "" {
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: ERROR - %s",
-						time.Now().Format("15:04:05"), worker, r.ID, r.Error))
-					continue
+				// Batch DB updates — one UPDATE per status group instead of per account
+				// Leased accounts stay checked out; their lease decides when they return
+				source := database.HistorySource{Source: database.HistorySourceValidation, RunID: &run.ID}
+				if len(okIDs) > 0 {
+					database.UpdateTrackedAccounts(database.DB, okIDs, map[string]interface{}{"used": false, "banned": false}, source, "lease_id IS NULL")
 				}
-				if r.Banned {
-					bannedIDs = append(bannedIDs, r.ID)
-					atomic.AddInt32(&bannedCount, 1)
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: BANNED",
-						time.Now().Format("15:04:05"), worker, r.ID))
-				} else if r.Used {
-					usedIDs = append(usedIDs, r.ID)
-					atomic.AddInt32(&usedCount, 1)
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: USED",
-						time.Now().Format("15:04:05"), worker, r.ID))
-				} else {
-					okIDs = append(okIDs, r.ID)
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: OK",
-						time.Now().Format("15:04:05"), worker, r.ID))
+				if len(usedIDs) > 0 {
+					database.UpdateTrackedAccounts(database.DB, usedIDs, map[string]interface{}{"used": true, "banned": false}, source)
 				}
-			}
-
-			// Batch DB updates — one UPDATE per status group instead of per account
-			if len(okIDs) > 0 {
-				database.DB.Model(&database.Account{}).Where("id IN ?", okIDs).
-					Updates(map[string]interface{}{"used": false, "banned": false})
-			}
-			if len(usedIDs) > 0 {
-				database.DB.Model(&database.Account{}).Where("id IN ?", usedIDs).
-					Updates(map[string]interface{}{"used": true, "banned": false})
-			}
-			if len(bannedIDs) > 0 {
-				database.DB.Model(&database.Account{}).Where("id IN ?", bannedIDs).
-					Updates(map[string]interface{}{"used": false, "banned": true})
-			}
-			for _, r := range results {
-				if r.Data == nil {
-					continue
+				if len(bannedIDs) > 0 {
+					database.UpdateTrackedAccounts(database.DB, bannedIDs, map[string]interface{}{"used": false, "banned": true}, source)
+					webhook.Emit(cat.ID, webhook.EventAccountBanned, map[string]interface{}{
+						"source": database.HistorySourceValidation, "run_id": run.ID, "account_ids": bannedIDs,
+					})
 				}
-				var existing database.Account
-				if database.DB.Select("id").Where("category_id = ? AND data = ? AND id != ?", cat.ID, *r.Data, r.ID).First(&existing).Error == nil {
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATE SKIPPED - duplicate data in category",
+				for _, r := range results {
+					if r.Data == nil {
+						continue
+					}
+					var existing database.Account
+					if database.DB.Select("id").Where("category_id = ? AND data_hash = ? AND id != ?", cat.ID, database.HashData(*r.Data), r.ID).First(&existing).Error == nil {
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATE SKIPPED - duplicate data in category",
+							time.Now().Format("15:04:05"), worker, r.ID))
+						continue
+					}
+					dataUpdates, err := database.AccountDataUpdates(&cat, *r.Data)
+					if err != nil {
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATE SKIPPED - %v",
+							time.Now().Format("15:04:05"), worker, r.ID, err))
+						continue
+					}
+					if _, err := database.UpdateTrackedAccounts(database.DB, []uint{r.ID}, dataUpdates, source); err != nil {
+						appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATE ERROR - %v",
+							time.Now().Format("15:04:05"), worker, r.ID, err))
+						continue
+					}
+					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATED",
 						time.Now().Format("15:04:05"), worker, r.ID))
-					continue
-				}
-				if err := database.DB.Model(&database.Account{}).Where("id = ?", r.ID).Update("data", *r.Data).Error; err != nil {
-					appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATE ERROR - %v",
-						time.Now().Format("15:04:05"), worker, r.ID, err))
-					continue
 				}
-				appendLog(fmt.Sprintf("[%s] [W%d] Account %d: DATA UPDATED",
-					time.Now().Format("15:04:05"), worker, r.ID))
-			}
 
-			// Update progress once per batch
-			newCount := atomic.AddInt32(&processedCount, int32(len(batch)))
-			database.DB.Model(&run).Update("processed_count", int(newCount))
-		}(batch, batchIdx, worker)
+				// Update progress once per batch
+				checkpoint(batchIdx, batchTally{used: len(usedIDs), banned: len(bannedIDs)})
+			}(batch, batchIdx, worker)
+			batchIdx++
+		}
 	}
 
 done:
@@ -414,18 +708,24 @@ done:
 	// Also check DB — StopValidation may have set status to "stopping"
 	if !stopped {
 		var currentRun database.ValidationRun
-		if database.DB.Select("status").First(&currentRun, run.ID).Error == nil && currentRun.Status == "stopping" {
+		if database.DB.Select("status").First(&currentRun, run.ID).Error == nil && currentRun.Status == database.RunStatusStopping {
 			stopped = true
 		}
 	}
 
 	now := time.Now()
-	finalStatus := "success"
+	finalStatus := database.RunStatusSuccess
+	errorMessage := ""
+	if ctx.Err() == context.DeadlineExceeded {
+		errorMessage = fmt.Sprintf("run deadline of %d minutes reached", cat.RunDeadlineMinutes)
+		appendLog(fmt.Sprintf("[%s] Run deadline of %d minutes reached", time.Now().Format("15:04:05"), cat.RunDeadlineMinutes))
+	}
 	if stopped {
-		finalStatus = "stopped"
-		appendLog(fmt.Sprintf("[%s] Stopped: %d processed, %d used, %d banned", time.Now().Format("15:04:05"), processedCount, usedCount, bannedCount))
+		finalStatus = database.RunStatusStopped
+		appendLog(fmt.Sprintf("[%s] Stopped: %d processed, %d used, %d banned", time.Now().Format("15:04:05"), run.ProcessedCount, run.UsedCount, run.BannedCount))
 	} else {
-		appendLog(fmt.Sprintf("[%s] Completed: %d total, %d used, %d banned", time.Now().Format("15:04:05"), len(accounts), usedCount, bannedCount))
+		run.Cursor = run.LastAccountID
+		appendLog(fmt.Sprintf("[%s] Completed: %d total, %d used, %d banned", time.Now().Format("15:04:05"), run.TotalCount, run.UsedCount, run.BannedCount))
 	}
 
 	// Final log flush + status update
@@ -434,14 +734,28 @@ done:
 	logMutex.Unlock()
 
 	database.DB.Model(&run).Updates(map[string]interface{}{
-		"status":       finalStatus,
-		"used_count":   int(usedCount),
-		"banned_count": int(bannedCount),
-		"finished_at":  now,
-		"log":          finalLog,
+		"status":          finalStatus,
+		"cursor":          run.Cursor,
+		"processed_count": run.ProcessedCount,
+		"used_count":      run.UsedCount,
+		"banned_count":    run.BannedCount,
+		"error_message":   errorMessage,
+		"finished_at":     now,
+		"log":             finalLog,
 	})
 	database.DB.Model(&cat).Update("last_validated_at", now)
-	logger.Info.Printf("Validated category %s: %d accounts, %d banned", cat.Name, len(accounts), bannedCount)
+	metrics.ValidationRunDuration.WithLabelValues(catLabel, finalStatus).Observe(now.Sub(run.StartedAt).Seconds())
+	logger.Info.Printf("Validated category %s: %d accounts, %d banned", cat.Name, run.TotalCount, run.BannedCount)
+	webhook.Emit(cat.ID, webhook.EventValidationFinished, map[string]interface{}{
+		"run_id":          run.ID,
+		"status":          finalStatus,
+		"total_count":     run.TotalCount,
+		"processed_count": run.ProcessedCount,
+		"used_count":      run.UsedCount,
+		"banned_count":    run.BannedCount,
+		"started_at":      run.StartedAt,
+		"finished_at":     now,
+	})
 }
 
 // buildScopeConditions converts a comma-separated scope string into SQL OR conditions.
@@ -468,17 +782,64 @@ func buildScopeConditions(scope string) string {
 	return strings.Join(conditions, " OR ")
 }
 
+// validationScriptHelpers returns the helpers a validation script can call,
+// and _validate_account_async, which runs an async validate() for one
+// account. Each such account runs in its own task, so its updates are kept
+// in a context variable rather than the module-level dict. Harnesses set
+// _ACCOUNT_TIMEOUT to limit each account; a sync validate() is interrupted
+// with SIGALRM where the platform has it.
 func validationScriptHelpers() string {
 	return `
+import asyncio, contextlib, contextvars, inspect, signal
+
+_ACCOUNT_TIMEOUT = 0
 _UNSET = object()
 _account_updates = {}
+_account_updates_var = contextvars.ContextVar("_account_updates", default=None)
 
 def update_account(*, data=_UNSET):
+    _updates = _account_updates_var.get()
+    if _updates is None:
+        _updates = _account_updates
     if data is not _UNSET:
-        _account_updates["data"] = data
+        _updates["data"] = data
 
 def set_account_data(data):
     update_account(data=data)
+
+def _account_timed_out(*_args):
+    raise TimeoutError("timed out after %ds" % _ACCOUNT_TIMEOUT)
+
+@contextlib.contextmanager
+def _account_deadline():
+    if _ACCOUNT_TIMEOUT <= 0 or not hasattr(signal, "setitimer"):
+        yield
+        return
+    _previous = signal.signal(signal.SIGALRM, _account_timed_out)
+    signal.setitimer(signal.ITIMER_REAL, _ACCOUNT_TIMEOUT)
+    try:
+        yield
+    finally:
+        signal.setitimer(signal.ITIMER_REAL, 0)
+        signal.signal(signal.SIGALRM, _previous)
+
+async def _validate_account_async(_acc):
+    _updates = {}
+    _account_updates_var.set(_updates)
+    try:
+        if _ACCOUNT_TIMEOUT > 0:
+            try:
+                _used, _banned = await asyncio.wait_for(validate(_acc["data"]), _ACCOUNT_TIMEOUT)
+            except asyncio.TimeoutError:
+                _account_timed_out()
+        else:
+            _used, _banned = await validate(_acc["data"])
+        _result = {"id": _acc["id"], "used": bool(_used), "banned": bool(_banned)}
+        if "data" in _updates:
+            _result["data"] = _updates["data"]
+    except Exception as _e:
+        _result = {"id": _acc["id"], "error": str(_e)}
+    return _result
 `
 }
 
@@ -505,7 +866,10 @@ import json
 %s
 
 _account_updates = {}
-_used, _banned = validate(%q)
+if inspect.iscoroutinefunction(validate):
+    _used, _banned = asyncio.run(validate(%q))
+else:
+    _used, _banned = validate(%[3]q)
 _result = {"used": bool(_used), "banned": bool(_banned)}
 if "data" in _account_updates:
     _result["updated_data"] = _account_updates["data"]
@@ -531,7 +895,10 @@ func ParseTestScriptOutput(output []byte) (TestScriptResult, error) {
 // buildBatchScript generates a Python script that calls the user's validate() function
 // for each account in a JSON input file and outputs structured JSON results.
 // The user's validation script is embedded unchanged — only the harness around it changes.
-func buildBatchScript(validationScript string) string {
+// An async validate() checks up to asyncConcurrency accounts of the batch at once.
+// Each account is limited to accountTimeout seconds, so a hung account fails
+// on its own instead of holding the batch until its process is killed.
+func buildBatchScript(validationScript string, asyncConcurrency, accountTimeout int) string {
 	return fmt.Sprintf(`# /// script
 # requires-python = ">=3.11"
 # ///
@@ -541,22 +908,61 @@ import json, sys
 
 %s
 
+_ACCOUNT_TIMEOUT = %d
+
+async def _validate_all_async(_accounts):
+    _limit = asyncio.Semaphore(%d)
+    async def _limited(_acc):
+        async with _limit:
+            return await _validate_account_async(_acc)
+    return await asyncio.gather(*(_limited(_acc) for _acc in _accounts))
+
 with open(sys.argv[1]) as _f:
     _accounts = json.load(_f)
 _results = []
-for _acc in _accounts:
-    try:
-        _account_updates = {}
-        _used, _banned = validate(_acc["data"])
-        _result = {"id": _acc["id"], "used": bool(_used), "banned": bool(_banned)}
-        if "data" in _account_updates:
-            _result["data"] = _account_updates["data"]
-        _results.append(_result)
-    except Exception as _e:
-        _results.append({"id": _acc["id"], "error": str(_e)})
+if inspect.iscoroutinefunction(validate):
+    _results = asyncio.run(_validate_all_async(_accounts))
+else:
+    for _acc in _accounts:
+        try:
+            _account_updates = {}
+            with _account_deadline():
+                _used, _banned = validate(_acc["data"])
+            _result = {"id": _acc["id"], "used": bool(_used), "banned": bool(_banned)}
+            if "data" in _account_updates:
+                _result["data"] = _account_updates["data"]
+            _results.append(_result)
+        except Exception as _e:
+            _results.append({"id": _acc["id"], "error": str(_e)})
 print("%s")
 print(json.dumps(_results))
-`, validationScript, validationScriptHelpers(), batchResultSentinel)
+`, validationScript, validationScriptHelpers(), accountTimeout, max(asyncConcurrency, 1), batchResultSentinel)
+}
+
+// batchTimeout returns how long a batch process of size accounts may run.
+// Without a configured timeout it allows 60s plus 2s per account, capped at
+// 300s, plus one account timeout so a single hung account does not cost the
+// whole batch.
+func batchTimeout(cat database.Category, size int) time.Duration {
+	if cat.BatchTimeoutSeconds > 0 {
+		return time.Duration(cat.BatchTimeoutSeconds) * time.Second
+	}
+	timeout := min(time.Duration(60+size*2)*time.Second, 300*time.Second)
+	return timeout + time.Duration(cat.AccountTimeoutSeconds)*time.Second
+}
+
+// batchTally counts the accounts a finished batch marked used or banned.
+type batchTally struct {
+	used   int
+	banned int
+}
+
+// pendingBatch is a dispatched batch waiting for the batches before it to
+// finish so the run's cursor can move past it; tally is set once it finishes.
+type pendingBatch struct {
+	lastID uint
+	size   int
+	tally  *batchTally
 }
 
 // splitIntoBatches divides a slice of accounts into chunks of the given size.
@@ -597,6 +1003,53 @@ func RunValidationNow(categoryID uint) error {
 	return nil
 }
 
+// ResumeRun continues a stopped or interrupted run after its cursor. Only the
+// latest run of a category can be resumed.
+func ResumeRun(runID uint) error {
+	var run database.ValidationRun
+	if err := database.DB.First(&run, runID).Error; err != nil {
+		return err
+	}
+	if run.Status != database.RunStatusInterrupted && run.Status != database.RunStatusStopped {
+		return fmt.Errorf("only stopped or interrupted runs can be resumed")
+	}
+	var latest database.ValidationRun
+	if err := database.DB.Select("id").Where("category_id = ?", run.CategoryID).Order("id DESC").First(&latest).Error; err != nil {
+		return err
+	}
+	if latest.ID != run.ID {
+		return fmt.Errorf("a newer run exists for this category")
+	}
+	var cat database.Category
+	if err := database.DB.First(&cat, run.CategoryID).Error; err != nil {
+		return err
+	}
+	if cat.ValidationScript == "" {
+		return fmt.Errorf("no validation script")
+	}
+	runningMutex.Lock()
+	if _, running := runningValidations[cat.ID]; running {
+		runningMutex.Unlock()
+		return fmt.Errorf("validation already running")
+	}
+	runningMutex.Unlock()
+	go runValidation(cat, &run)
+	return nil
+}
+
+// ResumeInterruptedRuns resumes the runs a restart interrupted.
+func ResumeInterruptedRuns() {
+	var runs []database.ValidationRun
+	database.DB.Select("id").Where("status = ?", database.RunStatusInterrupted).Order("id").Find(&runs)
+	for _, run := range runs {
+		if err := ResumeRun(run.ID); err != nil {
+			logger.Error.Printf("Failed to resume validation run %d: %v", run.ID, err)
+			continue
+		}
+		logger.Info.Printf("Resuming interrupted validation run %d", run.ID)
+	}
+}
+
 func StopValidation(categoryID uint) bool {
 	runningMutex.Lock()
 	defer runningMutex.Unlock()
@@ -604,23 +1057,37 @@ func StopValidation(categoryID uint) bool {
 		cancel()
 		// Immediately mark the DB record as "stopping" so the UI reflects it
 		database.DB.Model(&database.ValidationRun{}).
-			Where("category_id = ? AND status = ?", categoryID, "running").
-			Update("status", "stopping")
+			Where("category_id = ? AND status = ?", categoryID, database.RunStatusRunning).
+			Update("status", database.RunStatusStopping)
 		return true
 	}
 	return false
 }
 
 func StopScheduler() {
+	jobsMutex.Lock()
+	schedulerRunning = false
+	jobsMutex.Unlock()
 	if cronScheduler != nil {
 		cronScheduler.Stop()
 	}
 }
 
+// SchedulerRunning reports whether StartScheduler has run and the scheduler
+// has not been stopped since.
+func SchedulerRunning() bool {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return schedulerRunning
+}
+
 // InitSchedulerForTest initializes the cron scheduler without starting
 // background snapshot jobs. Use in tests where handlers call
 // ReloadJobForCategory and the scheduler must be non-nil.
 func InitSchedulerForTest() {
 	cronScheduler = cron.New()
 	cronScheduler.Start()
+	jobsMutex.Lock()
+	schedulerRunning = true
+	jobsMutex.Unlock()
 }
@@ -1,8 +1,14 @@
 package validator
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"final-account-hub/database"
 	"final-account-hub/testutil"
@@ -116,6 +122,195 @@ func TestRunValidationNow_NoScript(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// ResumeRun
+// ---------------------------------------------------------------------------
+
+func TestResumeRun_OnlyStoppedOrInterrupted(t *testing.T) {
+	testutil.SetupTestDB(t)
+
+	cat := testutil.SeedCategory(t, "finished-cat")
+	run := testutil.SeedValidationRun(t, cat.ID, database.RunStatusSuccess)
+
+	err := ResumeRun(run.ID)
+	if err == nil || err.Error() != "only stopped or interrupted runs can be resumed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestResumeRun_OnlyLatestRun(t *testing.T) {
+	testutil.SetupTestDB(t)
+
+	cat := testutil.SeedCategory(t, "superseded-cat")
+	old := testutil.SeedValidationRun(t, cat.ID, database.RunStatusInterrupted)
+	testutil.SeedValidationRun(t, cat.ID, database.RunStatusSuccess)
+
+	err := ResumeRun(old.ID)
+	if err == nil || err.Error() != "a newer run exists for this category" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestResumeRun_NoScript(t *testing.T) {
+	testutil.SetupTestDB(t)
+
+	cat := testutil.SeedCategory(t, "scriptless-cat")
+	run := testutil.SeedValidationRun(t, cat.ID, database.RunStatusStopped)
+
+	err := ResumeRun(run.ID)
+	if err == nil || err.Error() != "no validation script" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestResumeInterruptedRuns_SkipsUnresumable(t *testing.T) {
+	testutil.SetupTestDB(t)
+
+	cat := testutil.SeedCategory(t, "boot-cat")
+	run := testutil.SeedValidationRun(t, cat.ID, database.RunStatusInterrupted)
+
+	// Without a script the run cannot resume and stays interrupted
+	ResumeInterruptedRuns()
+
+	var got database.ValidationRun
+	database.DB.First(&got, run.ID)
+	if got.Status != database.RunStatusInterrupted || got.ResumeCount != 0 {
+		t.Errorf("expected run left interrupted, got %s (resumed %d times)", got.Status, got.ResumeCount)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// runValidation
+// ---------------------------------------------------------------------------
+
+// useSystemPython points the category's venv interpreter at the python3 on
+// PATH, from a temporary working directory.
+func useSystemPython(t *testing.T, categoryID uint) {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+	t.Chdir(t.TempDir())
+	venvBin := filepath.Join("data", "venvs", fmt.Sprint(categoryID), "bin")
+	if err := os.MkdirAll(venvBin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(python, filepath.Join(venvBin, "python")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunValidation_PagesThroughWholeScope(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+
+	cat := testutil.SeedCategory(t, "large-cat")
+	database.DB.Model(&cat).Updates(map[string]interface{}{
+		"validation_script":      "def validate(data): return (False, data.startswith('ban'))",
+		"validation_concurrency": 4,
+		"validation_batch_size":  200,
+	})
+	database.DB.First(&cat, cat.ID)
+	useSystemPython(t, cat.ID)
+
+	total := accountPageSize + 30
+	accounts := make([]database.Account, total)
+	for i := range accounts {
+		data := fmt.Sprintf("user%d", i)
+		if i%100 == 0 {
+			data = fmt.Sprintf("ban%d", i)
+		}
+		accounts[i] = database.Account{CategoryID: cat.ID, Data: data, DataHash: database.HashData(data)}
+	}
+	if err := database.DB.CreateInBatches(accounts, 500).Error; err != nil {
+		t.Fatalf("failed to seed accounts: %v", err)
+	}
+
+	runValidation(cat, nil)
+
+	var run database.ValidationRun
+	database.DB.Where("category_id = ?", cat.ID).First(&run)
+	if run.Status != database.RunStatusSuccess {
+		t.Fatalf("expected success, got %s: %s", run.Status, run.Log)
+	}
+	if run.TotalCount != total || run.ProcessedCount != total {
+		t.Errorf("expected %d total and processed, got %d and %d", total, run.TotalCount, run.ProcessedCount)
+	}
+	if run.BannedCount != total/100+1 {
+		t.Errorf("expected %d banned, got %d", total/100+1, run.BannedCount)
+	}
+	if run.Cursor != accounts[total-1].ID || run.LastAccountID != accounts[total-1].ID {
+		t.Errorf("expected cursor at the last account %d, got %d (last %d)", accounts[total-1].ID, run.Cursor, run.LastAccountID)
+	}
+}
+
+func TestRunValidation_ResumeContinuesAfterCursor(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+
+	cat := testutil.SeedCategory(t, "resume-cat")
+	database.DB.Model(&cat).Update("validation_script", "def validate(data): return (False, True)")
+	database.DB.First(&cat, cat.ID)
+	useSystemPython(t, cat.ID)
+
+	var accounts []database.Account
+	for i := range 120 {
+		accounts = append(accounts, testutil.SeedAccount(t, cat.ID, fmt.Sprintf("acc%d", i)))
+	}
+	cursor := accounts[59].ID
+	run := database.ValidationRun{
+		CategoryID:     cat.ID,
+		Status:         database.RunStatusInterrupted,
+		TotalCount:     120,
+		ProcessedCount: 60,
+		Cursor:         cursor,
+		LastAccountID:  accounts[99].ID,
+		StartedAt:      database.DB.NowFunc(),
+	}
+	database.DB.Create(&run)
+
+	runValidation(cat, &run)
+
+	database.DB.First(&run, run.ID)
+	if run.Status != database.RunStatusSuccess || run.ResumeCount != 1 {
+		t.Fatalf("expected success after one resume, got %s (resumed %d times)", run.Status, run.ResumeCount)
+	}
+	if run.ProcessedCount != 100 || run.BannedCount != 40 {
+		t.Errorf("expected 100 processed and 40 banned, got %d and %d", run.ProcessedCount, run.BannedCount)
+	}
+	var banned []database.Account
+	database.DB.Where("banned = ?", true).Order("id").Find(&banned)
+	if len(banned) != 40 || banned[0].ID != accounts[60].ID || banned[39].ID != accounts[99].ID {
+		t.Errorf("expected only accounts after the cursor up to the last account banned, got %d", len(banned))
+	}
+}
+
+func TestRunValidation_BatchSize(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+
+	cat := testutil.SeedCategory(t, "batch-size-cat")
+	database.DB.Model(&cat).Updates(map[string]interface{}{
+		"validation_script":     "print('loaded')\ndef validate(data): return (False, False)",
+		"validation_batch_size": 7,
+	})
+	database.DB.First(&cat, cat.ID)
+	useSystemPython(t, cat.ID)
+	for i := range 30 {
+		testutil.SeedAccount(t, cat.ID, fmt.Sprintf("acc%d", i))
+	}
+
+	runValidation(cat, nil)
+
+	var run database.ValidationRun
+	database.DB.Where("category_id = ?", cat.ID).First(&run)
+	if run.Status != database.RunStatusSuccess || run.ProcessedCount != 30 {
+		t.Fatalf("unexpected run %s with %d processed:\n%s", run.Status, run.ProcessedCount, run.Log)
+	}
+	// Each batch process prints once when it loads the script
+	if !strings.Contains(run.Log, "batch size: 7") || strings.Count(run.Log, "output: loaded") != 5 {
+		t.Errorf("expected 5 batches of up to 7 accounts, got\n%s", run.Log)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // splitIntoBatches (pure function)
 // ---------------------------------------------------------------------------
@@ -184,7 +379,7 @@ func TestSplitIntoBatches_ZeroSize(t *testing.T) {
 
 func TestBuildBatchScript_ContainsUserScript(t *testing.T) {
 	userScript := "def validate(data):\n    return (False, False)"
-	script := buildBatchScript(userScript)
+	script := buildBatchScript(userScript, 10, 60)
 
 	if !strings.Contains(script, userScript) {
 		t.Error("batch script should contain the user's validation script verbatim")
@@ -192,7 +387,7 @@ func TestBuildBatchScript_ContainsUserScript(t *testing.T) {
 }
 
 func TestBuildBatchScript_ContainsBatchHarness(t *testing.T) {
-	script := buildBatchScript("def validate(data): return (False, False)")
+	script := buildBatchScript("def validate(data): return (False, False)", 10, 60)
 
 	checks := []string{
 		"import json, sys",
@@ -210,7 +405,7 @@ func TestBuildBatchScript_ContainsBatchHarness(t *testing.T) {
 }
 
 func TestBuildBatchScript_ErrorHandling(t *testing.T) {
-	script := buildBatchScript("def validate(data): return (False, False)")
+	script := buildBatchScript("def validate(data): return (False, False)", 10, 60)
 
 	if !strings.Contains(script, "except Exception as _e") {
 		t.Error("batch script should include per-account error handling")
@@ -221,7 +416,7 @@ func TestBuildBatchScript_ErrorHandling(t *testing.T) {
 }
 
 func TestBuildBatchScript_ContainsUpdateAccountHelper(t *testing.T) {
-	script := buildBatchScript("def validate(data): return (False, False)")
+	script := buildBatchScript("def validate(data): return (False, False)", 10, 60)
 
 	checks := []string{
 		"def update_account(*, data=_UNSET):",
@@ -235,6 +430,171 @@ func TestBuildBatchScript_ContainsUpdateAccountHelper(t *testing.T) {
 	}
 }
 
+// runBatchScript runs the batch harness for script on the python3 on PATH.
+func runBatchScript(t *testing.T, script string, asyncLimit, accountTimeout int, items []batchInputItem) []batchResult {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "batch.py")
+	dataPath := filepath.Join(dir, "data.json")
+	data, _ := json.Marshal(items)
+	os.WriteFile(scriptPath, []byte(buildBatchScript(script, asyncLimit, accountTimeout)), 0644)
+	os.WriteFile(dataPath, data, 0644)
+
+	output, err := exec.Command(python, scriptPath, dataPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("batch script failed: %v\n%s", err, output)
+	}
+	_, resultJSON, err := splitSentinelOutput(string(output), batchResultSentinel)
+	if err != nil {
+		t.Fatalf("no results in output: %s", output)
+	}
+	var results []batchResult
+	if err := json.Unmarshal([]byte(resultJSON), &results); err != nil {
+		t.Fatalf("invalid results: %v", err)
+	}
+	return results
+}
+
+func TestBuildBatchScript_AsyncValidateRunsConcurrently(t *testing.T) {
+	script := `
+async def validate(data):
+    await asyncio.sleep(0.3)
+    if data.startswith("fail"):
+        raise ValueError("bad " + data)
+    update_account(data=data + "!")
+    return (False, data.startswith("ban"))
+`
+	items := make([]batchInputItem, 20)
+	for i := range items {
+		items[i] = batchInputItem{ID: uint(i + 1), Data: fmt.Sprintf("user%d", i)}
+	}
+	items[3].Data = "ban3"
+	items[7].Data = "fail7"
+
+	start := time.Now()
+	results := runBatchScript(t, script, 20, 60, items)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected accounts checked concurrently, took %s", elapsed)
+	}
+
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, r := range results {
+		if r.ID != items[i].ID {
+			t.Fatalf("expected results in input order, got %d at %d", r.ID, i)
+		}
+		switch i {
+		case 7:
+			if r.Error != "bad fail7" {
+				t.Errorf("expected the error of account 8, got %+v", r)
+			}
+		default:
+			// Each task keeps its own update despite running interleaved
+			if r.Data == nil || *r.Data != items[i].Data+"!" || r.Banned != (i == 3) {
+				t.Errorf("unexpected result for %q: %+v", items[i].Data, r)
+			}
+		}
+	}
+}
+
+func TestBuildBatchScript_AsyncLimit(t *testing.T) {
+	script := `
+_running = 0
+_peak = 0
+async def validate(data):
+    global _running, _peak
+    _running += 1
+    _peak = max(_peak, _running)
+    await asyncio.sleep(0.05)
+    _running -= 1
+    update_account(data=str(_peak))
+    return (False, False)
+`
+	items := make([]batchInputItem, 12)
+	for i := range items {
+		items[i] = batchInputItem{ID: uint(i + 1), Data: "x"}
+	}
+
+	results := runBatchScript(t, script, 3, 60, items)
+	last := results[len(results)-1]
+	if last.Data == nil || *last.Data != "3" {
+		t.Errorf("expected at most 3 accounts at once, got peak %v", last.Data)
+	}
+}
+
+func TestBuildBatchScript_AccountTimeout(t *testing.T) {
+	for name, script := range map[string]string{
+		"sync": `
+import time
+def validate(data):
+    if data == "hang":
+        time.sleep(30)
+    return (False, False)
+`,
+		"async": `
+async def validate(data):
+    if data == "hang":
+        await asyncio.sleep(30)
+    return (False, False)
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			items := []batchInputItem{{ID: 1, Data: "a"}, {ID: 2, Data: "hang"}, {ID: 3, Data: "b"}}
+			start := time.Now()
+			results := runBatchScript(t, script, 10, 1, items)
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("expected the hung account cut off, took %s", elapsed)
+			}
+			if len(results) != 3 || results[1].Error != "timed out after 1s" || results[0].Error != "" || results[2].Error != "" {
+				t.Errorf("expected only the hung account to fail, got %+v", results)
+			}
+		})
+	}
+}
+
+func TestBatchTimeout(t *testing.T) {
+	cat := database.Category{AccountTimeoutSeconds: 60}
+	if got := batchTimeout(cat, 10); got != 140*time.Second {
+		t.Errorf("expected 80s for 10 accounts plus one account timeout, got %s", got)
+	}
+	if got := batchTimeout(cat, 500); got != 360*time.Second {
+		t.Errorf("expected the derived timeout capped at 300s plus one account timeout, got %s", got)
+	}
+	cat.BatchTimeoutSeconds = 45
+	if got := batchTimeout(cat, 500); got != 45*time.Second {
+		t.Errorf("expected the configured 45s, got %s", got)
+	}
+}
+
+func TestBuildTestScript_AsyncValidate(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+	path := filepath.Join(t.TempDir(), "test.py")
+	script := `
+async def validate(data):
+    await asyncio.sleep(0)
+    update_account(data=data.upper())
+    return (True, False)
+`
+	os.WriteFile(path, []byte(BuildTestScript(script, "abc")), 0644)
+
+	output, err := exec.Command(python, path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("test script failed: %v\n%s", err, output)
+	}
+	result, err := ParseTestScriptOutput(output)
+	if err != nil || !result.Used || result.UpdatedData == nil || *result.UpdatedData != "ABC" {
+		t.Errorf("unexpected result %+v err=%v", result, err)
+	}
+}
+
 func TestBuildTestScript_ContainsUpdateAccountHelper(t *testing.T) {
 	script := BuildTestScript("def validate(data): return (False, False)", "hello")
 
@@ -271,3 +631,25 @@ func TestParseTestScriptOutput_MissingSentinel(t *testing.T) {
 		t.Fatal("expected parse to fail when sentinel is missing")
 	}
 }
+
+func TestScheduledJobs_NamesValidationJobs(t *testing.T) {
+	testutil.SetupTestDB(t)
+	InitSchedulerForTest()
+	t.Cleanup(StopScheduler)
+
+	cat := testutil.SeedCategory(t, "scheduled")
+	database.DB.Model(&cat).Updates(map[string]interface{}{
+		"validation_script":  "def validate(account): return True",
+		"validation_cron":    "0 3 * * *",
+		"validation_enabled": true,
+	})
+	ReloadJobForCategory(cat.ID)
+
+	jobs := ScheduledJobs()
+	if len(jobs) != 1 || jobs[0].Name != fmt.Sprintf("validation:%d", cat.ID) {
+		t.Fatalf("expected the category validation job, got %+v", jobs)
+	}
+	if jobs[0].Next.Hour() != 3 {
+		t.Errorf("expected next run at 03:00, got %v", jobs[0].Next)
+	}
+}
@@ -0,0 +1,188 @@
+package validator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+const workerReadySentinel = "---WORKER_READY---"
+
+// workerStartTimeout bounds how long a worker may take to load the script,
+// including uv resolving its dependencies.
+const workerStartTimeout = 2 * time.Minute
+
+// workerTimeoutGrace is how long past the account timeout a worker may take
+// before it is killed, for calls the script's own timeout cannot interrupt.
+const workerTimeoutGrace = 5 * time.Second
+
+// maxWorkerLine is the longest result line a worker may write.
+const maxWorkerLine = 16 << 20
+
+var errWorkerExited = errors.New("worker exited")
+
+// pythonWorker is a Python process that loads the validation script once
+// and validates accounts sent to it one JSON line at a time. Lines the
+// script prints go to stderr and are handed to the output callback.
+type pythonWorker struct {
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	results    chan string
+	outputDone chan struct{}
+}
+
+// startPythonWorker runs the worker script with command and waits for it to
+// load. The process is killed when ctx is cancelled.
+func startPythonWorker(ctx context.Context, command []string, onOutput func(string)) (*pythonWorker, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.WaitDelay = time.Second
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	w := &pythonWorker{cmd: cmd, stdin: stdin, results: make(chan string, 1), outputDone: make(chan struct{})}
+	go func() {
+		defer close(w.outputDone)
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64*1024), maxWorkerLine)
+		for scanner.Scan() {
+			onOutput(scanner.Text())
+		}
+	}()
+	go func() {
+		defer close(w.results)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxWorkerLine)
+		for scanner.Scan() {
+			w.results <- scanner.Text()
+		}
+	}()
+
+	timer := time.NewTimer(workerStartTimeout)
+	defer timer.Stop()
+	select {
+	case line, ok := <-w.results:
+		if !ok || line != workerReadySentinel {
+			w.stop()
+			return nil, fmt.Errorf("worker exited while loading the script")
+		}
+	case <-timer.C:
+		w.stop()
+		return nil, fmt.Errorf("worker did not start within %s", workerStartTimeout)
+	}
+	return w, nil
+}
+
+// validate sends one account to the worker and waits up to timeout for its
+// result. After an error the worker must be stopped and replaced.
+func (w *pythonWorker) validate(item batchInputItem, timeout time.Duration) (batchResult, error) {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return batchResult{}, err
+	}
+	if _, err := w.stdin.Write(append(line, '\n')); err != nil {
+		return batchResult{}, errWorkerExited
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case out, ok := <-w.results:
+		if !ok {
+			return batchResult{}, errWorkerExited
+		}
+		var r batchResult
+		if err := json.Unmarshal([]byte(out), &r); err != nil || r.ID != item.ID {
+			return batchResult{}, fmt.Errorf("invalid worker output: %s", out)
+		}
+		return r, nil
+	case <-timer.C:
+		return batchResult{}, fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// stop ends the worker process and waits for it to exit.
+func (w *pythonWorker) stop() {
+	w.stdin.Close()
+	if w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+	}
+	// Let the last output, such as a traceback, reach the log; a child
+	// process still holding stderr must not block the stop
+	select {
+	case <-w.outputDone:
+	case <-time.After(time.Second):
+	}
+	w.cmd.Wait()
+	// Unblock the stdout reader if it holds an unread line
+	go func() {
+		for range w.results {
+		}
+	}()
+}
+
+// buildWorkerScript wraps the user's validation script in a loop that reads
+// accounts as JSON lines from stdin and writes one result line per account.
+// The script's own prints go to stderr so they cannot corrupt the results.
+// An async validate() runs on one event loop kept for the worker's lifetime,
+// so clients the script creates on it can be reused across accounts. Each
+// account is limited to accountTimeout seconds.
+func buildWorkerScript(validationScript string, accountTimeout int) string {
+	return fmt.Sprintf(`# /// script
+# requires-python = ">=3.11"
+# ///
+import json, sys
+
+_results_out = sys.stdout
+sys.stdout = sys.stderr
+
+%s
+
+%s
+
+_ACCOUNT_TIMEOUT = %d
+
+def _send(_line):
+    _results_out.write(_line + "\n")
+    _results_out.flush()
+
+_loop = asyncio.new_event_loop() if inspect.iscoroutinefunction(validate) else None
+
+_send("%s")
+for _line in sys.stdin:
+    _acc = json.loads(_line)
+    if _loop is not None:
+        _result = _loop.run_until_complete(_validate_account_async(_acc))
+        sys.stdout.flush()
+        _send(json.dumps(_result))
+        continue
+    try:
+        _account_updates = {}
+        with _account_deadline():
+            _used, _banned = validate(_acc["data"])
+        _result = {"id": _acc["id"], "used": bool(_used), "banned": bool(_banned)}
+        if "data" in _account_updates:
+            _result["data"] = _account_updates["data"]
+    except Exception as _e:
+        _result = {"id": _acc["id"], "error": str(_e)}
+    sys.stdout.flush()
+    _send(json.dumps(_result))
+`, validationScript, validationScriptHelpers(), accountTimeout, workerReadySentinel)
+}
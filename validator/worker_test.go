@@ -0,0 +1,244 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+// startTestWorker starts a worker for script on the python3 on PATH and
+// collects the lines it prints.
+func startTestWorker(t *testing.T, script string, accountTimeout int) (*pythonWorker, func() []string, error) {
+	t.Helper()
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+	path := filepath.Join(t.TempDir(), "worker.py")
+	if err := os.WriteFile(path, []byte(buildWorkerScript(script, accountTimeout)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var output []string
+	w, err := startPythonWorker(context.Background(), []string{python, path}, func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		output = append(output, line)
+	})
+	if w != nil {
+		t.Cleanup(w.stop)
+	}
+	return w, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), output...)
+	}, err
+}
+
+func TestPythonWorker_ValidatesAccounts(t *testing.T) {
+	w, output, err := startTestWorker(t, `
+print("loaded")
+def validate(data):
+    print("checking", data)
+    if data == "rename":
+        update_account(data="renamed")
+    return (data == "used", data == "banned")
+`, 60)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	for i, data := range []string{"ok", "used", "banned", "rename"} {
+		r, err := w.validate(batchInputItem{ID: uint(i + 1), Data: data}, 5*time.Second)
+		if err != nil {
+			t.Fatalf("validate %q failed: %v", data, err)
+		}
+		if r.ID != uint(i+1) || r.Used != (data == "used") || r.Banned != (data == "banned") {
+			t.Errorf("unexpected result for %q: %+v", data, r)
+		}
+		if data == "rename" && (r.Data == nil || *r.Data != "renamed") {
+			t.Errorf("expected updated data, got %v", r.Data)
+		}
+		if data == "ok" && r.Data != nil {
+			t.Errorf("expected no data update, got %q", *r.Data)
+		}
+	}
+
+	// Prints go to the output callback, not the result stream
+	deadline := time.Now().Add(2 * time.Second)
+	for len(output()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lines := output()
+	if len(lines) != 5 || lines[0] != "loaded" || lines[4] != "checking rename" {
+		t.Errorf("unexpected script output %q", lines)
+	}
+}
+
+func TestPythonWorker_AsyncValidate(t *testing.T) {
+	w, _, err := startTestWorker(t, `
+_client = None
+async def validate(data):
+    global _client
+    # The loop lives as long as the worker, so state bound to it is reusable
+    if _client is None:
+        _client = asyncio.get_running_loop()
+    elif _client is not asyncio.get_running_loop():
+        raise RuntimeError("loop changed")
+    await asyncio.sleep(0)
+    update_account(data=data + "!")
+    return (False, data == "banned")
+`, 60)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	for i, data := range []string{"ok", "banned", "again"} {
+		r, err := w.validate(batchInputItem{ID: uint(i + 1), Data: data}, 5*time.Second)
+		if err != nil || r.Error != "" {
+			t.Fatalf("validate %q failed: %+v err=%v", data, r, err)
+		}
+		if r.Banned != (data == "banned") || r.Data == nil || *r.Data != data+"!" {
+			t.Errorf("unexpected result for %q: %+v", data, r)
+		}
+	}
+}
+
+func TestPythonWorker_ScriptErrorPerAccount(t *testing.T) {
+	w, _, err := startTestWorker(t, `
+def validate(data):
+    raise ValueError("bad " + data)
+`, 60)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	r, err := w.validate(batchInputItem{ID: 7, Data: "x"}, 5*time.Second)
+	if err != nil || r.Error != "bad x" {
+		t.Errorf("expected the script error in the result, got %+v err=%v", r, err)
+	}
+}
+
+func TestPythonWorker_Timeout(t *testing.T) {
+	w, _, err := startTestWorker(t, `
+import time
+def validate(data):
+    time.sleep(10)
+    return (False, False)
+`, 60)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	_, err = w.validate(batchInputItem{ID: 1, Data: "slow"}, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestPythonWorker_AccountTimeoutKeepsWorker(t *testing.T) {
+	w, _, err := startTestWorker(t, `
+import time
+def validate(data):
+    if data == "hang":
+        time.sleep(30)
+    return (False, False)
+`, 1)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	r, err := w.validate(batchInputItem{ID: 1, Data: "hang"}, 1*time.Second+workerTimeoutGrace)
+	if err != nil || r.Error != "timed out after 1s" {
+		t.Fatalf("expected the script to time the account out, got %+v err=%v", r, err)
+	}
+	// The same process goes on with the next account
+	r, err = w.validate(batchInputItem{ID: 2, Data: "ok"}, 5*time.Second)
+	if err != nil || r.Error != "" {
+		t.Errorf("expected the worker to keep running, got %+v err=%v", r, err)
+	}
+}
+
+func TestPythonWorker_Crash(t *testing.T) {
+	w, _, err := startTestWorker(t, `
+import os
+def validate(data):
+    os._exit(3)
+`, 60)
+	if err != nil {
+		t.Fatalf("worker failed to start: %v", err)
+	}
+
+	_, err = w.validate(batchInputItem{ID: 1, Data: "boom"}, 5*time.Second)
+	if !errors.Is(err, errWorkerExited) {
+		t.Errorf("expected errWorkerExited, got %v", err)
+	}
+}
+
+func TestPythonWorker_ScriptFailsToLoad(t *testing.T) {
+	_, output, err := startTestWorker(t, "def validate(data) return", 60)
+	if err == nil {
+		t.Fatal("expected a start error for a script with a syntax error")
+	}
+	if !strings.Contains(strings.Join(output(), "\n"), "SyntaxError") {
+		t.Errorf("expected the traceback in the output, got %q", output())
+	}
+}
+
+func TestBuildWorkerScript_ContainsUserScript(t *testing.T) {
+	script := buildWorkerScript("def validate(data): return (False, False)", 60)
+	for _, want := range []string{"def validate(data): return (False, False)", "def update_account(", workerReadySentinel, "sys.stdout = sys.stderr"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("worker script is missing %q", want)
+		}
+	}
+}
+
+func TestRunValidation_PoolModeRestartsCrashedWorker(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+
+	cat := testutil.SeedCategory(t, "pool-cat")
+	database.DB.Model(&cat).Updates(map[string]interface{}{
+		"validation_mode":        database.ValidationModePool,
+		"validation_concurrency": 2,
+		"validation_script": `import os
+def validate(data):
+    if data == "crash":
+        os._exit(1)
+    return (False, data.startswith("ban"))`,
+	})
+	database.DB.First(&cat, cat.ID)
+	useSystemPython(t, cat.ID)
+
+	for i := range 120 {
+		data := fmt.Sprintf("user%d", i)
+		switch i {
+		case 10:
+			data = "crash"
+		case 11, 70:
+			data = fmt.Sprintf("ban%d", i)
+		}
+		testutil.SeedAccount(t, cat.ID, data)
+	}
+
+	runValidation(cat, nil)
+
+	var run database.ValidationRun
+	database.DB.Where("category_id = ?", cat.ID).First(&run)
+	if run.Status != database.RunStatusSuccess || run.ProcessedCount != 120 || run.BannedCount != 2 {
+		t.Fatalf("unexpected run %s: %d processed, %d banned\n%s", run.Status, run.ProcessedCount, run.BannedCount, run.Log)
+	}
+	if !strings.Contains(run.Log, "worker restarted") {
+		t.Errorf("expected the crash in the log, got\n%s", run.Log)
+	}
+}
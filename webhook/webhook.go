@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/logger"
+)
+
+// Event types a subscription can receive.
+const (
+	EventValidationFinished = "validation_run.finished"
+	EventLowWatermark       = "pool.low_watermark"
+	EventAccountBanned      = "account.banned"
+	EventAccountsImported   = "accounts.imported"
+)
+
+// Events lists every supported event type.
+var Events = []string{EventValidationFinished, EventLowWatermark, EventAccountBanned, EventAccountsImported}
+
+// SignatureHeader carries "sha256=<hex HMAC-SHA256 of the body keyed with the secret>".
+const SignatureHeader = "X-Webhook-Signature-256"
+
+// MaxAttempts is how many times a delivery is tried before it is marked failed.
+const MaxAttempts = 6
+
+// claimDuration keeps RetryDue away from a delivery while it is being sent.
+const claimDuration = time.Minute
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+func init() {
+	database.OnAlert(notifyAlert)
+}
+
+// Backoff returns the wait before retrying after the given number of failed
+// attempts: 30s, 1m, 2m, 4m, 8m.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return 30 * time.Second << (attempts - 1)
+}
+
+// Sign computes the signature header value for a payload.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribes reports whether the webhook wants the event.
+func Subscribes(hook *database.Webhook, event string) bool {
+	for _, e := range strings.Split(hook.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribers returns enabled webhooks for the category (including global
+// ones) that want the event.
+func subscribers(categoryID uint, event string) []database.Webhook {
+	var hooks []database.Webhook
+	if err := database.DB.Where("category_id IN ? AND enabled = ?", []uint{categoryID, 0}, true).Find(&hooks).Error; err != nil {
+		logger.Error.Printf("Failed to load webhooks: %v", err)
+		return nil
+	}
+	var out []database.Webhook
+	for _, h := range hooks {
+		if Subscribes(&h, event) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// Emit queues the event for every matching subscription and sends it in the
+// background. Failed sends are retried by RetryDue.
+func Emit(categoryID uint, event string, data interface{}) {
+	send(subscribers(categoryID, event), categoryID, event, data)
+}
+
+// notifyAlert emits pool.low_watermark when a category's stock alert drops
+// to low or empty, so the event uses the category's low watermark.
+func notifyAlert(alert database.Alert) {
+	if alert.State == database.AlertOK {
+		return
+	}
+	Emit(alert.CategoryID, EventLowWatermark, map[string]interface{}{
+		"available":     alert.Available,
+		"low_watermark": alert.LowWatermark,
+		"state":         alert.State,
+		"from_state":    alert.FromState,
+	})
+}
+
+func send(hooks []database.Webhook, categoryID uint, event string, data interface{}) {
+	now := time.Now()
+	for i := range hooks {
+		delivery := database.WebhookDelivery{WebhookID: hooks[i].ID, Event: event, Status: "pending"}
+		claimedUntil := now.Add(claimDuration)
+		delivery.NextAttemptAt = &claimedUntil
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			logger.Error.Printf("Failed to record webhook delivery: %v", err)
+			continue
+		}
+		payload, _ := json.Marshal(map[string]interface{}{
+			"id":          delivery.ID,
+			"event":       event,
+			"category_id": categoryID,
+			"created_at":  now,
+			"data":        data,
+		})
+		delivery.Payload = string(payload)
+		database.DB.Model(&delivery).Update("payload", delivery.Payload)
+		go attempt(hooks[i], delivery)
+	}
+}
+
+// attempt sends one delivery and records the outcome.
+func attempt(hook database.Webhook, delivery database.WebhookDelivery) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error.Printf("webhook delivery panic: %v", r)
+		}
+	}()
+
+	code, err := post(hook, delivery)
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts, "response_code": code}
+	switch {
+	case err == nil:
+		updates["status"] = "success"
+		updates["error"] = ""
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case attempts >= MaxAttempts:
+		updates["status"] = "failed"
+		updates["error"] = err.Error()
+		updates["next_attempt_at"] = nil
+		logger.Error.Printf("Webhook %d delivery %d failed after %d attempts: %v", hook.ID, delivery.ID, attempts, err)
+	default:
+		updates["error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+	database.DB.Model(&database.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates)
+}
+
+func post(hook database.Webhook, delivery database.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "final-account-hub-webhook")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", fmt.Sprintf("%d", delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// RetryDue resends pending deliveries whose backoff has elapsed. Called
+// periodically by the validator scheduler.
+func RetryDue() {
+	now := time.Now()
+	var due []database.WebhookDelivery
+	database.DB.Where("status = ? AND next_attempt_at <= ?", "pending", now).Limit(100).Find(&due)
+	for _, d := range due {
+		// Claim the delivery so an overlapping run does not send it twice
+		result := database.DB.Model(&database.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", d.ID, "pending", now).
+			Update("next_attempt_at", now.Add(claimDuration))
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		var hook database.Webhook
+		if err := database.DB.First(&hook, d.WebhookID).Error; err != nil || !hook.Enabled {
+			database.DB.Model(&d).Updates(map[string]interface{}{"status": "failed", "error": "webhook deleted or disabled", "next_attempt_at": nil})
+			continue
+		}
+		go attempt(hook, d)
+	}
+}
+
+// CleanupDeliveries drops delivery log entries older than 30 days.
+func CleanupDeliveries() {
+	database.DB.Where("created_at < ? AND status != ?", time.Now().AddDate(0, 0, -30), "pending").
+		Delete(&database.WebhookDelivery{})
+}
@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"final-account-hub/database"
+	"final-account-hub/testutil"
+)
+
+type received struct {
+	headers http.Header
+	body    []byte
+}
+
+// newReceiver starts a server that answers with the given status codes in
+// turn (repeating the last one) and records every request.
+func newReceiver(t *testing.T, codes ...int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{r.Header.Clone(), body})
+		code := codes[len(codes)-1]
+		if len(got) <= len(codes) {
+			code = codes[len(got)-1]
+		}
+		mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+func seedWebhook(t *testing.T, categoryID uint, url, events string) database.Webhook {
+	t.Helper()
+	hook := database.Webhook{CategoryID: categoryID, URL: url, Secret: "s3cret", Events: events, Enabled: true}
+	if err := database.DB.Create(&hook).Error; err != nil {
+		t.Fatalf("failed to seed webhook: %v", err)
+	}
+	return hook
+}
+
+// waitForDelivery polls until the delivery has been attempted the given
+// number of times.
+func waitForDelivery(t *testing.T, id uint, attempts int) database.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var d database.WebhookDelivery
+		database.DB.First(&d, id)
+		if d.Attempts >= attempts {
+			return d
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery %d: expected %d attempts, got %d", id, attempts, d.Attempts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{0: 30 * time.Second, 1: 30 * time.Second, 2: time.Minute, 5: 8 * time.Minute}
+	for attempts, want := range cases {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestEmit_SignedDelivery(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	srv, requests := newReceiver(t, http.StatusOK)
+
+	cat := testutil.SeedCategory(t, "emit")
+	other := testutil.SeedCategory(t, "other")
+	seedWebhook(t, cat.ID, srv.URL, EventAccountsImported)
+	seedWebhook(t, 0, srv.URL, EventAccountBanned+","+EventAccountsImported)
+	seedWebhook(t, other.ID, srv.URL, EventAccountsImported)
+	seedWebhook(t, cat.ID, srv.URL, EventValidationFinished)
+
+	Emit(cat.ID, EventAccountsImported, map[string]interface{}{"count": 3})
+
+	var deliveries []database.WebhookDelivery
+	database.DB.Order("id").Find(&deliveries)
+	if len(deliveries) != 2 {
+		t.Fatalf("expected deliveries to the category and global hooks, got %d", len(deliveries))
+	}
+	for _, d := range deliveries {
+		d = waitForDelivery(t, d.ID, 1)
+		if d.Status != "success" || d.ResponseCode != http.StatusOK || d.DeliveredAt == nil {
+			t.Errorf("expected successful delivery, got %+v", d)
+		}
+	}
+
+	for _, r := range requests() {
+		if r.headers.Get(SignatureHeader) != Sign("s3cret", r.body) {
+			t.Errorf("bad signature %q", r.headers.Get(SignatureHeader))
+		}
+		if r.headers.Get("X-Webhook-Event") != EventAccountsImported {
+			t.Errorf("unexpected event header %q", r.headers.Get("X-Webhook-Event"))
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(r.body, &payload)
+		data, _ := payload["data"].(map[string]interface{})
+		if payload["event"] != EventAccountsImported || payload["category_id"] != float64(cat.ID) || data["count"] != float64(3) {
+			t.Errorf("unexpected payload %s", r.body)
+		}
+	}
+}
+
+func TestAttempt_RetryThenFail(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	srv, requests := newReceiver(t, http.StatusInternalServerError)
+
+	cat := testutil.SeedCategory(t, "retry")
+	seedWebhook(t, cat.ID, srv.URL, EventAccountBanned)
+
+	Emit(cat.ID, EventAccountBanned, nil)
+	var d database.WebhookDelivery
+	database.DB.First(&d)
+	d = waitForDelivery(t, d.ID, 1)
+	if d.Status != "pending" || d.ResponseCode != http.StatusInternalServerError || d.NextAttemptAt == nil {
+		t.Fatalf("expected pending retry, got %+v", d)
+	}
+	if wait := time.Until(*d.NextAttemptAt); wait < 20*time.Second || wait > Backoff(1) {
+		t.Errorf("expected retry after ~%v, got %v", Backoff(1), wait)
+	}
+
+	// Not due yet
+	RetryDue()
+	if n := len(requests()); n != 1 {
+		t.Fatalf("expected no early retry, got %d requests", n)
+	}
+
+	for i := 2; i <= MaxAttempts; i++ {
+		database.DB.Model(&d).Update("next_attempt_at", time.Now().Add(-time.Second))
+		RetryDue()
+		d = waitForDelivery(t, d.ID, i)
+	}
+	if d.Status != "failed" || d.NextAttemptAt != nil {
+		t.Errorf("expected failed after %d attempts, got %+v", MaxAttempts, d)
+	}
+	if n := len(requests()); n != MaxAttempts {
+		t.Errorf("expected %d requests, got %d", MaxAttempts, n)
+	}
+}
+
+func TestRetryDue_Recovers(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	srv, _ := newReceiver(t, http.StatusServiceUnavailable, http.StatusNoContent)
+
+	cat := testutil.SeedCategory(t, "recover")
+	seedWebhook(t, cat.ID, srv.URL, EventAccountBanned)
+
+	Emit(cat.ID, EventAccountBanned, nil)
+	var d database.WebhookDelivery
+	database.DB.First(&d)
+	waitForDelivery(t, d.ID, 1)
+
+	database.DB.Model(&d).Update("next_attempt_at", time.Now().Add(-time.Second))
+	RetryDue()
+	d = waitForDelivery(t, d.ID, 2)
+	if d.Status != "success" || d.Error != "" {
+		t.Errorf("expected success on retry, got %+v", d)
+	}
+}
+
+func TestAlert_EmitsLowWatermark(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	srv, requests := newReceiver(t, http.StatusOK)
+
+	cat := testutil.SeedCategory(t, "watermark")
+	database.DB.Model(&cat).Update("low_watermark", 3)
+	seedWebhook(t, cat.ID, srv.URL, EventLowWatermark)
+	accounts := testutil.SeedAccounts(t, cat.ID, 4, "a")
+
+	countDeliveries := func() int64 {
+		var n int64
+		database.DB.Model(&database.WebhookDelivery{}).Count(&n)
+		return n
+	}
+	claim := func(acc database.Account) {
+		database.DB.Model(&acc).Update("used", true)
+		database.CheckAlert(cat.ID)
+	}
+
+	// 4 -> 3 stays at the threshold
+	claim(accounts[0])
+	if n := countDeliveries(); n != 0 {
+		t.Fatalf("expected no event at the threshold, got %d deliveries", n)
+	}
+	// 3 -> 2 drops below it, 2 -> 1 stays low, 1 -> 0 empties the pool
+	claim(accounts[1])
+	claim(accounts[2])
+	claim(accounts[3])
+	if n := countDeliveries(); n != 2 {
+		t.Fatalf("expected events for low and empty, got %d deliveries", n)
+	}
+
+	var pending []database.WebhookDelivery
+	database.DB.Order("id").Find(&pending)
+	for _, p := range pending {
+		waitForDelivery(t, p.ID, 1)
+	}
+	var states []string
+	for _, r := range requests() {
+		var payload struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(r.body, &payload)
+		if payload.Data["low_watermark"] != float64(3) {
+			t.Errorf("expected the category's low watermark, got %s", r.body)
+		}
+		states = append(states, payload.Data["state"].(string))
+	}
+	if len(states) != 2 || !slices.Contains(states, database.AlertLow) || !slices.Contains(states, database.AlertEmpty) {
+		t.Errorf("unexpected alert states %v", states)
+	}
+
+	// Recovering does not fire the event
+	database.DB.Model(&database.Account{}).Where("category_id = ?", cat.ID).Update("used", false)
+	database.CheckAlert(cat.ID)
+	if n := countDeliveries(); n != 2 {
+		t.Errorf("expected no event on recovery, got %d deliveries", n)
+	}
+}
+
+func TestRotateEncryptionKey_WebhookSecrets(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+	srv, requests := newReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+
+	newKey := func() string {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	oldKey, currentKey := newKey(), newKey()
+	database.SetEncryptionKeys(oldKey)
+	t.Cleanup(func() { database.SetEncryptionKeys("") })
+
+	cat := testutil.SeedCategory(t, "rotate")
+	seedWebhook(t, cat.ID, srv.URL, EventAccountBanned)
+
+	database.SetEncryptionKeys(currentKey, oldKey)
+	if _, err := database.RotateEncryptionKey(); err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+	database.SetEncryptionKeys(currentKey)
+
+	var hooks []database.Webhook
+	if err := database.DB.Find(&hooks).Error; err != nil || len(hooks) != 1 || hooks[0].Secret != "s3cret" {
+		t.Fatalf("expected the secret readable with the new key only, got %+v (%v)", hooks, err)
+	}
+
+	Emit(cat.ID, EventAccountBanned, nil)
+	var d database.WebhookDelivery
+	database.DB.First(&d)
+	waitForDelivery(t, d.ID, 1)
+	database.DB.Model(&d).Update("next_attempt_at", time.Now().Add(-time.Second))
+	RetryDue()
+	if d = waitForDelivery(t, d.ID, 2); d.Status != "success" {
+		t.Fatalf("expected the retry to succeed, got %+v", d)
+	}
+	for _, r := range requests() {
+		if r.headers.Get(SignatureHeader) != Sign("s3cret", r.body) {
+			t.Errorf("bad signature %q", r.headers.Get(SignatureHeader))
+		}
+	}
+}
+
+func TestRetryDue_DisabledWebhook(t *testing.T) {
+	testutil.SetupFileTestDB(t)
+
+	cat := testutil.SeedCategory(t, "disabled")
+	hook := seedWebhook(t, cat.ID, "http://127.0.0.1:1", EventAccountBanned)
+	database.DB.Model(&hook).Update("enabled", false)
+	past := time.Now().Add(-time.Second)
+	d := database.WebhookDelivery{WebhookID: hook.ID, Event: EventAccountBanned, Status: "pending", NextAttemptAt: &past}
+	database.DB.Create(&d)
+
+	RetryDue()
+	var got database.WebhookDelivery
+	database.DB.First(&got, d.ID)
+	if got.Status != "failed" || got.Attempts != 0 {
+		t.Errorf("expected disabled webhook delivery to fail without sending, got %+v", got)
+	}
+}